@@ -3,7 +3,12 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -11,14 +16,19 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"strings"
+	"syscall"
 	"time"
 )
 
 const (
 	VERSION     = "1.0.0"
 	CONFIG_FILE = "/etc/ubuntushield/agent.conf"
+
+	// Remediation scripts are stopped after this long, well before the dashboard gives up on the result
+	remediationTimeout = 30 * time.Minute
 )
 
 // AgentConfig holds agent configuration
@@ -28,6 +38,14 @@ type AgentConfig struct {
 	DashboardURL  string `json:"dashboard_url"`
 	AuditInterval int    `json:"audit_interval"` // minutes
 	Hostname      string `json:"hostname"`
+	DashboardKey  string `json:"dashboard_key,omitempty"` // Public key that signs remediation jobs, pinned at registration
+
+	// How Lynis runs; all optional
+	LynisRunner   string   `json:"lynis_runner,omitempty"`   // sudo (default), direct or fake
+	LynisBinary   string   `json:"lynis_binary,omitempty"`   // "lynis" on the PATH by default
+	LynisFlags    []string `json:"lynis_flags,omitempty"`    // e.g. ["--profile", "/etc/lynis/custom.prf"]
+	LynisFixtures []string `json:"lynis_fixtures,omitempty"` // Reports the fake runner replays
+	ReportPath    string   `json:"report_path,omitempty"`    // Where audits leave their report
 }
 
 // AgentMetrics holds system and audit metrics
@@ -43,6 +61,7 @@ type AgentMetrics struct {
 	TestsPerformed  string                 `json:"tests_performed"`
 	ComplianceScore map[string]interface{} `json:"compliance_score"`
 	RawData         map[string]string      `json:"raw_data"`
+	AuditID         string                 `json:"audit_id"` // Completes the audit's live progress
 }
 
 // RegistrationRequest for initial agent registration
@@ -56,10 +75,11 @@ type RegistrationRequest struct {
 
 // RegistrationResponse from dashboard
 type RegistrationResponse struct {
-	Success  bool   `json:"success"`
-	ServerID string `json:"server_id"`
-	APIKey   string `json:"api_key"`
-	Message  string `json:"message"`
+	Success   bool   `json:"success"`
+	ServerID  string `json:"server_id"`
+	APIKey    string `json:"api_key"`
+	PublicKey string `json:"public_key"` // Empty when the dashboard has no signing key
+	Message   string `json:"message"`
 }
 
 // HeartbeatRequest for keepalive
@@ -70,10 +90,50 @@ type HeartbeatRequest struct {
 	AgentVersion string    `json:"agent_version"`
 }
 
+// RemediationJob is a remediation bundle queued by the dashboard
+type RemediationJob struct {
+	ID             string   `json:"id"`
+	RemediationIDs []string `json:"remediation_ids"`
+	DryRun         bool     `json:"dry_run"`
+	Script         string   `json:"script"`
+	ScriptSHA256   string   `json:"script_sha256"`
+	Signature      string   `json:"signature"`
+}
+
+// MaintenanceStatus says whether the dashboard's maintenance windows and blackouts allow audits now
+type MaintenanceStatus struct {
+	Allowed     bool      `json:"allowed"`
+	Reason      string    `json:"reason"`
+	NextAllowed time.Time `json:"next_allowed"`
+}
+
+// JobsResponse from dashboard
+type JobsResponse struct {
+	Success     bool               `json:"success"`
+	Jobs        []*RemediationJob  `json:"jobs"`
+	RunAudit    bool               `json:"run_audit"`
+	Maintenance *MaintenanceStatus `json:"maintenance"` // Missing from dashboards without maintenance windows
+}
+
+// JobResult reports a finished remediation job
+type JobResult struct {
+	JobID    string `json:"job_id"`
+	ExitCode int    `json:"exit_code"`
+	Output   string `json:"output"`
+}
+
+// JobResultResponse from dashboard
+type JobResultResponse struct {
+	Success  bool   `json:"success"`
+	Message  string `json:"message"`
+	RunAudit bool   `json:"run_audit"`
+}
+
 // Agent represents the monitoring agent
 type Agent struct {
-	config *AgentConfig
-	client *http.Client
+	config   *AgentConfig
+	client   *http.Client
+	auditDue bool // An interval audit waits for the dashboard's maintenance settings to allow it
 }
 
 // NewAgent creates a new agent instance
@@ -167,6 +227,7 @@ func (a *Agent) Register(dashboardURL string) error {
 		DashboardURL:  dashboardURL,
 		AuditInterval: 60, // 60 minutes default
 		Hostname:      hostname,
+		DashboardKey:  regResp.PublicKey,
 	}
 
 	if err := a.SaveConfig(); err != nil {
@@ -196,27 +257,57 @@ func (a *Agent) SendHeartbeat() error {
 func (a *Agent) RunAudit() error {
 	log.Println("🔍 Starting security audit...")
 
-	// Check if Lynis is installed
-	_, err := exec.LookPath("lynis")
+	runner, err := newRunner(a.config)
 	if err != nil {
-		return fmt.Errorf("Lynis not found. Please install Lynis first")
+		return err
 	}
+	if err := runner.Available(); err != nil {
+		return err
+	}
+
+	// Dashboards follow the audit live until its metrics arrive
+	relay := a.startProgressRelay()
+	if err := a.audit(runner, relay); err != nil {
+		relay.Fail(err)
+		return err
+	}
+	return nil
+}
 
-	// Run Lynis audit
-	cmd := exec.Command("sudo", "lynis", "audit", "system", "--quick", "--quiet")
-	_, err = cmd.CombinedOutput()
+// audit runs Lynis, relaying its output, and sends the results to the dashboard
+func (a *Agent) audit(runner Runner, relay *progressRelay) error {
+	reportPath := a.config.ReportPath
+	if reportPath == "" {
+		reportPath = defaultReportPath
+	}
+	if err := os.MkdirAll(filepath.Dir(reportPath), 0755); err != nil {
+		return fmt.Errorf("failed to create report directory: %w", err)
+	}
+
+	// Lynis writes next to the report and only a finished audit replaces it
+	partial := reportPath + ".partial"
+	err := runner.Run(partial, false, relay)
+	relay.Close()
 	if err != nil {
-		log.Printf("⚠️ Lynis audit completed with warnings: %v\n", err)
-	} else {
-		log.Println("✅ Lynis audit completed")
+		os.Remove(partial)
+		return fmt.Errorf("%s: %w", runner, err)
+	}
+	if err := os.Rename(partial, reportPath); err != nil {
+		return fmt.Errorf("failed to install Lynis report: %w", err)
 	}
+	log.Println("✅ Lynis audit completed")
 
 	// Parse Lynis report
-	data, err := parseLynisReport()
+	data, err := parseLynisFile(reportPath)
 	if err != nil {
 		return fmt.Errorf("failed to parse Lynis report: %w", err)
 	}
 
+	// Tell the dashboard exactly which distribution this is, for remediation variants
+	for key, value := range readOSRelease() {
+		data["os_release_"+key] = value
+	}
+
 	// Prepare metrics
 	metrics := AgentMetrics{
 		ServerID:       a.config.ServerID,
@@ -229,6 +320,7 @@ func (a *Agent) RunAudit() error {
 		Warnings:       data["warnings"],
 		TestsPerformed: data["lynis_tests_done"],
 		RawData:        data,
+		AuditID:        relay.auditID,
 	}
 
 	// Send metrics to dashboard
@@ -244,17 +336,149 @@ func (a *Agent) RunAudit() error {
 	return nil
 }
 
+// PollJobs fetches queued remediation jobs, runs them and reports the results
+func (a *Agent) PollJobs() error {
+	var jobsResp JobsResponse
+	if err := a.doRequest("GET", "/api/agents/jobs", nil, &jobsResp); err != nil {
+		return err
+	}
+
+	runAudit := jobsResp.RunAudit || a.auditDue
+
+	for _, job := range jobsResp.Jobs {
+		log.Printf("🔧 Running remediation job %s: %v (dry-run: %v)\n", job.ID, job.RemediationIDs, job.DryRun)
+
+		exitCode, output := a.runRemediationJob(job)
+		if exitCode == 0 {
+			log.Printf("✅ Remediation job %s completed\n", job.ID)
+		} else {
+			log.Printf("❌ Remediation job %s failed with exit code %d\n", job.ID, exitCode)
+		}
+
+		var resultResp JobResultResponse
+		result := JobResult{JobID: job.ID, ExitCode: exitCode, Output: output}
+		if err := a.doRequest("POST", "/api/agents/jobs/result", result, &resultResp); err != nil {
+			log.Printf("⚠️ Failed to report result of job %s: %v\n", job.ID, err)
+			continue
+		}
+
+		if resultResp.RunAudit {
+			runAudit = true
+		}
+	}
+
+	if !runAudit {
+		return nil
+	}
+
+	// Audits wait outside maintenance windows and during blackouts
+	if status := jobsResp.Maintenance; status != nil && !status.Allowed {
+		if !a.auditDue {
+			log.Printf("⏸️ Audit deferred: %s\n", status.Reason)
+		}
+		a.auditDue = true
+		return nil
+	}
+
+	// The dashboard wants fresh results after a remediation, or an interval audit is due
+	if jobsResp.RunAudit {
+		log.Println("🔁 Dashboard requested a re-audit")
+	}
+	a.auditDue = false
+	return a.RunAudit()
+}
+
+// runRemediationJob verifies and executes a remediation bundle
+func (a *Agent) runRemediationJob(job *RemediationJob) (int, string) {
+	// Only run scripts signed by the dashboard key pinned at registration
+	if err := a.verifyRemediationJob(job); err != nil {
+		return -1, fmt.Sprintf("%v, refusing to execute", err)
+	}
+
+	file, err := os.CreateTemp("", "ubuntushield-remediation-*.sh")
+	if err != nil {
+		return -1, fmt.Sprintf("failed to create script file: %v", err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.WriteString(job.Script); err != nil {
+		file.Close()
+		return -1, fmt.Sprintf("failed to write script file: %v", err)
+	}
+	file.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), remediationTimeout)
+	defer cancel()
+
+	// The script checks preconditions, backs up files and stops on the first failure
+	var cmd *exec.Cmd
+	if job.DryRun {
+		cmd = exec.CommandContext(ctx, "bash", file.Name(), "--dry-run")
+	} else {
+		cmd = exec.CommandContext(ctx, "sudo", "bash", file.Name())
+	}
+
+	// At the deadline sudo gets SIGTERM, which it passes on to the script, and a minute later SIGKILL
+	cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+	cmd.WaitDelay = time.Minute
+
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return -1, fmt.Sprintf("%s\nstopped after %s", output, remediationTimeout)
+	}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode(), string(output)
+		}
+		return -1, fmt.Sprintf("%s\n%v", output, err)
+	}
+
+	return 0, string(output)
+}
+
+// verifyRemediationJob checks that a job's script matches its digest and that the dashboard key signed
+// the digest for this job on this server. The message must match signedRemediationJob on the dashboard.
+func (a *Agent) verifyRemediationJob(job *RemediationJob) error {
+	key, err := hex.DecodeString(a.config.DashboardKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("no dashboard key to check the job with, re-register the agent or set dashboard_key in %s", CONFIG_FILE)
+	}
+
+	sum := sha256.Sum256([]byte(job.Script))
+	if hex.EncodeToString(sum[:]) != job.ScriptSHA256 {
+		return fmt.Errorf("script checksum mismatch")
+	}
+
+	message := fmt.Sprintf("ubuntushield-remediation\n%s\n%s\n%t\n%s", job.ID, a.config.ServerID, job.DryRun, job.ScriptSHA256)
+	signature, err := hex.DecodeString(job.Signature)
+	if err != nil || !ed25519.Verify(ed25519.PublicKey(key), []byte(message), signature) {
+		return fmt.Errorf("job isn't signed by the dashboard key")
+	}
+
+	return nil
+}
+
 // sendRequest sends authenticated request to dashboard
 func (a *Agent) sendRequest(endpoint string, data interface{}) error {
-	body, err := json.Marshal(data)
-	if err != nil {
-		return err
+	return a.doRequest("POST", endpoint, data, nil)
+}
+
+// doRequest sends an authenticated request and decodes the response into out (if non-nil)
+func (a *Agent) doRequest(method, endpoint string, data interface{}, out interface{}) error {
+	var body io.Reader
+	if data != nil {
+		payload, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewBuffer(payload)
 	}
 
 	req, err := http.NewRequest(
-		"POST",
+		method,
 		a.config.DashboardURL+endpoint,
-		bytes.NewBuffer(body),
+		body,
 	)
 	if err != nil {
 		return err
@@ -274,6 +498,10 @@ func (a *Agent) sendRequest(endpoint string, data interface{}) error {
 		return fmt.Errorf("request failed: %s", string(bodyBytes))
 	}
 
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+
 	return nil
 }
 
@@ -286,19 +514,23 @@ func (a *Agent) Run() {
 		log.Printf("⚠️ Failed to send heartbeat: %v\n", err)
 	}
 
-	// Run initial audit
-	if err := a.RunAudit(); err != nil {
+	// Run initial audit once maintenance settings allow it
+	a.auditDue = true
+	if err := a.PollJobs(); err != nil {
 		log.Printf("❌ Initial audit failed: %v\n", err)
 	}
 
 	// Start periodic tasks
 	heartbeatTicker := time.NewTicker(5 * time.Minute)
 	auditTicker := time.NewTicker(time.Duration(a.config.AuditInterval) * time.Minute)
+	jobsTicker := time.NewTicker(1 * time.Minute)
 
 	defer heartbeatTicker.Stop()
 	defer auditTicker.Stop()
+	defer jobsTicker.Stop()
 
 	log.Printf("⏰ Heartbeat interval: 5 minutes\n")
+	log.Printf("⏰ Job poll interval: 1 minute\n")
 	log.Printf("⏰ Audit interval: %d minutes\n", a.config.AuditInterval)
 	log.Println("✅ Agent is running. Press Ctrl+C to stop.")
 
@@ -312,32 +544,22 @@ func (a *Agent) Run() {
 			}
 
 		case <-auditTicker.C:
-			if err := a.RunAudit(); err != nil {
+			// Polling checks the dashboard's maintenance windows before auditing
+			a.auditDue = true
+			if err := a.PollJobs(); err != nil {
 				log.Printf("❌ Audit failed: %v\n", err)
 			}
+
+		case <-jobsTicker.C:
+			if err := a.PollJobs(); err != nil {
+				log.Printf("⚠️ Job poll failed: %v\n", err)
+			}
 		}
 	}
 }
 
 // Helper functions
 
-func parseLynisReport() (map[string]string, error) {
-	reportPaths := []string{
-		"/tmp/lynis-report.dat",
-		"/var/log/lynis-report.dat",
-		"/usr/local/var/log/lynis-report.dat",
-	}
-
-	for _, path := range reportPaths {
-		data, err := parseLynisFile(path)
-		if err == nil && len(data) > 0 {
-			return data, nil
-		}
-	}
-
-	return nil, fmt.Errorf("no Lynis report found")
-}
-
 func parseLynisFile(path string) (map[string]string, error) {
 	file, err := os.Open(path)
 	if err != nil {
@@ -358,13 +580,50 @@ func parseLynisFile(path string) (map[string]string, error) {
 		if len(parts) == 2 {
 			key := strings.TrimSpace(parts[0])
 			value := strings.TrimSpace(parts[1])
-			data[key] = value
+
+			// Keep every entry of array keys like suggestion[], one per line
+			if strings.HasSuffix(key, "[]") && data[key] != "" {
+				data[key] += "\n" + value
+			} else {
+				data[key] = value
+			}
 		}
 	}
 
 	return data, scanner.Err()
 }
 
+// readOSRelease returns the ID, ID_LIKE and VERSION_ID fields of /etc/os-release
+func readOSRelease() map[string]string {
+	fields := make(map[string]string)
+
+	file, err := os.Open("/etc/os-release")
+	if err != nil {
+		return fields
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		parts := strings.SplitN(strings.TrimSpace(scanner.Text()), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		value := strings.Trim(parts[1], `"'`)
+		switch parts[0] {
+		case "ID":
+			fields["id"] = value
+		case "ID_LIKE":
+			fields["id_like"] = value
+		case "VERSION_ID":
+			fields["version_id"] = value
+		}
+	}
+
+	return fields
+}
+
 func getOutboundIP() string {
 	conn, err := net.Dial("udp", "8.8.8.8:80")
 	if err != nil {
@@ -385,6 +644,7 @@ func main() {
 		fmt.Println("  agent register <dashboard-url>  - Register with central dashboard")
 		fmt.Println("  agent start                      - Start the agent")
 		fmt.Println("  agent audit                      - Run a single audit")
+		fmt.Println("  agent jobs                       - Run queued remediation jobs")
 		fmt.Println("  agent status                     - Show agent status")
 		fmt.Println("\nExample:")
 		fmt.Println("  agent register https://dashboard.example.com")
@@ -426,6 +686,17 @@ func main() {
 			log.Fatalf("❌ Audit failed: %v\n", err)
 		}
 
+	case "jobs":
+		// Load config
+		if err := agent.LoadConfig(); err != nil {
+			log.Fatal("❌ Config not found. Please run 'agent register' first")
+		}
+
+		// Run queued remediation jobs once
+		if err := agent.PollJobs(); err != nil {
+			log.Fatalf("❌ Job poll failed: %v\n", err)
+		}
+
 	case "status":
 		// Load config
 		if err := agent.LoadConfig(); err != nil {
@@ -442,4 +713,3 @@ func main() {
 		log.Fatal("❌ Unknown command: " + command)
 	}
 }
-
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	progressInterval = 2 * time.Second // How often Lynis output is relayed while an audit runs
+	maxPendingLines  = 2000            // Lines held back while the dashboard is slow; older ones are dropped
+)
+
+// ProgressUpdate relays Lynis output of a running audit to the dashboard
+type ProgressUpdate struct {
+	AuditID string   `json:"audit_id"`
+	State   string   `json:"state,omitempty"` // running in the first update, failed if the audit fails
+	Lines   []string `json:"lines,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// progressRelay collects Lynis output and sends it to the dashboard in batches, so dashboards can
+// follow the audit live. It's best effort: once an update fails the rest of the audit isn't relayed.
+type progressRelay struct {
+	agent   *Agent
+	auditID string
+	state   string // Sent with the next update
+	lines   []string
+	partial []byte
+	failed  bool
+	mu      sync.Mutex
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// startProgressRelay starts relaying a new audit
+func (a *Agent) startProgressRelay() *progressRelay {
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	relay := &progressRelay{
+		agent:   a,
+		auditID: hex.EncodeToString(id),
+		state:   "running",
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go relay.run()
+	return relay
+}
+
+// Write collects output, line by line
+func (p *progressRelay) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.failed {
+		return len(b), nil
+	}
+
+	p.partial = append(p.partial, b...)
+	for {
+		i := bytes.IndexByte(p.partial, '\n')
+		if i < 0 {
+			break
+		}
+		p.lines = append(p.lines, string(p.partial[:i]))
+		p.partial = p.partial[i+1:]
+	}
+	if len(p.lines) > maxPendingLines {
+		p.lines = p.lines[len(p.lines)-maxPendingLines:]
+	}
+	return len(b), nil
+}
+
+// Close stops the batching and sends the remaining output
+func (p *progressRelay) Close() {
+	select {
+	case <-p.stopped:
+		return
+	default:
+	}
+	close(p.stop)
+	<-p.stopped
+
+	p.mu.Lock()
+	if len(p.partial) > 0 {
+		p.lines = append(p.lines, string(p.partial))
+		p.partial = nil
+	}
+	p.mu.Unlock()
+	p.send("")
+}
+
+// Fail ends the relayed audit without results
+func (p *progressRelay) Fail(err error) {
+	p.Close()
+
+	p.mu.Lock()
+	p.state = "failed"
+	p.mu.Unlock()
+	p.send(err.Error())
+}
+
+func (p *progressRelay) run() {
+	defer close(p.stopped)
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.send("")
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// send relays the collected lines and pending state, if any
+func (p *progressRelay) send(message string) {
+	p.mu.Lock()
+	if p.failed || (len(p.lines) == 0 && p.state == "") {
+		p.mu.Unlock()
+		return
+	}
+	update := ProgressUpdate{AuditID: p.auditID, State: p.state, Lines: p.lines, Error: message}
+	p.lines = nil
+	p.state = ""
+	p.mu.Unlock()
+
+	if err := p.agent.sendRequest("/api/agents/audits/progress", update); err != nil {
+		log.Printf("⚠️ Live audit progress unavailable: %v\n", err)
+		p.mu.Lock()
+		p.failed = true
+		p.mu.Unlock()
+	}
+}
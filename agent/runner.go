@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Runner runs a Lynis system audit. On success the report is at reportPath, readable by the agent.
+type Runner interface {
+	// Available returns why audits can't run, e.g. a missing binary
+	Available() error
+	// Run audits the system, writing Lynis output to output as it comes
+	Run(reportPath string, quiet bool, output io.Writer) error
+	// String describes the runner for logs
+	String() string
+}
+
+// defaultReportPath is where audits leave their report unless report_path is configured
+const defaultReportPath = "/var/lib/ubuntushield/lynis-report.dat"
+
+// newRunner creates the runner selected by lynis_runner: sudo (default), direct or fake
+func newRunner(config *AgentConfig) (Runner, error) {
+	binary := config.LynisBinary
+	if binary == "" {
+		binary = "lynis"
+	}
+	direct := DirectRunner{Binary: binary, Flags: config.LynisFlags}
+
+	switch config.LynisRunner {
+	case "", "sudo":
+		return &SudoRunner{direct}, nil
+	case "direct":
+		return &direct, nil
+	case "fake":
+		return newFakeRunner(config.LynisFixtures)
+	default:
+		return nil, fmt.Errorf("unknown Lynis runner %q (expected sudo, direct or fake)", config.LynisRunner)
+	}
+}
+
+// DirectRunner runs Lynis as the agent's own user, for agents running as root
+type DirectRunner struct {
+	Binary string
+	Flags  []string
+}
+
+// Available checks that the binary exists
+func (r *DirectRunner) Available() error {
+	if _, err := exec.LookPath(r.Binary); err != nil {
+		return fmt.Errorf("Lynis not found (%s). Please install Lynis first", r.Binary)
+	}
+	return nil
+}
+
+// Run runs the audit
+func (r *DirectRunner) Run(reportPath string, quiet bool, output io.Writer) error {
+	return runCommand(exec.Command(r.Binary, r.args(reportPath, quiet)...), output)
+}
+
+func (r *DirectRunner) String() string {
+	return strings.Join(append([]string{r.Binary}, r.Flags...), " ")
+}
+
+func (r *DirectRunner) args(reportPath string, quiet bool) []string {
+	args := []string{"audit", "system", "--quick", "--report-file", reportPath}
+	if quiet {
+		args = append(args, "--quiet")
+	}
+	return append(args, r.Flags...)
+}
+
+// SudoRunner runs Lynis through non-interactive sudo and hands the report to the agent's user
+type SudoRunner struct {
+	DirectRunner
+}
+
+// Run runs the audit as root
+func (r *SudoRunner) Run(reportPath string, quiet bool, output io.Writer) error {
+	args := append([]string{"-n", r.Binary}, r.args(reportPath, quiet)...)
+	err := runCommand(exec.Command("sudo", args...), output)
+
+	// Lynis creates the report as root, readable by root only
+	if _, statErr := os.Stat(reportPath); statErr == nil {
+		owner := fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())
+		if chownErr := exec.Command("sudo", "-n", "chown", owner, reportPath).Run(); chownErr != nil && err == nil {
+			err = fmt.Errorf("failed to take ownership of the report: %w", chownErr)
+		}
+	}
+	return err
+}
+
+func (r *SudoRunner) String() string {
+	return "sudo " + r.DirectRunner.String()
+}
+
+// FakeRunner replays fixture reports in turn instead of running Lynis, for testing a deployment. The
+// Lynis output saved next to a fixture as <fixture>.log, if any, is replayed with it.
+type FakeRunner struct {
+	Fixtures []string
+
+	mu   sync.Mutex
+	next int
+}
+
+// newFakeRunner creates a fake runner from report files and directories of *.dat files
+func newFakeRunner(paths []string) (*FakeRunner, error) {
+	runner := &FakeRunner{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("fixture report: %w", err)
+		}
+		if !info.IsDir() {
+			runner.Fixtures = append(runner.Fixtures, path)
+			continue
+		}
+
+		matches, err := filepath.Glob(filepath.Join(path, "*.dat"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+		runner.Fixtures = append(runner.Fixtures, matches...)
+	}
+
+	if len(runner.Fixtures) == 0 {
+		return nil, fmt.Errorf("the fake Lynis runner needs fixture reports (lynis_fixtures)")
+	}
+	return runner, nil
+}
+
+// Available always succeeds; fixtures are checked when the runner is created
+func (r *FakeRunner) Available() error {
+	return nil
+}
+
+// Run copies the next fixture to reportPath
+func (r *FakeRunner) Run(reportPath string, quiet bool, output io.Writer) error {
+	r.mu.Lock()
+	fixture := r.Fixtures[r.next%len(r.Fixtures)]
+	r.next++
+	r.mu.Unlock()
+
+	if saved, err := os.ReadFile(fixture + ".log"); err == nil && !quiet {
+		output.Write(saved)
+	}
+
+	data, err := os.ReadFile(fixture)
+	if err != nil {
+		return fmt.Errorf("failed to read fixture report: %w", err)
+	}
+	if err := os.WriteFile(reportPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+
+	fmt.Fprintln(output, "Replayed fixture report "+fixture)
+	return nil
+}
+
+func (r *FakeRunner) String() string {
+	return fmt.Sprintf("fake (%d fixture reports)", len(r.Fixtures))
+}
+
+// runCommand runs an audit command, writing its output to output
+func runCommand(cmd *exec.Cmd, output io.Writer) error {
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return fmt.Errorf("Lynis exited with status %d", exitErr.ExitCode())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to run Lynis: %w", err)
+	}
+	return nil
+}
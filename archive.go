@@ -0,0 +1,506 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Archive layout: a gzipped tar holding every value as data/<bucket>/<key>, followed by
+// manifest.json listing each value with its checksum. The manifest comes last so exports can
+// stream values straight from storage.
+const (
+	archiveFormat        = "ubuntushield-archive"
+	archiveFormatVersion = 2 // Version 2 adds the retention run logs
+	archiveManifestName  = "manifest.json"
+	archiveDataPrefix    = "data/"
+
+	maxArchiveSize         = 1 << 30 // Imports are unpacked to a temporary directory and validated before anything is written
+	maxArchiveExpandedSize = 2 << 30 // Limit on the decompressed contents, so a small upload can't fill the disk
+	maxArchiveEntrySize    = 64 << 20
+)
+
+// Archived categories, in the order they are imported so snapshots exist before the records using them.
+// Retention runs explain the gaps pruned records leave in the audit chains.
+var archiveCategories = []string{"snapshots", "servers", "metrics", "jobs", "history", "retention"}
+
+// ArchiveManifest describes the contents of an archive
+type ArchiveManifest struct {
+	Format        string         `json:"format"`
+	Version       int            `json:"version"`
+	CreatedAt     time.Time      `json:"created_at"`
+	Hostname      string         `json:"hostname"`
+	SourceBackend string         `json:"source_backend"`
+	Counts        map[string]int `json:"counts"` // Values per category
+	Entries       []ArchiveEntry `json:"entries"`
+}
+
+// archiveFiles are the data files of an archive being imported, unpacked to a temporary directory so
+// only one value at a time is held in memory
+type archiveFiles struct {
+	dir   string
+	files map[string]archiveFile // By path in the archive
+}
+
+// archiveFile is one unpacked data file
+type archiveFile struct {
+	name   string // Temporary file
+	size   int
+	sha256 string
+}
+
+// ArchiveEntry is one stored value in an archive
+type ArchiveEntry struct {
+	Path     string `json:"path"`
+	Bucket   string `json:"bucket"`
+	Key      string `json:"key"`
+	Category string `json:"category"`
+	Size     int    `json:"size"`
+	SHA256   string `json:"sha256"`
+}
+
+// ImportCounts tallies what happened to one category of values
+type ImportCounts struct {
+	Added      int `json:"added"`
+	Duplicates int `json:"duplicates"` // Already present with identical content
+	Conflicts  int `json:"conflicts"`  // Present with different content, the local copy was kept
+}
+
+// ImportReport describes the outcome of an import
+type ImportReport struct {
+	DryRun        bool                     `json:"dry_run"`
+	ArchiveDate   time.Time                `json:"archive_created_at"`
+	ArchiveHost   string                   `json:"archive_hostname"`
+	Categories    map[string]*ImportCounts `json:"categories"`
+	ConflictPaths []string                 `json:"conflict_paths"`
+}
+
+// ExportArchive writes every history record, snapshot, server, metric, job and retention run to w
+func ExportArchive(store Storage, w io.Writer) (*ArchiveManifest, error) {
+	hostname, _ := os.Hostname()
+	manifest := &ArchiveManifest{
+		Format:        archiveFormat,
+		Version:       archiveFormatVersion,
+		CreatedAt:     time.Now(),
+		Hostname:      hostname,
+		SourceBackend: store.Backend(),
+		Counts:        make(map[string]int),
+		Entries:       []ArchiveEntry{},
+	}
+
+	gzWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzWriter)
+
+	for _, root := range []string{historyBucket, snapshotsBucket, "servers", retentionRunsBucket} {
+		err := walkStorage(store, root, func(bucket, key string, value []byte) error {
+			category := archiveCategory(bucket)
+			if category == "" {
+				return nil
+			}
+
+			entry := ArchiveEntry{
+				Path:     archiveDataPrefix + bucket + "/" + key,
+				Bucket:   bucket,
+				Key:      key,
+				Category: category,
+				Size:     len(value),
+				SHA256:   archiveChecksum(value),
+			}
+			if err := writeArchiveFile(tarWriter, entry.Path, value, manifest.CreatedAt); err != nil {
+				return err
+			}
+
+			manifest.Entries = append(manifest.Entries, entry)
+			manifest.Counts[category]++
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	encoded, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeArchiveFile(tarWriter, archiveManifestName, encoded, manifest.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return nil, err
+	}
+	if err := gzWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// ImportArchive validates an archive completely and then merges it into store. Values that already
+// exist are never overwritten, so importing the same archive twice changes nothing.
+func ImportArchive(store Storage, r io.Reader, dryRun bool) (*ImportReport, error) {
+	manifest, files, err := readArchive(r)
+	if err != nil {
+		return nil, err
+	}
+	defer files.Close()
+
+	report := &ImportReport{
+		DryRun:        dryRun,
+		ArchiveDate:   manifest.CreatedAt,
+		ArchiveHost:   manifest.Hostname,
+		Categories:    make(map[string]*ImportCounts),
+		ConflictPaths: []string{},
+	}
+	for _, category := range archiveCategories {
+		report.Categories[category] = &ImportCounts{}
+	}
+
+	entries := make([]ArchiveEntry, len(manifest.Entries))
+	copy(entries, manifest.Entries)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return archiveCategoryOrder(entries[i].Category) < archiveCategoryOrder(entries[j].Category)
+	})
+
+	for _, entry := range entries {
+		value, err := files.read(entry.Path)
+		if err != nil {
+			return report, err
+		}
+		counts := report.Categories[entry.Category]
+
+		existing, err := store.Get(entry.Bucket, entry.Key)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			if !dryRun {
+				if err := store.Put(entry.Bucket, entry.Key, value); err != nil {
+					return report, fmt.Errorf("failed to import %s: %w", entry.Path, err)
+				}
+			}
+			counts.Added++
+		case err != nil:
+			return report, fmt.Errorf("failed to read %s/%s: %w", entry.Bucket, entry.Key, err)
+		case sameStoredValue(existing, value):
+			counts.Duplicates++
+		default:
+			counts.Conflicts++
+			report.ConflictPaths = append(report.ConflictPaths, entry.Path)
+		}
+	}
+
+	return report, nil
+}
+
+// runArchiveCommand implements "UbuntuShield export-archive <file>" and "UbuntuShield import-archive [--dry-run] <file>"
+func runArchiveCommand(command string, args []string) error {
+	dryRun := len(args) > 0 && args[0] == "--dry-run"
+	if dryRun {
+		args = args[1:]
+	}
+	if len(args) != 1 || (dryRun && command != "import-archive") {
+		return fmt.Errorf("usage: export-archive <file> | import-archive [--dry-run] <file>")
+	}
+
+	store, err := OpenStorage(DefaultStorageConfig())
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if command == "export-archive" {
+		file, err := os.Create(args[0])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		manifest, err := ExportArchive(store, file)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✅ Exported %d values to %s\n", len(manifest.Entries), args[0])
+		return file.Close()
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	report, err := ImportArchive(store, file, dryRun)
+	if err != nil {
+		return err
+	}
+
+	// The history index is rebuilt on the next start because its records changed
+	for _, category := range archiveCategories {
+		counts := report.Categories[category]
+		fmt.Printf("%-10s added %d, duplicates %d, conflicts %d\n", category, counts.Added, counts.Duplicates, counts.Conflicts)
+	}
+	for _, path := range report.ConflictPaths {
+		fmt.Printf("⚠️ Kept local copy of %s\n", path)
+	}
+	return nil
+}
+
+// Helper functions
+
+// readArchive unpacks an archive to a temporary directory and checks it against its manifest. The
+// caller closes the returned files to remove the directory.
+func readArchive(r io.Reader) (*ArchiveManifest, *archiveFiles, error) {
+	gzReader, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("not a dashboard archive: %w", err)
+	}
+	defer gzReader.Close()
+
+	dir, err := os.MkdirTemp("", "ubuntushield-import-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to unpack archive: %w", err)
+	}
+	files := &archiveFiles{dir: dir, files: make(map[string]archiveFile)}
+
+	manifest, err := unpackArchive(tar.NewReader(gzReader), files)
+	if err != nil {
+		files.Close()
+		return nil, nil, err
+	}
+
+	return manifest, files, nil
+}
+
+func unpackArchive(tarReader *tar.Reader, files *archiveFiles) (*ArchiveManifest, error) {
+	var manifestData []byte
+	var expanded int64
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("archive is damaged: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("archive contains unexpected entry %s", header.Name)
+		}
+
+		if header.Size > maxArchiveEntrySize {
+			return nil, fmt.Errorf("archive entry %s is too large (%d bytes, limit %d)", header.Name, header.Size, maxArchiveEntrySize)
+		}
+
+		// The tar header can't be trusted either, so the reads are limited too
+		var size int64
+		switch {
+		case header.Name == archiveManifestName:
+			manifestData, err = io.ReadAll(io.LimitReader(tarReader, maxArchiveEntrySize+1))
+			size = int64(len(manifestData))
+		case strings.HasPrefix(header.Name, archiveDataPrefix):
+			if _, exists := files.files[header.Name]; exists {
+				return nil, fmt.Errorf("archive contains %s twice", header.Name)
+			}
+			var file archiveFile
+			file, err = files.write(io.LimitReader(tarReader, maxArchiveEntrySize+1))
+			files.files[header.Name] = file
+			size = int64(file.size)
+		default:
+			return nil, fmt.Errorf("archive contains unexpected file %s", header.Name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("archive is damaged: %w", err)
+		}
+		if size > maxArchiveEntrySize {
+			return nil, fmt.Errorf("archive entry %s is too large (limit %d bytes)", header.Name, maxArchiveEntrySize)
+		}
+		expanded += size
+		if expanded > maxArchiveExpandedSize {
+			return nil, fmt.Errorf("archive is too large once decompressed (limit %d bytes)", int64(maxArchiveExpandedSize))
+		}
+	}
+
+	if manifestData == nil {
+		return nil, fmt.Errorf("archive has no manifest")
+	}
+
+	var manifest ArchiveManifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return nil, fmt.Errorf("archive manifest is not readable: %w", err)
+	}
+	if manifest.Format != archiveFormat {
+		return nil, fmt.Errorf("not a dashboard archive (format %q)", manifest.Format)
+	}
+	if manifest.Version < 1 || manifest.Version > archiveFormatVersion {
+		return nil, fmt.Errorf("archive format version %d is not supported (expected up to %d)", manifest.Version, archiveFormatVersion)
+	}
+
+	listed := make(map[string]bool, len(manifest.Entries))
+	for _, entry := range manifest.Entries {
+		if err := validateArchiveEntry(entry, files); err != nil {
+			return nil, err
+		}
+		if listed[entry.Path] {
+			return nil, fmt.Errorf("manifest lists %s twice", entry.Path)
+		}
+		listed[entry.Path] = true
+	}
+	for path := range files.files {
+		if !listed[path] {
+			return nil, fmt.Errorf("archive file %s is missing from the manifest", path)
+		}
+	}
+
+	return &manifest, nil
+}
+
+// write stores one data file in the temporary directory, checksumming it on the way
+func (af *archiveFiles) write(r io.Reader) (archiveFile, error) {
+	file, err := os.CreateTemp(af.dir, "entry-*")
+	if err != nil {
+		return archiveFile{}, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), r)
+	if err != nil {
+		return archiveFile{}, err
+	}
+
+	return archiveFile{name: file.Name(), size: int(size), sha256: hex.EncodeToString(hash.Sum(nil))}, file.Close()
+}
+
+// read returns the contents of a data file
+func (af *archiveFiles) read(path string) ([]byte, error) {
+	file, ok := af.files[path]
+	if !ok {
+		return nil, fmt.Errorf("archive is missing %s", path)
+	}
+
+	value, err := os.ReadFile(file.name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read unpacked %s: %w", path, err)
+	}
+	return value, nil
+}
+
+// Close removes the temporary directory
+func (af *archiveFiles) Close() error {
+	return os.RemoveAll(af.dir)
+}
+
+// validateArchiveEntry checks an entry's placement, checksum and content
+func validateArchiveEntry(entry ArchiveEntry, files *archiveFiles) error {
+	if entry.Key == "" || strings.ContainsAny(entry.Key, "/\\") || strings.HasPrefix(entry.Key, ".") {
+		return fmt.Errorf("manifest entry %s has an invalid key", entry.Path)
+	}
+	for _, part := range strings.Split(entry.Bucket, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("manifest entry %s has an invalid bucket", entry.Path)
+		}
+	}
+	if entry.Path != archiveDataPrefix+entry.Bucket+"/"+entry.Key {
+		return fmt.Errorf("manifest entry %s does not match its bucket and key", entry.Path)
+	}
+	if archiveCategory(entry.Bucket) == "" || archiveCategory(entry.Bucket) != entry.Category {
+		return fmt.Errorf("manifest entry %s has an unexpected category %q", entry.Path, entry.Category)
+	}
+
+	file, ok := files.files[entry.Path]
+	if !ok {
+		return fmt.Errorf("archive is missing %s", entry.Path)
+	}
+	if file.size != entry.Size || file.sha256 != entry.SHA256 {
+		return fmt.Errorf("%s failed its checksum", entry.Path)
+	}
+
+	value, err := files.read(entry.Path)
+	if err != nil {
+		return err
+	}
+
+	switch entry.Category {
+	case "snapshots":
+		if _, err := decodeSnapshot(entry.Key, value); err != nil {
+			return err
+		}
+	default:
+		var decoded map[string]interface{}
+		if err := json.Unmarshal(decodedStoredValue(value), &decoded); err != nil {
+			return fmt.Errorf("%s is not valid JSON: %w", entry.Path, err)
+		}
+	}
+
+	return nil
+}
+
+// archiveCategory maps a bucket to the category it is archived under, "" if it isn't archived
+func archiveCategory(bucket string) string {
+	parts := strings.Split(bucket, "/")
+	switch {
+	case bucket == historyBucket:
+		return "history"
+	case bucket == snapshotsBucket:
+		return "snapshots"
+	case len(parts) == 2 && parts[0] == "servers":
+		return "servers"
+	case len(parts) == 3 && parts[0] == "servers" && parts[2] == historyBucket:
+		return "history"
+	case len(parts) == 3 && parts[0] == "servers" && parts[2] == snapshotsBucket:
+		return "snapshots"
+	case len(parts) == 3 && parts[0] == "servers" && parts[2] == "audits":
+		return "metrics"
+	case len(parts) == 3 && parts[0] == "servers" && parts[2] == "jobs":
+		return "jobs"
+	case len(parts) == 2 && parts[0] == retentionRunsBucket:
+		return "retention"
+	default:
+		return ""
+	}
+}
+
+func archiveCategoryOrder(category string) int {
+	for i, name := range archiveCategories {
+		if name == category {
+			return i
+		}
+	}
+	return len(archiveCategories)
+}
+
+func archiveChecksum(value []byte) string {
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:])
+}
+
+func writeArchiveFile(tarWriter *tar.Writer, name string, data []byte, modTime time.Time) error {
+	header := &tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		ModTime:  modTime,
+		Typeflag: tar.TypeReg,
+	}
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if _, err := tarWriter.Write(data); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return nil
+}
+
+// sameStoredValue compares values regardless of whether either was compressed by the history cleanup
+func sameStoredValue(a, b []byte) bool {
+	return bytes.Equal(decodedStoredValue(a), decodedStoredValue(b))
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadArchive(t *testing.T) {
+	record := []byte(`{"id":"audit_2026-05-04_10-00-00","hardening_index":"60"}`)
+	entry := ArchiveEntry{
+		Path:     "data/history/audit_2026-05-04_10-00-00",
+		Bucket:   historyBucket,
+		Key:      "audit_2026-05-04_10-00-00",
+		Category: "history",
+		Size:     len(record),
+		SHA256:   archiveChecksum(record),
+	}
+	manifest := func(entries ...ArchiveEntry) *ArchiveManifest {
+		return &ArchiveManifest{Format: archiveFormat, Version: archiveFormatVersion, Entries: entries}
+	}
+	data := func(e ArchiveEntry, value []byte) testArchiveFile {
+		return testArchiveFile{name: e.Path, data: value}
+	}
+
+	tests := []struct {
+		name    string
+		archive []byte
+		wantErr string // Empty for a valid archive
+	}{
+		{
+			name:    "valid",
+			archive: buildTestArchive(t, manifest(entry), data(entry, record)),
+		},
+		{
+			name:    "not gzipped",
+			archive: []byte("PK\x03\x04 not a tarball"),
+			wantErr: "not a dashboard archive",
+		},
+		{
+			name:    "no manifest",
+			archive: buildTestArchive(t, nil, data(entry, record)),
+			wantErr: "has no manifest",
+		},
+		{
+			name:    "other format",
+			archive: buildTestArchive(t, &ArchiveManifest{Format: "tarball", Version: 1}),
+			wantErr: "not a dashboard archive",
+		},
+		{
+			name:    "newer version",
+			archive: buildTestArchive(t, &ArchiveManifest{Format: archiveFormat, Version: archiveFormatVersion + 1}),
+			wantErr: "not supported",
+		},
+		{
+			name:    "file outside data",
+			archive: buildTestArchive(t, manifest(), testArchiveFile{name: "etc/passwd", data: []byte("root")}),
+			wantErr: "unexpected file",
+		},
+		{
+			name:    "symlink",
+			archive: buildTestArchive(t, manifest(), testArchiveFile{name: "data/history/link", typeflag: tar.TypeSymlink}),
+			wantErr: "unexpected entry",
+		},
+		{
+			name:    "file twice",
+			archive: buildTestArchive(t, manifest(entry), data(entry, record), data(entry, record)),
+			wantErr: "twice",
+		},
+		{
+			name:    "listed twice",
+			archive: buildTestArchive(t, manifest(entry, entry), data(entry, record)),
+			wantErr: "lists",
+		},
+		{
+			name:    "unlisted file",
+			archive: buildTestArchive(t, manifest(), data(entry, record)),
+			wantErr: "missing from the manifest",
+		},
+		{
+			name:    "listed file missing",
+			archive: buildTestArchive(t, manifest(entry)),
+			wantErr: "archive is missing",
+		},
+		{
+			name:    "checksum mismatch",
+			archive: buildTestArchive(t, manifest(entry), data(entry, bytes.Replace(record, []byte("60"), []byte("99"), 1))),
+			wantErr: "checksum",
+		},
+		{
+			name:    "invalid key",
+			archive: buildTestArchive(t, manifest(withEntry(entry, func(e *ArchiveEntry) { e.Key = ".hidden"; e.Path = "data/history/.hidden" }))),
+			wantErr: "invalid key",
+		},
+		{
+			name:    "bucket traversal",
+			archive: buildTestArchive(t, manifest(withEntry(entry, func(e *ArchiveEntry) { e.Bucket = "history/../../etc" }))),
+			wantErr: "invalid bucket",
+		},
+		{
+			name:    "path doesn't match bucket and key",
+			archive: buildTestArchive(t, manifest(withEntry(entry, func(e *ArchiveEntry) { e.Path = "data/history/other" }))),
+			wantErr: "does not match",
+		},
+		{
+			name:    "wrong category",
+			archive: buildTestArchive(t, manifest(withEntry(entry, func(e *ArchiveEntry) { e.Category = "jobs" })), data(entry, record)),
+			wantErr: "unexpected category",
+		},
+		{
+			name: "not JSON",
+			archive: func() []byte {
+				value := []byte("not json")
+				e := withEntry(entry, func(e *ArchiveEntry) { e.Size, e.SHA256 = len(value), archiveChecksum(value) })
+				return buildTestArchive(t, manifest(e), data(e, value))
+			}(),
+			wantErr: "not valid JSON",
+		},
+		{
+			name:    "entry over the size limit",
+			archive: buildTestArchive(t, manifest(), data(entry, make([]byte, maxArchiveEntrySize+1))),
+			wantErr: "too large",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest, files, err := readArchive(bytes.NewReader(tt.archive))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("readArchive() error = %v", err)
+				}
+				value, err := files.read(entry.Path)
+				if len(manifest.Entries) != 1 || err != nil || !bytes.Equal(value, record) {
+					t.Errorf("readArchive() = %+v, %q, %v", manifest, value, err)
+				}
+
+				// Closing removes the unpacked files
+				if err := files.Close(); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := os.Stat(files.dir); !os.IsNotExist(err) {
+					t.Errorf("unpacked archive is still in %s: %v", files.dir, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("readArchive() error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// testArchiveFile is one tar entry of a hand-built archive
+type testArchiveFile struct {
+	name     string
+	data     []byte
+	typeflag byte // Regular file when zero
+}
+
+// buildTestArchive writes files and, unless it's nil, the manifest as a gzipped tar
+func buildTestArchive(t *testing.T, manifest *ArchiveManifest, files ...testArchiveFile) []byte {
+	t.Helper()
+
+	if manifest != nil {
+		encoded, err := json.Marshal(manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, testArchiveFile{name: archiveManifestName, data: encoded})
+	}
+
+	var buf bytes.Buffer
+	gzWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzWriter)
+	for _, file := range files {
+		header := &tar.Header{Name: file.name, Mode: 0644, Size: int64(len(file.data)), ModTime: time.Now(), Typeflag: file.typeflag}
+		if file.typeflag == 0 {
+			header.Typeflag = tar.TypeReg
+		} else {
+			header.Size = 0
+			header.Linkname = "/etc/shadow"
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tarWriter.Write(file.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func withEntry(entry ArchiveEntry, change func(*ArchiveEntry)) ArchiveEntry {
+	change(&entry)
+	return entry
+}
+
+func TestArchiveRoundTripKeepsRetentionRuns(t *testing.T) {
+	src := newTestHistory(t)
+
+	// The middle audit is pruned; the oldest one is under legal hold, so the gap is inside the chain
+	for _, daysAgo := range []int{100, 90, 10} {
+		saveTestAudit(t, src, time.Now().AddDate(0, 0, -daysAgo), "60", "5")
+	}
+	holdUntil := time.Now().AddDate(0, 0, -95)
+	counts, pruned, err := src.CleanupOldRecords(RetentionPolicy{RetentionDays: 50}, holdUntil.After)
+	if err != nil || counts.Deleted != 1 {
+		t.Fatalf("CleanupOldRecords() = %+v, %v, want one deleted", counts, err)
+	}
+	run, err := json.Marshal(RetentionRun{ID: "run_1", ServerID: localServerID, StartedAt: time.Now(), HistoryPruned: pruned})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := src.store.Put(retentionRunsBucket+"/"+localServerID, "run_1", run); err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	if _, err := ExportArchive(src.store, &archive); err != nil {
+		t.Fatal(err)
+	}
+	dst, err := OpenDBStorage(t.TempDir() + "/dashboard.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	report, err := ImportArchive(dst, &archive, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Categories["history"].Added != 2 || report.Categories["retention"].Added != 1 {
+		t.Fatalf("ImportArchive() history %+v, retention %+v, want 2 records and 1 run", report.Categories["history"], report.Categories["retention"])
+	}
+
+	// The imported run explains the gap, as it did before the export
+	history, err := NewHistoryManager(dst, localServerID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prunedHistory, _, err := (&RetentionManager{store: dst}).PrunedHashes(localServerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := history.VerifyChain(prunedHistory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Valid || status.Pruned != 1 {
+		t.Errorf("VerifyChain() after import = %+v, want valid with one pruned link", status)
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrOutOfOrder is returned for an audit older than the newest stored one. Chains are verified in
+// timestamp order, so storing it would break the links on both sides.
+var ErrOutOfOrder = errors.New("audit is older than the newest stored audit")
+
+// ChainLink ties a stored audit to the one before it, so edits, insertions and removals
+// between records break the chain
+type ChainLink struct {
+	PrevHash  string `json:"prev_hash,omitempty"`
+	Hash      string `json:"hash,omitempty"`      // SHA-256 of the record with Hash and Signature empty
+	Signature string `json:"signature,omitempty"` // Ed25519 signature of Hash by the dashboard key
+}
+
+// ChainBreak is one problem found while verifying a chain
+type ChainBreak struct {
+	ID      string `json:"id"`
+	Problem string `json:"problem"`
+}
+
+// ChainStatus is the verification result of one chain
+type ChainStatus struct {
+	Records  int          `json:"records"`
+	Chained  int          `json:"chained"`
+	Legacy   int          `json:"legacy"` // Records stored before chaining, at the start of the chain
+	Signed   int          `json:"signed"` // Records with a valid signature
+	Unsigned int          `json:"unsigned"`
+	Pruned   int          `json:"pruned"` // Links to records deleted by retention
+	Head     string       `json:"head"`   // Hash of the newest record, worth noting down outside the dashboard
+	Valid    bool         `json:"valid"`
+	Breaks   []ChainBreak `json:"breaks"`
+}
+
+// ChainReport covers both chains kept for a server
+type ChainReport struct {
+	ServerID          string      `json:"server_id"`
+	History           ChainStatus `json:"history"`
+	Metrics           ChainStatus `json:"metrics"`
+	Valid             bool        `json:"valid"`
+	SignaturesChecked bool        `json:"signatures_checked"`
+	PublicKey         string      `json:"public_key,omitempty"`
+}
+
+// ChainSigner signs record hashes with the dashboard key. A nil signer leaves records unsigned.
+type ChainSigner struct {
+	key ed25519.PrivateKey
+}
+
+// LoadChainSigner reads the dashboard key from UBUNTUSHIELD_SIGNING_KEY, creating the key file if it
+// doesn't exist yet. Without the variable records are chained but not signed.
+func LoadChainSigner() (*ChainSigner, error) {
+	path := os.Getenv("UBUNTUSHIELD_SIGNING_KEY")
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, []byte(hex.EncodeToString(key.Seed())+"\n"), 0600); err != nil {
+			return nil, fmt.Errorf("failed to write signing key: %w", err)
+		}
+		return &ChainSigner{key: key}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+
+	seed, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("%s is not a hex-encoded Ed25519 seed", path)
+	}
+
+	return &ChainSigner{key: ed25519.NewKeyFromSeed(seed)}, nil
+}
+
+// PublicKey returns the hex-encoded public key, empty without a signer
+func (cs *ChainSigner) PublicKey() string {
+	if cs == nil {
+		return ""
+	}
+	return hex.EncodeToString(cs.key.Public().(ed25519.PublicKey))
+}
+
+// seal stores a record's hash and, with a signer, its signature
+func (cs *ChainSigner) seal(link *ChainLink, hash string) {
+	link.Hash = hash
+	link.Signature = cs.sign(hash)
+}
+
+// sign returns the hex-encoded signature of message, empty without a signer
+func (cs *ChainSigner) sign(message string) string {
+	if cs == nil {
+		return ""
+	}
+	return hex.EncodeToString(ed25519.Sign(cs.key, []byte(message)))
+}
+
+// verify reports whether a signature is valid for a hash
+func (cs *ChainSigner) verify(hash, signature string) bool {
+	sig, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(cs.key.Public().(ed25519.PublicKey), []byte(hash), sig)
+}
+
+// VerifyChain checks every stored history record against its hash and the record before it. Links
+// to the pruned hashes of records deleted by retention are not breaks.
+func (hm *HistoryManager) VerifyChain(pruned map[string]bool) (ChainStatus, error) {
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+
+	keys, err := hm.store.Keys(hm.buckets.records)
+	if err != nil {
+		return ChainStatus{}, err
+	}
+
+	entries := make([]chainEntry, 0, len(keys))
+	for _, key := range keys {
+		record, err := hm.readRecord(key)
+		if err != nil {
+			return ChainStatus{}, fmt.Errorf("failed to read history record %s: %w", key, err)
+		}
+		computed, err := record.chainHash()
+		if err != nil {
+			return ChainStatus{}, err
+		}
+		entries = append(entries, chainEntry{ID: key, Link: record.ChainLink, Computed: computed})
+	}
+
+	return verifyChain(entries, hm.signer, pruned), nil
+}
+
+// VerifyChain checks every stored metrics submission of a server against its hash and the one before
+// it, accepting links to the pruned hashes of deleted submissions
+func (sm *ServerManager) VerifyChain(serverID string, pruned map[string]bool) (ChainStatus, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	keys, err := sm.store.Keys(auditsBucket(serverID))
+	if err != nil {
+		return ChainStatus{}, err
+	}
+
+	entries := make([]chainEntry, 0, len(keys))
+	for _, key := range keys {
+		metrics, err := sm.loadMetrics(serverID, key)
+		if err != nil {
+			return ChainStatus{}, fmt.Errorf("failed to read metrics %s: %w", key, err)
+		}
+		computed, err := metrics.chainHash()
+		if err != nil {
+			return ChainStatus{}, err
+		}
+		entries = append(entries, chainEntry{ID: key, Link: metrics.ChainLink, Computed: computed})
+	}
+
+	return verifyChain(entries, sm.signer, pruned), nil
+}
+
+// Helper functions
+
+// chainHead returns the hash of the newest record, which a record taken at timestamp links to. Records
+// are compared by timestamp rather than key, since older keys were written in local time.
+func (hm *HistoryManager) chainHead(timestamp time.Time) (string, error) {
+	if len(hm.index) == 0 {
+		return "", nil
+	}
+
+	head := hm.index[len(hm.index)-1]
+	if head.Timestamp.After(timestamp) {
+		return "", fmt.Errorf("%w (%s)", ErrOutOfOrder, head.ID)
+	}
+	return head.Hash, nil
+}
+
+// chainHead returns the hash of a server's newest stored metrics, which metrics taken at timestamp link to
+func (sm *ServerManager) chainHead(serverID string, timestamp time.Time) (string, error) {
+	keys, err := sm.store.Keys(auditsBucket(serverID))
+	if err != nil || len(keys) == 0 {
+		return "", err
+	}
+
+	head, err := sm.loadMetrics(serverID, keys[len(keys)-1])
+	if err != nil {
+		return "", err
+	}
+	if head.Timestamp.After(timestamp) {
+		return "", fmt.Errorf("%w (%s)", ErrOutOfOrder, head.ID)
+	}
+	return head.Hash, nil
+}
+
+// chainEntry is a stored record reduced to what verification needs
+type chainEntry struct {
+	ID       string
+	Link     ChainLink
+	Computed string // Hash recomputed from the stored content
+}
+
+// verifyChain walks entries oldest first and reports every broken link
+func verifyChain(entries []chainEntry, signer *ChainSigner, pruned map[string]bool) ChainStatus {
+	status := ChainStatus{
+		Records: len(entries),
+		Breaks:  []ChainBreak{},
+	}
+
+	prevHash := ""
+	chained := false
+	for _, entry := range entries {
+		if entry.Link.Hash == "" {
+			if chained {
+				status.Breaks = append(status.Breaks, ChainBreak{ID: entry.ID, Problem: "record has no hash; it was added or rewritten outside the dashboard"})
+			} else {
+				status.Legacy++
+			}
+			prevHash = ""
+			continue
+		}
+
+		status.Chained++
+		if entry.Computed != entry.Link.Hash {
+			status.Breaks = append(status.Breaks, ChainBreak{ID: entry.ID, Problem: "content does not match its hash; the record was edited"})
+		}
+
+		// The oldest chained record may point at records removed by retention, and so may records
+		// after a gap left around a legal hold
+		switch {
+		case !chained || entry.Link.PrevHash == prevHash:
+			// Linked as expected
+		case pruned[entry.Link.PrevHash]:
+			status.Pruned++
+		default:
+			status.Breaks = append(status.Breaks, ChainBreak{ID: entry.ID, Problem: "previous hash does not match; a record before it was removed, inserted or edited"})
+		}
+
+		switch {
+		case entry.Link.Signature == "":
+			status.Unsigned++
+		case signer == nil:
+			// Signatures can't be checked without the key
+		case signer.verify(entry.Link.Hash, entry.Link.Signature):
+			status.Signed++
+		default:
+			status.Breaks = append(status.Breaks, ChainBreak{ID: entry.ID, Problem: "signature is not valid for the dashboard key"})
+		}
+
+		chained = true
+		prevHash = entry.Link.Hash
+	}
+
+	status.Head = prevHash
+	status.Valid = len(status.Breaks) == 0
+	return status
+}
+
+// hashJSON returns the SHA-256 of a value's JSON encoding, which is deterministic for structs and maps
+func hashJSON(value interface{}) (string, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// chainHash hashes a history record without its own hash, signature and compression flag, which
+// changes with storage
+func (r AuditRecord) chainHash() (string, error) {
+	r.Hash, r.Signature, r.Compressed = "", "", false
+	return hashJSON(r)
+}
+
+// chainHash hashes agent metrics without their own hash and signature
+func (m ServerMetrics) chainHash() (string, error) {
+	m.Hash, m.Signature = "", ""
+	return hashJSON(m)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestVerifyChain(t *testing.T) {
+	signer := &ChainSigner{key: ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))}
+	otherKey := make([]byte, ed25519.SeedSize)
+	otherKey[0] = 1
+	other := &ChainSigner{key: ed25519.NewKeyFromSeed(otherKey)}
+
+	// chain links n records, sealed by signer when it isn't nil
+	chain := func(n int, signer *ChainSigner) []chainEntry {
+		entries := make([]chainEntry, n)
+		prev := ""
+		for i := range entries {
+			entries[i].ID = fmt.Sprintf("audit_%d", i+1)
+			entries[i].Link.PrevHash = prev
+			signer.seal(&entries[i].Link, fmt.Sprintf("hash_%d", i+1))
+			entries[i].Computed = entries[i].Link.Hash
+			prev = entries[i].Link.Hash
+		}
+		return entries
+	}
+	legacy := func(id string) chainEntry { return chainEntry{ID: id} }
+	without := func(entries []chainEntry, i int) []chainEntry {
+		return append(append([]chainEntry{}, entries[:i]...), entries[i+1:]...)
+	}
+
+	edited := chain(3, nil)
+	edited[1].Computed = "something else"
+	pruneStart := chain(3, nil)[1:] // The first record was deleted by retention
+	legacyAfter := append(chain(2, nil), legacy("audit_3"))
+
+	tests := []struct {
+		name     string
+		entries  []chainEntry
+		signer   *ChainSigner
+		pruned   map[string]bool
+		want     ChainStatus // Breaks only by ID
+		breakIDs []string
+	}{
+		{
+			name: "empty",
+			want: ChainStatus{Valid: true},
+		},
+		{
+			name:    "intact",
+			entries: chain(3, nil),
+			want:    ChainStatus{Records: 3, Chained: 3, Unsigned: 3, Head: "hash_3", Valid: true},
+		},
+		{
+			name:    "legacy records before the chain",
+			entries: append([]chainEntry{legacy("audit_0a"), legacy("audit_0b")}, chain(2, nil)...),
+			want:    ChainStatus{Records: 4, Chained: 2, Legacy: 2, Unsigned: 2, Head: "hash_2", Valid: true},
+		},
+		{
+			name:     "record without hash after the chain",
+			entries:  legacyAfter,
+			want:     ChainStatus{Records: 3, Chained: 2, Unsigned: 2, Head: ""},
+			breakIDs: []string{"audit_3"},
+		},
+		{
+			name:     "edited record",
+			entries:  edited,
+			want:     ChainStatus{Records: 3, Chained: 3, Unsigned: 3, Head: "hash_3"},
+			breakIDs: []string{"audit_2"},
+		},
+		{
+			name:     "removed record",
+			entries:  without(chain(3, nil), 1),
+			want:     ChainStatus{Records: 2, Chained: 2, Unsigned: 2, Head: "hash_3"},
+			breakIDs: []string{"audit_3"},
+		},
+		{
+			name:    "oldest records pruned",
+			entries: pruneStart,
+			want:    ChainStatus{Records: 2, Chained: 2, Unsigned: 2, Head: "hash_3", Valid: true},
+		},
+		{
+			name:    "gap pruned around a legal hold",
+			entries: without(chain(3, nil), 1),
+			pruned:  map[string]bool{"hash_2": true},
+			want:    ChainStatus{Records: 2, Chained: 2, Unsigned: 2, Pruned: 1, Head: "hash_3", Valid: true},
+		},
+		{
+			name:    "signed",
+			entries: chain(3, signer),
+			signer:  signer,
+			want:    ChainStatus{Records: 3, Chained: 3, Signed: 3, Head: "hash_3", Valid: true},
+		},
+		{
+			name:    "signatures unchecked without the key",
+			entries: chain(3, signer),
+			want:    ChainStatus{Records: 3, Chained: 3, Head: "hash_3", Valid: true},
+		},
+		{
+			name:     "signed by another key",
+			entries:  chain(2, other),
+			signer:   signer,
+			want:     ChainStatus{Records: 2, Chained: 2, Head: "hash_2"},
+			breakIDs: []string{"audit_1", "audit_2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := verifyChain(tt.entries, tt.signer, tt.pruned)
+
+			var ids []string
+			for _, b := range got.Breaks {
+				ids = append(ids, b.ID)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tt.breakIDs) {
+				t.Errorf("breaks = %+v, want %v", got.Breaks, tt.breakIDs)
+			}
+
+			got.Breaks = nil
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("verifyChain() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChainRefusesOutOfOrderAudits(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := OpenDBStorage(t.TempDir() + "/dashboard.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	hm, err := NewHistoryManager(store, localServerID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm := NewServerManager(store, nil)
+	server, err := sm.RegisterServer("web-1", "10.0.0.5", "Ubuntu 22.04", "amd64", "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Date(2026, 5, 4, 10, 0, 0, 0, time.UTC)
+	data := map[string]string{"hardening_index": "60"}
+	steps := []struct {
+		name       string
+		at         time.Time
+		outOfOrder bool
+	}{
+		{"first", base, false},
+		{"later", base.Add(time.Hour), false},
+		{"same second", base.Add(time.Hour + 500*time.Millisecond), false},
+		{"same timestamp", base.Add(time.Hour + 500*time.Millisecond), false},
+		{"earlier than the newest", base.Add(30 * time.Minute), true},
+		{"same second as an older audit", base, true},
+
+		// Clocks go back from 03:00 CEST to 02:00 CET on 25 October, so 02:20 CET is after 02:50 CEST
+		{"before dst ends", time.Date(2026, 10, 25, 2, 50, 0, 0, berlin), false},
+		{"after dst ends", time.Date(2026, 10, 25, 2, 50, 0, 0, berlin).Add(30 * time.Minute), false},
+	}
+	for _, step := range steps {
+		_, err := hm.SaveAudit(data, analyzeCompliance(data), step.at)
+		if errors.Is(err, ErrOutOfOrder) != step.outOfOrder || (err != nil && !step.outOfOrder) {
+			t.Errorf("%s: SaveAudit() error = %v, want out of order: %v", step.name, err, step.outOfOrder)
+		}
+
+		err = sm.SaveMetrics(&ServerMetrics{ServerID: server.ID, Timestamp: step.at, RawData: data})
+		if errors.Is(err, ErrOutOfOrder) != step.outOfOrder || (err != nil && !step.outOfOrder) {
+			t.Errorf("%s: SaveMetrics() error = %v, want out of order: %v", step.name, err, step.outOfOrder)
+		}
+	}
+
+	status, err := hm.VerifyChain(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Valid || status.Records != 6 {
+		t.Errorf("history VerifyChain() = %+v, want 6 valid records", status)
+	}
+
+	status, err = sm.VerifyChain(server.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Valid || status.Records != 6 {
+		t.Errorf("metrics VerifyChain() = %+v, want 6 valid records", status)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // Time zones work even where the system has no zoneinfo
+)
+
+// CronSchedule is a parsed cron expression: minute, hour, day of month, month and day of week,
+// optionally followed by a time zone, e.g. "30 2 * * 1-5 Europe/Berlin". Descriptors such as
+// @daily and a CRON_TZ= prefix are accepted too.
+type CronSchedule struct {
+	Expr     string
+	Location *time.Location
+
+	minute, hour, dom, month, dow uint64 // Bit n set when value n matches
+	domAny, dowAny                bool   // Unrestricted fields, for the day matching rule
+}
+
+// cronField describes the range and names of one cron field
+type cronField struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	cronMinute = cronField{name: "minute", min: 0, max: 59}
+	cronHour   = cronField{name: "hour", min: 0, max: 23}
+	cronDom    = cronField{name: "day of month", min: 1, max: 31}
+	cronMonth  = cronField{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	cronDow = cronField{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+
+	cronDescriptors = map[string]string{
+		"@yearly":   "0 0 1 1 *",
+		"@annually": "0 0 1 1 *",
+		"@monthly":  "0 0 1 * *",
+		"@weekly":   "0 0 * * 0",
+		"@daily":    "0 0 * * *",
+		"@midnight": "0 0 * * *",
+		"@hourly":   "0 * * * *",
+	}
+)
+
+// ParseCron parses a cron expression with an optional time zone; without one the local zone is used
+func ParseCron(expr string) (*CronSchedule, error) {
+	fields := strings.Fields(expr)
+	schedule := &CronSchedule{Expr: strings.Join(fields, " "), Location: time.Local}
+
+	// The zone is either a CRON_TZ=/TZ= prefix or a trailing IANA name
+	if len(fields) > 0 {
+		for _, prefix := range []string{"CRON_TZ=", "TZ="} {
+			if strings.HasPrefix(fields[0], prefix) {
+				location, err := time.LoadLocation(strings.TrimPrefix(fields[0], prefix))
+				if err != nil {
+					return nil, fmt.Errorf("unknown time zone in %q: %w", expr, err)
+				}
+				schedule.Location = location
+				fields = fields[1:]
+				break
+			}
+		}
+	}
+	if len(fields) > 0 && strings.HasPrefix(fields[0], "@") {
+		spec, ok := cronDescriptors[strings.ToLower(fields[0])]
+		if !ok {
+			return nil, fmt.Errorf("unknown cron descriptor %q", fields[0])
+		}
+		fields = append(strings.Fields(spec), fields[1:]...)
+	}
+	if len(fields) == 6 {
+		location, err := time.LoadLocation(fields[5])
+		if err != nil {
+			return nil, fmt.Errorf("unknown time zone %q: %w", fields[5], err)
+		}
+		schedule.Location = location
+		fields = fields[:5]
+	}
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q needs 5 fields (minute hour day-of-month month day-of-week) and an optional time zone", expr)
+	}
+
+	var err error
+	if schedule.minute, err = parseCronField(fields[0], cronMinute); err != nil {
+		return nil, err
+	}
+	if schedule.hour, err = parseCronField(fields[1], cronHour); err != nil {
+		return nil, err
+	}
+	if schedule.dom, err = parseCronField(fields[2], cronDom); err != nil {
+		return nil, err
+	}
+	if schedule.month, err = parseCronField(fields[3], cronMonth); err != nil {
+		return nil, err
+	}
+	if schedule.dow, err = parseCronField(fields[4], cronDow); err != nil {
+		return nil, err
+	}
+
+	// 7 is another name for Sunday
+	if schedule.dow&(1<<7) != 0 {
+		schedule.dow |= 1
+	}
+	schedule.domAny = fields[2] == "*" || fields[2] == "?"
+	schedule.dowAny = fields[4] == "*" || fields[4] == "?"
+
+	return schedule, nil
+}
+
+// Next returns the first time after t the schedule fires, or the zero time if it never does (e.g. 30 Feb).
+// Wall-clock times repeated when DST ends only fire once.
+func (c *CronSchedule) Next(t time.Time) time.Time {
+	start := cronWallClock(t.In(c.Location))
+	for {
+		t = c.next(t)
+		if t.IsZero() || cronWallClock(t).After(start) {
+			return t
+		}
+	}
+}
+
+func (c *CronSchedule) next(t time.Time) time.Time {
+	t = t.In(c.Location).Truncate(time.Minute).Add(time.Minute)
+	yearLimit := t.Year() + 5
+
+	// Advance the largest mismatching field, resetting the smaller ones, until everything matches.
+	// Days are stepped by date rather than 24h so DST changes don't shift the hour.
+wrap:
+	if t.Year() > yearLimit {
+		return time.Time{}
+	}
+
+	for c.month&(1<<uint(t.Month())) == 0 {
+		t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, c.Location)
+		if t.Month() == time.January {
+			goto wrap
+		}
+	}
+
+	for !c.dayMatches(t) {
+		t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, c.Location)
+		if t.Day() == 1 {
+			goto wrap
+		}
+	}
+
+	for c.hour&(1<<uint(t.Hour())) == 0 {
+		next := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, c.Location).Add(time.Hour)
+		if next.Day() != t.Day() {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, c.Location)
+			goto wrap
+		}
+		t = next
+	}
+
+	for c.minute&(1<<uint(t.Minute())) == 0 {
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto wrap
+		}
+	}
+
+	return t
+}
+
+// String returns the expression as given
+func (c *CronSchedule) String() string {
+	return c.Expr
+}
+
+// dayMatches applies the cron rule that a restricted day of month and day of week match either way
+func (c *CronSchedule) dayMatches(t time.Time) bool {
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// cronWallClock returns the local date and time of t, ignoring its offset
+func cronWallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+}
+
+// parseCronField parses a comma-separated list of *, values, ranges and steps such as */15 or 1-5/2
+func parseCronField(value string, field cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(value, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			rangePart = part[:i]
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %s field %q", field.name, part)
+			}
+		}
+
+		var low, high int
+		switch {
+		case rangePart == "*" || rangePart == "?":
+			low, high = field.min, field.max
+			if field.name == cronDow.name {
+				high = 6
+			}
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if low, err = field.parseValue(bounds[0]); err != nil {
+				return 0, err
+			}
+			if high, err = field.parseValue(bounds[1]); err != nil {
+				return 0, err
+			}
+			if high < low {
+				return 0, fmt.Errorf("invalid range in %s field %q", field.name, part)
+			}
+		default:
+			var err error
+			if low, err = field.parseValue(rangePart); err != nil {
+				return 0, err
+			}
+			high = low
+			// "5/10" means from 5 to the end in steps of 10
+			if strings.Contains(part, "/") {
+				high = field.max
+			}
+		}
+
+		for v := low; v <= high; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (field cronField) parseValue(value string) (int, error) {
+	if n, ok := field.names[strings.ToLower(value)]; ok {
+		return n, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < field.min || n > field.max {
+		return 0, fmt.Errorf("invalid %s %q (expected %d-%d)", field.name, value, field.min, field.max)
+	}
+	return n, nil
+}
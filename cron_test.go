@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+	}{
+		{"too few fields", "0 2 * *"},
+		{"too many fields", "0 2 * * * UTC extra"},
+		{"minute out of range", "60 2 * * *"},
+		{"day of month zero", "0 2 0 * *"},
+		{"backwards range", "0 5-1 * * *"},
+		{"zero step", "*/0 * * * *"},
+		{"unknown name", "0 2 * foo *"},
+		{"unknown descriptor", "@fortnightly"},
+		{"unknown trailing zone", "0 2 * * * Mars/Olympus_Mons"},
+		{"unknown prefix zone", "CRON_TZ=Nowhere 0 2 * * *"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseCron(tt.expr); err == nil {
+				t.Errorf("ParseCron(%q) succeeded, want an error", tt.expr)
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time // Zero when the schedule never fires
+	}{
+		{"every minute", "* * * * * UTC", time.Date(2026, 5, 1, 10, 0, 30, 0, time.UTC), time.Date(2026, 5, 1, 10, 1, 0, 0, time.UTC)},
+		{"strictly after from", "0 2 * * * UTC", time.Date(2026, 5, 1, 2, 0, 0, 0, time.UTC), time.Date(2026, 5, 2, 2, 0, 0, 0, time.UTC)},
+		{"steps", "*/15 * * * * UTC", time.Date(2026, 5, 1, 10, 16, 0, 0, time.UTC), time.Date(2026, 5, 1, 10, 30, 0, 0, time.UTC)},
+		{"month names", "0 0 1 jun * UTC", time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{"descriptor", "@weekly UTC", time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 5, 3, 0, 0, 0, 0, time.UTC)},
+		{"7 is sunday", "0 0 * * 7 UTC", time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 5, 3, 0, 0, 0, 0, time.UTC)},
+		{"year wrap", "0 0 1 1 * UTC", time.Date(2026, 12, 31, 23, 59, 0, 0, time.UTC), time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"leap day", "0 0 29 2 * UTC", time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"never fires", "0 0 30 2 * UTC", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), time.Time{}},
+
+		// A trailing zone or CRON_TZ= prefix sets the zone the fields are read in
+		{"trailing zone", "0 9 * * * Asia/Tokyo", time.Date(2025, 12, 31, 23, 0, 0, 0, time.UTC), time.Date(2026, 1, 1, 9, 0, 0, 0, tokyo)},
+		{"prefix zone", "CRON_TZ=Asia/Tokyo 0 9 * * *", time.Date(2025, 12, 31, 23, 0, 0, 0, time.UTC), time.Date(2026, 1, 1, 9, 0, 0, 0, tokyo)},
+		{"descriptor with zone", "@daily America/New_York", time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC), time.Date(2026, 5, 2, 0, 0, 0, 0, newYork)},
+
+		// Restricted day of month and day of week match either way; otherwise both must match
+		{"dom or dow, weekday first", "0 0 1 * 1 UTC", time.Date(2026, 2, 3, 0, 0, 0, 0, time.UTC), time.Date(2026, 2, 9, 0, 0, 0, 0, time.UTC)},
+		{"dom or dow, date first", "0 0 13 * 5 UTC", time.Date(2026, 3, 7, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 13, 0, 0, 0, 0, time.UTC)},
+		{"dow only", "0 0 * * 1 UTC", time.Date(2026, 2, 3, 0, 0, 0, 0, time.UTC), time.Date(2026, 2, 9, 0, 0, 0, 0, time.UTC)},
+		{"dom only", "0 0 1 * * UTC", time.Date(2026, 2, 3, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"dom with dow wildcard", "0 0 1 * ? UTC", time.Date(2026, 2, 3, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)},
+
+		// 02:30 doesn't exist when DST starts on 8 March, so that day is skipped
+		{"dst gap", "30 2 * * * America/New_York", time.Date(2026, 3, 8, 0, 0, 0, 0, newYork), time.Date(2026, 3, 9, 2, 30, 0, 0, newYork)},
+		{"hour after dst gap", "0 3 * * * America/New_York", time.Date(2026, 3, 8, 0, 0, 0, 0, newYork), time.Date(2026, 3, 8, 3, 0, 0, 0, newYork)},
+
+		// 01:30 happens twice when DST ends on 1 November, but fires only the first time
+		{"dst overlap first", "30 1 * * * America/New_York", time.Date(2026, 11, 1, 0, 0, 0, 0, newYork), time.Date(2026, 11, 1, 5, 30, 0, 0, time.UTC)},
+		{"dst overlap repeat", "30 1 * * * America/New_York", time.Date(2026, 11, 1, 5, 30, 0, 0, time.UTC), time.Date(2026, 11, 2, 1, 30, 0, 0, newYork)},
+		{"dst overlap steps", "*/30 * * * * America/New_York", time.Date(2026, 11, 1, 5, 45, 0, 0, time.UTC), time.Date(2026, 11, 1, 2, 0, 0, 0, newYork)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseCron(%q): %v", tt.expr, err)
+			}
+
+			got := schedule.Next(tt.from)
+			if !got.Equal(tt.want) {
+				t.Errorf("Next(%s) = %s, want %s", tt.from, got, tt.want)
+			}
+			if !got.IsZero() && got.Location() != schedule.Location {
+				t.Errorf("Next(%s) is in %s, want %s", tt.from, got.Location(), schedule.Location)
+			}
+		})
+	}
+}
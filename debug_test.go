@@ -1,3 +1,7 @@
+//go:build ignore
+
+// A scratch program printing compliance scores; build tagged so it doesn't clash with main during go test.
+
 package main
 
 import (
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrNoEarlierAudit is returned when diffing the first audit of a server against its predecessor
+var ErrNoEarlierAudit = errors.New("no earlier audit to compare with")
+
+// AuditRef identifies one side of a diff
+type AuditRef struct {
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ScoreChange is a before/after pair of scores
+type ScoreChange struct {
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+	Delta float64 `json:"delta"`
+}
+
+// FieldChange is a report field whose value differs between audits
+type FieldChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// ControlChange is a compliance control whose status differs between audits
+type ControlChange struct {
+	Framework string `json:"framework"`
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	Severity  string `json:"severity"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+}
+
+// AuditDiff describes everything that changed between two audits
+type AuditDiff struct {
+	ServerID           string                 `json:"server_id"`
+	From               AuditRef               `json:"from"`
+	To                 AuditRef               `json:"to"`
+	HardeningIndex     ScoreChange            `json:"hardening_index"`
+	Warnings           ScoreChange            `json:"warnings"`
+	Frameworks         map[string]ScoreChange `json:"frameworks"`
+	AddedWarnings      []string               `json:"added_warnings"`
+	RemovedWarnings    []string               `json:"removed_warnings"`
+	AddedSuggestions   []string               `json:"added_suggestions"`
+	RemovedSuggestions []string               `json:"removed_suggestions"`
+	AddedFindings      []SecurityFinding      `json:"added_findings"`
+	ResolvedFindings   []SecurityFinding      `json:"resolved_findings"`
+	ChangedFields      []FieldChange          `json:"changed_fields"`
+	ControlChanges     []ControlChange        `json:"control_changes"`
+}
+
+// Fields that change on every run and would only add noise to a diff
+var volatileReportFields = map[string]bool{
+	"report_datetime_start":  true,
+	"report_datetime_end":    true,
+	"report_version_major":   true,
+	"report_version_minor":   true,
+	"lynis_update_available": true,
+	"uptime_in_seconds":      true,
+	"uptime_in_days":         true,
+}
+
+// diffReports compares two raw reports
+func diffReports(from, to map[string]string) AuditDiff {
+	diff := AuditDiff{
+		HardeningIndex: scoreChange(parseFloat(from["hardening_index"]), parseFloat(to["hardening_index"])),
+		Warnings:       scoreChange(float64(len(reportArray(from, "warning"))), float64(len(reportArray(to, "warning")))),
+		Frameworks:     make(map[string]ScoreChange),
+		ChangedFields:  []FieldChange{},
+		ControlChanges: []ControlChange{},
+	}
+
+	diff.AddedWarnings, diff.RemovedWarnings = diffEntries(reportArray(from, "warning"), reportArray(to, "warning"))
+	diff.AddedSuggestions, diff.RemovedSuggestions = diffEntries(reportArray(from, "suggestion"), reportArray(to, "suggestion"))
+
+	// Findings, including the dashboard's built-in checks
+	fromFindings := extractSecurityFindings(from)
+	toFindings := extractSecurityFindings(to)
+	diff.AddedFindings = subtractFindings(toFindings, fromFindings)
+	diff.ResolvedFindings = subtractFindings(fromFindings, toFindings)
+
+	// Plain report fields; arrays are covered above
+	fields := make(map[string]bool)
+	for key := range from {
+		fields[key] = true
+	}
+	for key := range to {
+		fields[key] = true
+	}
+	for field := range fields {
+		if strings.HasSuffix(field, "[]") || volatileReportFields[field] || from[field] == to[field] {
+			continue
+		}
+		diff.ChangedFields = append(diff.ChangedFields, FieldChange{Field: field, From: from[field], To: to[field]})
+	}
+	sort.Slice(diff.ChangedFields, func(i, j int) bool {
+		return diff.ChangedFields[i].Field < diff.ChangedFields[j].Field
+	})
+
+	// Control status transitions per framework
+	fromProfiles := analyzeCompliance(from).Profiles()
+	for framework, profile := range analyzeCompliance(to).Profiles() {
+		previous := fromProfiles[framework]
+		diff.Frameworks[framework] = scoreChange(previous.Score, profile.Score)
+
+		for id, control := range profile.Controls {
+			before := previous.Controls[id].Status
+			if before == control.Status {
+				continue
+			}
+			if before == "" {
+				before = "absent"
+			}
+			diff.ControlChanges = append(diff.ControlChanges, ControlChange{
+				Framework: framework,
+				ID:        id,
+				Title:     control.Title,
+				Severity:  control.Severity,
+				From:      before,
+				To:        control.Status,
+			})
+		}
+	}
+	sort.Slice(diff.ControlChanges, func(i, j int) bool {
+		if diff.ControlChanges[i].Framework != diff.ControlChanges[j].Framework {
+			return diff.ControlChanges[i].Framework < diff.ControlChanges[j].Framework
+		}
+		return diff.ControlChanges[i].ID < diff.ControlChanges[j].ID
+	})
+
+	return diff
+}
+
+func scoreChange(from, to float64) ScoreChange {
+	return ScoreChange{
+		From:  from,
+		To:    to,
+		Delta: math.Round((to-from)*10) / 10,
+	}
+}
+
+// diffEntries returns warning or suggestion entries only present in "to" (added) or "from" (removed)
+func diffEntries(from, to []string) (added, removed []string) {
+	fromSet := make(map[string]bool)
+	for _, entry := range from {
+		fromSet[normalizeReportEntry(entry)] = true
+	}
+	toSet := make(map[string]bool)
+	for _, entry := range to {
+		toSet[normalizeReportEntry(entry)] = true
+	}
+
+	added = []string{}
+	for entry := range toSet {
+		if !fromSet[entry] {
+			added = append(added, entry)
+		}
+	}
+	removed = []string{}
+	for entry := range fromSet {
+		if !toSet[entry] {
+			removed = append(removed, entry)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// normalizeReportEntry keeps the test ID and text of "TEST-ID|text|details|solution|"
+func normalizeReportEntry(entry string) string {
+	parts := strings.Split(entry, "|")
+	if len(parts) > 2 {
+		parts = parts[:2]
+	}
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	return strings.Join(parts, "|")
+}
+
+func subtractFindings(findings, other []SecurityFinding) []SecurityFinding {
+	present := make(map[string]bool)
+	for _, finding := range other {
+		present[finding.ID] = true
+	}
+
+	result := []SecurityFinding{}
+	for _, finding := range findings {
+		if !present[finding.ID] {
+			result = append(result, finding)
+		}
+	}
+	return result
+}
+
+// DiffRecords compares two history records of the server. An empty toID means the latest
+// record and an empty fromID the record before "to".
+func (hm *HistoryManager) DiffRecords(fromID, toID string) (*AuditDiff, error) {
+	fromID, toID, err := hm.resolveDiffIDs(fromID, toID)
+	if err != nil {
+		return nil, err
+	}
+
+	fromRecord, fromData, err := hm.GetFullReport(fromID)
+	if err != nil {
+		return nil, err
+	}
+	toRecord, toData, err := hm.GetFullReport(toID)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := diffReports(fromData, toData)
+	diff.ServerID = hm.serverID
+	diff.From = AuditRef{ID: fromRecord.ID, Timestamp: fromRecord.Timestamp}
+	diff.To = AuditRef{ID: toRecord.ID, Timestamp: toRecord.Timestamp}
+	return &diff, nil
+}
+
+func (hm *HistoryManager) resolveDiffIDs(fromID, toID string) (string, string, error) {
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+
+	keys := make([]string, len(hm.index))
+	for i, record := range hm.index {
+		keys[i] = record.ID
+	}
+
+	return resolveDiffKeys(keys, fromID, toID)
+}
+
+// resolveDiffKeys fills in default diff endpoints from chronologically sorted keys
+func resolveDiffKeys(keys []string, fromID, toID string) (string, string, error) {
+	position := -1
+	if toID == "" {
+		if len(keys) == 0 {
+			return "", "", fmt.Errorf("no audits recorded yet")
+		}
+		position = len(keys) - 1
+		toID = keys[position]
+	} else {
+		for i, key := range keys {
+			if key == toID {
+				position = i
+				break
+			}
+		}
+		if position < 0 {
+			return "", "", fmt.Errorf("audit %s not found", toID)
+		}
+	}
+
+	if fromID == "" {
+		if position == 0 {
+			return "", "", fmt.Errorf("audit %s has %w", toID, ErrNoEarlierAudit)
+		}
+		fromID = keys[position-1]
+	}
+
+	return fromID, toID, nil
+}
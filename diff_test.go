@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestDiffReports(t *testing.T) {
+	base := map[string]string{
+		"hostname":              "web-1",
+		"hardening_index":       "62",
+		"firewall_status":       "disabled",
+		"ssh_daemon_options":    "PermitRootLogin no",
+		"report_datetime_start": "2026-05-01 10:00:00",
+		"warning[]":             "SSH-7408|Root login allowed|-|-|\nFIRE-4512|Firewall inactive|-|-|",
+		"suggestion[]":          "PKGS-7370|Install debsums|-|-|",
+	}
+	with := func(changes map[string]string) map[string]string {
+		report := make(map[string]string, len(base))
+		for key, value := range base {
+			report[key] = value
+		}
+		for key, value := range changes {
+			report[key] = value
+		}
+		return report
+	}
+
+	tests := []struct {
+		name               string
+		to                 map[string]string
+		hardeningDelta     float64
+		warningsDelta      float64
+		addedWarnings      []string
+		removedWarnings    []string
+		addedSuggestions   []string
+		removedSuggestions []string
+		changedFields      []string
+		resolvedFindings   []string
+		addedFindings      []string
+		controlChanges     bool
+	}{
+		{
+			name: "identical",
+			to:   with(nil),
+		},
+		{
+			name:          "volatile fields are ignored",
+			to:            with(map[string]string{"report_datetime_start": "2026-05-02 10:00:00", "hostname": "web-2"}),
+			changedFields: []string{"hostname"},
+		},
+		{
+			name:           "score change",
+			to:             with(map[string]string{"hardening_index": "70.5"}),
+			hardeningDelta: 8.5,
+			changedFields:  []string{"hardening_index"},
+		},
+		{
+			name: "entries compare on test ID and text only",
+			to:   with(map[string]string{"warning[]": "SSH-7408|Root login allowed|details changed|-|\nFIRE-4512|Firewall inactive|-|-|"}),
+		},
+		{
+			name:             "entries added and removed",
+			to:               with(map[string]string{"warning[]": "SSH-7408|Root login allowed|-|-|", "suggestion[]": "PKGS-7370|Install debsums|-|-|\nAUTH-9230|Configure password hashing rounds|-|-|"}),
+			warningsDelta:    -1,
+			removedWarnings:  []string{"FIRE-4512|Firewall inactive"},
+			addedSuggestions: []string{"AUTH-9230|Configure password hashing rounds"},
+			resolvedFindings: []string{"FIRE-4512"}, // Report entries are findings too
+			addedFindings:    []string{"AUTH-9230"},
+		},
+		{
+			name:             "finding resolved",
+			to:               with(map[string]string{"firewall_status": "active"}),
+			changedFields:    []string{"firewall_status"},
+			resolvedFindings: []string{"NET-001"},
+			controlChanges:   true,
+		},
+		{
+			name:           "finding added",
+			to:             with(map[string]string{"ssh_daemon_options": "PermitRootLogin yes"}),
+			changedFields:  []string{"ssh_daemon_options"},
+			addedFindings:  []string{"SSH-001"},
+			controlChanges: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := diffReports(base, tt.to)
+
+			if diff.HardeningIndex.Delta != tt.hardeningDelta {
+				t.Errorf("hardening delta = %v, want %v", diff.HardeningIndex.Delta, tt.hardeningDelta)
+			}
+			if diff.Warnings.Delta != tt.warningsDelta {
+				t.Errorf("warnings delta = %v, want %v", diff.Warnings.Delta, tt.warningsDelta)
+			}
+			checkStrings(t, "added warnings", diff.AddedWarnings, tt.addedWarnings)
+			checkStrings(t, "removed warnings", diff.RemovedWarnings, tt.removedWarnings)
+			checkStrings(t, "added suggestions", diff.AddedSuggestions, tt.addedSuggestions)
+			checkStrings(t, "removed suggestions", diff.RemovedSuggestions, tt.removedSuggestions)
+
+			fields := []string{}
+			for _, change := range diff.ChangedFields {
+				fields = append(fields, change.Field)
+			}
+			checkStrings(t, "changed fields", fields, tt.changedFields)
+			checkStrings(t, "resolved findings", findingIDs(diff.ResolvedFindings), tt.resolvedFindings)
+			checkStrings(t, "added findings", findingIDs(diff.AddedFindings), tt.addedFindings)
+
+			if got := len(diff.ControlChanges) > 0; got != tt.controlChanges {
+				t.Errorf("control changes = %v, want changes: %v", diff.ControlChanges, tt.controlChanges)
+			}
+			if !sort.SliceIsSorted(diff.ControlChanges, func(i, j int) bool {
+				a, b := diff.ControlChanges[i], diff.ControlChanges[j]
+				return a.Framework < b.Framework || (a.Framework == b.Framework && a.ID < b.ID)
+			}) {
+				t.Errorf("control changes are not sorted: %v", diff.ControlChanges)
+			}
+			for framework, change := range diff.Frameworks {
+				if !tt.controlChanges && change.Delta != 0 {
+					t.Errorf("%s score changed by %v without control changes", framework, change.Delta)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveDiffKeys(t *testing.T) {
+	keys := []string{"audit_1", "audit_2", "audit_3"}
+
+	tests := []struct {
+		name          string
+		keys          []string
+		from, to      string
+		wantFrom      string
+		wantTo        string
+		wantErr       bool
+		wantNoEarlier bool
+	}{
+		{name: "newest against previous", keys: keys, wantFrom: "audit_2", wantTo: "audit_3"},
+		{name: "given audit against previous", keys: keys, to: "audit_2", wantFrom: "audit_1", wantTo: "audit_2"},
+		{name: "both given", keys: keys, from: "audit_1", to: "audit_3", wantFrom: "audit_1", wantTo: "audit_3"},
+		{name: "first audit", keys: keys, to: "audit_1", wantErr: true, wantNoEarlier: true},
+		{name: "single audit", keys: keys[:1], wantErr: true, wantNoEarlier: true},
+		{name: "unknown audit", keys: keys, to: "audit_9", wantErr: true},
+		{name: "no audits", keys: nil, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to, err := resolveDiffKeys(tt.keys, tt.from, tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveDiffKeys() error = %v, want error: %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrNoEarlierAudit) != tt.wantNoEarlier {
+				t.Errorf("resolveDiffKeys() error = %v, want ErrNoEarlierAudit: %v", err, tt.wantNoEarlier)
+			}
+			if from != tt.wantFrom || to != tt.wantTo {
+				t.Errorf("resolveDiffKeys() = %s, %s, want %s, %s", from, to, tt.wantFrom, tt.wantTo)
+			}
+		})
+	}
+}
+
+// checkStrings compares a result list with the expected one; a nil want expects an empty list
+func checkStrings(t *testing.T, what string, got, want []string) {
+	t.Helper()
+	if want == nil {
+		want = []string{}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s = %q, want %q", what, got, want)
+	}
+}
+
+func findingIDs(findings []SecurityFinding) []string {
+	ids := []string{}
+	for _, finding := range findings {
+		ids = append(ids, finding.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
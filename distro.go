@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DistroInfo identifies the Linux distribution a remediation targets
+type DistroInfo struct {
+	ID      string `json:"id"`      // e.g. ubuntu, rocky
+	Family  string `json:"family"`  // debian, rhel, suse, arch or unknown
+	Version string `json:"version"` // e.g. 22.04, 9.3
+}
+
+// String returns a human readable description of the distribution
+func (d DistroInfo) String() string {
+	if d.ID == "" {
+		return "unknown distribution"
+	}
+	if d.Version == "" {
+		return fmt.Sprintf("%s (%s family)", d.ID, d.Family)
+	}
+	return fmt.Sprintf("%s %s (%s family)", d.ID, d.Version, d.Family)
+}
+
+// distroFamilies maps distribution IDs to the family their tooling follows
+var distroFamilies = map[string]string{
+	"ubuntu":    "debian",
+	"debian":    "debian",
+	"linuxmint": "debian",
+	"pop":       "debian",
+	"kali":      "debian",
+	"raspbian":  "debian",
+	"rhel":      "rhel",
+	"redhat":    "rhel",
+	"centos":    "rhel",
+	"rocky":     "rhel",
+	"almalinux": "rhel",
+	"fedora":    "rhel",
+	"ol":        "rhel",
+	"oracle":    "rhel",
+	"amzn":      "rhel",
+	"amazon":    "rhel",
+	"sles":      "suse",
+	"suse":      "suse",
+	"opensuse":  "suse",
+	"arch":      "arch",
+	"manjaro":   "arch",
+}
+
+// detectDistro works out the distribution from report data, falling back to the agent-reported OS
+func detectDistro(data map[string]string, agentOS string) DistroInfo {
+	var distro DistroInfo
+
+	// Agents add /etc/os-release values, which are the most precise
+	if id := data["os_release_id"]; id != "" {
+		distro.ID = normalizeDistroID(id)
+		distro.Version = data["os_release_version_id"]
+		distro.Family = distroFamily(distro.ID, data["os_release_id_like"])
+		return distro
+	}
+
+	// Lynis reports os=Linux, os_name=Ubuntu, os_version=22.04
+	name := data["os_name"]
+	if name == "" {
+		name = data["os_fullname"]
+	}
+	if name != "" && !strings.EqualFold(name, "linux") {
+		distro.ID = normalizeDistroID(name)
+		distro.Version = data["os_version"]
+		distro.Family = distroFamily(distro.ID, "")
+		return distro
+	}
+
+	// Registered agents report e.g. "ubuntu 22.04"
+	if fields := strings.Fields(agentOS); len(fields) > 0 && !strings.EqualFold(fields[0], "linux") {
+		distro.ID = normalizeDistroID(fields[0])
+		if len(fields) > 1 {
+			distro.Version = fields[1]
+		}
+		distro.Family = distroFamily(distro.ID, "")
+		return distro
+	}
+
+	distro.Family = "unknown"
+	return distro
+}
+
+// normalizeDistroID turns names like "Red Hat Enterprise Linux" or "Rocky Linux" into an ID
+func normalizeDistroID(name string) string {
+	name = strings.ToLower(strings.Trim(name, `"`))
+
+	switch {
+	case strings.HasPrefix(name, "red hat"):
+		return "rhel"
+	case strings.HasPrefix(name, "opensuse"):
+		return "opensuse"
+	case strings.HasPrefix(name, "amazon"):
+		return "amzn"
+	}
+
+	if fields := strings.Fields(name); len(fields) > 0 {
+		return fields[0]
+	}
+	return name
+}
+
+func distroFamily(id, idLike string) string {
+	if family, ok := distroFamilies[id]; ok {
+		return family
+	}
+
+	// ID_LIKE lists parent distributions, e.g. "rhel centos fedora"
+	for _, like := range strings.Fields(strings.Trim(idLike, `"`)) {
+		if family, ok := distroFamilies[like]; ok {
+			return family
+		}
+	}
+
+	return "unknown"
+}
+
+// compareVersions compares dotted version strings numerically (-1, 0 or 1)
+func compareVersions(a, b string) int {
+	partsA := strings.Split(a, ".")
+	partsB := strings.Split(b, ".")
+
+	for i := 0; i < len(partsA) || i < len(partsB); i++ {
+		var numA, numB int
+		if i < len(partsA) {
+			numA, _ = strconv.Atoi(partsA[i])
+		}
+		if i < len(partsB) {
+			numB, _ = strconv.Atoi(partsB[i])
+		}
+
+		if numA < numB {
+			return -1
+		}
+		if numA > numB {
+			return 1
+		}
+	}
+
+	return 0
+}
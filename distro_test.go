@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"22.04", "22.04", 0},
+		{"22.04", "20.04", 1},
+		{"20.04", "22.04", -1},
+		{"9.10", "9.9", 1}, // Numeric, not lexical
+		{"9", "9.0", 0},    // Missing components count as zero
+		{"9", "9.1", -1},
+		{"10", "9.99", 1},
+		{"", "0", 0},
+		{"8.x", "8.0", 0}, // Non-numeric components count as zero
+	}
+
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FindingRecord tracks the lifecycle of one finding on one server
+type FindingRecord struct {
+	ServerID      string     `json:"server_id"`
+	FindingID     string     `json:"finding_id"`
+	Title         string     `json:"title"`
+	Severity      string     `json:"severity"`
+	Category      string     `json:"category"`
+	Remediation   string     `json:"remediation"`
+	Status        string     `json:"status"` // open, acknowledged, resolved, reopened
+	Assignee      string     `json:"assignee"`
+	FirstSeen     time.Time  `json:"first_seen"`
+	LastSeen      time.Time  `json:"last_seen"`
+	ResolvedAt    *time.Time `json:"resolved_at,omitempty"`
+	ReopenedCount int        `json:"reopened_count"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+
+	// Computed per request, not persisted
+	RiskScore   float64      `json:"risk_score,omitempty"`
+	RiskFactors []RiskFactor `json:"risk_factors,omitempty"`
+}
+
+// FindingsFilter narrows down a findings query
+type FindingsFilter struct {
+	ServerID string
+	Status   string
+	Severity string
+	Assignee string
+}
+
+// FindingsStore persists finding lifecycles per server
+type FindingsStore struct {
+	store Storage
+	mu    sync.RWMutex
+}
+
+// NewFindingsStore creates a new findings store on top of the given storage
+func NewFindingsStore(store Storage) *FindingsStore {
+	return &FindingsStore{
+		store: store,
+	}
+}
+
+// ProcessAudit updates finding lifecycles from the findings of a new audit
+func (fs *FindingsStore) ProcessAudit(serverID string, findings []SecurityFinding, auditTime time.Time) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if auditTime.IsZero() {
+		auditTime = time.Now()
+	}
+
+	records, err := fs.load(serverID)
+	if err != nil {
+		return err
+	}
+
+	current := make(map[string]bool)
+	for _, finding := range findings {
+		current[finding.ID] = true
+
+		record, exists := records[finding.ID]
+		if !exists {
+			records[finding.ID] = &FindingRecord{
+				ServerID:    serverID,
+				FindingID:   finding.ID,
+				Title:       finding.Title,
+				Severity:    finding.Severity,
+				Category:    finding.Category,
+				Remediation: finding.Remediation,
+				Status:      "open",
+				FirstSeen:   auditTime,
+				LastSeen:    auditTime,
+				UpdatedAt:   time.Now(),
+			}
+			continue
+		}
+
+		// Audits can arrive out of order (e.g. delayed agent submissions)
+		if auditTime.Before(record.LastSeen) {
+			continue
+		}
+
+		record.Title = finding.Title
+		record.Severity = finding.Severity
+		record.Category = finding.Category
+		record.Remediation = finding.Remediation
+		record.LastSeen = auditTime
+		record.UpdatedAt = time.Now()
+
+		if record.Status == "resolved" {
+			record.Status = "reopened"
+			record.ReopenedCount++
+			record.ResolvedAt = nil
+		}
+	}
+
+	// Anything no longer reported has been fixed
+	for id, record := range records {
+		if current[id] || record.Status == "resolved" || auditTime.Before(record.LastSeen) {
+			continue
+		}
+
+		resolvedAt := auditTime
+		record.Status = "resolved"
+		record.ResolvedAt = &resolvedAt
+		record.UpdatedAt = time.Now()
+	}
+
+	return fs.save(serverID, records)
+}
+
+// Query returns finding records matching the filter, most recently seen first
+func (fs *FindingsStore) Query(filter FindingsFilter) ([]*FindingRecord, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	serverIDs := []string{filter.ServerID}
+	if filter.ServerID == "" {
+		var err error
+		serverIDs, err = fs.store.Keys(findingsBucket)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	results := []*FindingRecord{}
+	for _, serverID := range serverIDs {
+		records, err := fs.load(serverID)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, record := range records {
+			if filter.Status != "" && record.Status != filter.Status {
+				continue
+			}
+			if filter.Severity != "" && record.Severity != filter.Severity {
+				continue
+			}
+			if filter.Assignee != "" && record.Assignee != filter.Assignee {
+				continue
+			}
+			results = append(results, record)
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if !results[i].LastSeen.Equal(results[j].LastSeen) {
+			return results[i].LastSeen.After(results[j].LastSeen)
+		}
+		return results[i].FindingID < results[j].FindingID
+	})
+
+	return results, nil
+}
+
+// Get returns a single finding record
+func (fs *FindingsStore) Get(serverID, findingID string) (*FindingRecord, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	records, err := fs.load(serverID)
+	if err != nil {
+		return nil, err
+	}
+
+	record, exists := records[findingID]
+	if !exists {
+		return nil, fmt.Errorf("finding %s not found on server %s", findingID, serverID)
+	}
+
+	return record, nil
+}
+
+// Update changes the status and/or assignee of a finding (nil leaves a field unchanged)
+func (fs *FindingsStore) Update(serverID, findingID string, status, assignee *string) (*FindingRecord, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	records, err := fs.load(serverID)
+	if err != nil {
+		return nil, err
+	}
+
+	record, exists := records[findingID]
+	if !exists {
+		return nil, fmt.Errorf("finding %s not found on server %s", findingID, serverID)
+	}
+
+	if status != nil {
+		switch *status {
+		case "open", "acknowledged":
+			record.Status = *status
+			record.ResolvedAt = nil
+		case "resolved":
+			now := time.Now()
+			record.Status = "resolved"
+			record.ResolvedAt = &now
+		default:
+			return nil, fmt.Errorf("invalid status %q (expected open, acknowledged or resolved)", *status)
+		}
+	}
+
+	if assignee != nil {
+		record.Assignee = *assignee
+	}
+
+	record.UpdatedAt = time.Now()
+
+	if err := fs.save(serverID, records); err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// Helper functions
+
+func (fs *FindingsStore) load(serverID string) (map[string]*FindingRecord, error) {
+	records := make(map[string]*FindingRecord)
+
+	data, err := fs.store.Get(findingsBucket, serverID)
+	if errors.Is(err, ErrNotFound) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read findings: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("failed to decode findings: %w", err)
+	}
+
+	return records, nil
+}
+
+func (fs *FindingsStore) save(serverID string, records map[string]*FindingRecord) error {
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := fs.store.Put(findingsBucket, serverID, data); err != nil {
+		return fmt.Errorf("failed to write findings: %w", err)
+	}
+
+	return nil
+}
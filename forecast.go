@@ -0,0 +1,464 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Forecast settings
+const (
+	minForecastSamples = 3       // Days with audits needed to fit a trend
+	maxForecastDays    = 5 * 365 // How far ahead target dates are searched
+	holtAlpha          = 0.4     // Level smoothing of the exponentially weighted trend
+	holtBeta           = 0.2     // Trend smoothing of the exponentially weighted trend
+	fleetServerID      = "fleet" // Server ID of fleet-wide forecasts
+	hardeningSeries    = "hardening_index"
+)
+
+// Two-sided normal quantiles for the supported confidence levels
+var forecastConfidence = map[float64]float64{0.8: 1.2816, 0.9: 1.6449, 0.95: 1.96, 0.99: 2.5758}
+
+// ForecastQuery selects the model, the history it is fitted on and what to project
+type ForecastQuery struct {
+	Method     string        // linear or ewma
+	Lookback   time.Duration // History the model is fitted on
+	Horizon    time.Duration // How far ahead to project
+	Step       time.Duration // Spacing of projected points
+	Target     float64       // Score to reach, e.g. 80
+	Confidence float64       // 0.8, 0.9, 0.95 or 0.99
+}
+
+// ForecastPoint is a projected score with its confidence band
+type ForecastPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+	Lower     float64   `json:"lower"`
+	Upper     float64   `json:"upper"`
+}
+
+// TargetEstimate is when a projected score reaches the target
+type TargetEstimate struct {
+	Target    float64    `json:"target"`
+	Status    string     `json:"status"`               // reached, on_track or not_on_track
+	ReachedAt *time.Time `json:"reached_at,omitempty"` // When the trend reaches the target
+	Days      float64    `json:"days,omitempty"`       // Days from now until then
+	Earliest  *time.Time `json:"earliest,omitempty"`   // When the upper band reaches it
+	Latest    *time.Time `json:"latest,omitempty"`     // When the lower band reaches it
+}
+
+// SeriesForecast is the projection of one score series
+type SeriesForecast struct {
+	Samples     int             `json:"samples"` // Days with audits in the lookback window
+	Last        float64         `json:"last"`    // Latest daily average
+	Current     float64         `json:"current"` // Trend value now
+	SlopePerDay float64         `json:"slope_per_day"`
+	Points      []ForecastPoint `json:"points"`
+	Target      TargetEstimate  `json:"target"`
+}
+
+// Forecast projects the hardening index and framework scores of a server, or of the whole fleet
+type Forecast struct {
+	ServerID       string                     `json:"server_id"`
+	Method         string                     `json:"method"`
+	Lookback       string                     `json:"lookback"`
+	Horizon        string                     `json:"horizon"`
+	Confidence     float64                    `json:"confidence"`
+	GeneratedAt    time.Time                  `json:"generated_at"`
+	HardeningIndex *SeriesForecast            `json:"hardening_index"`
+	Frameworks     map[string]*SeriesForecast `json:"frameworks"`
+	Servers        []string                   `json:"servers,omitempty"` // Fleet forecasts: servers included
+	Skipped        []string                   `json:"skipped,omitempty"` // Fleet forecasts: servers without enough history
+}
+
+// Forecast fits the server's recent scores and projects them over the horizon
+func (hm *HistoryManager) Forecast(query ForecastQuery) (*Forecast, error) {
+	query, err := query.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	series, err := hm.fitForecast(query, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildForecast(hm.serverID, series, query, now), nil
+}
+
+// FleetForecast averages the forecasts of several servers. Servers without enough history are
+// skipped rather than failing the whole forecast.
+func FleetForecast(managers []*HistoryManager, query ForecastQuery) (*Forecast, error) {
+	query, err := query.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	byName := map[string][]fittedSeries{}
+	var included, skipped []string
+	for _, hm := range managers {
+		series, err := hm.fitForecast(query, now)
+		if err != nil {
+			skipped = append(skipped, hm.serverID)
+			continue
+		}
+
+		included = append(included, hm.serverID)
+		for name, fitted := range series {
+			byName[name] = append(byName[name], fitted)
+		}
+	}
+	if len(included) == 0 {
+		return nil, fmt.Errorf("no server has %d days of audits in the last %s", minForecastSamples, formatTrendDuration(query.Lookback))
+	}
+
+	fleet := map[string]fittedSeries{}
+	for name, fits := range byName {
+		combined := fittedSeries{}
+		models := make([]forecastModel, len(fits))
+		for i, fit := range fits {
+			models[i] = fit.model
+			combined.samples += fit.samples
+			combined.last += fit.last / float64(len(fits))
+		}
+		combined.model = averageModel(models)
+		fleet[name] = combined
+	}
+
+	forecast := buildForecast(fleetServerID, fleet, query, now)
+	forecast.Servers = included
+	forecast.Skipped = skipped
+	return forecast, nil
+}
+
+// Helper functions
+
+// forecastModel is a fitted trend. Days are relative to the time of the forecast.
+type forecastModel interface {
+	value(days float64) float64  // Expected score
+	spread(days float64) float64 // Standard error of a score observed then
+}
+
+// fittedSeries is one score series fitted with a model
+type fittedSeries struct {
+	model   forecastModel
+	samples int
+	last    float64
+}
+
+// fitForecast fits every score series of the lookback window: the hardening index and each framework
+func (hm *HistoryManager) fitForecast(query ForecastQuery, now time.Time) (map[string]fittedSeries, error) {
+	entries, _ := hm.GetRecordsPage(now.Add(-query.Lookback), now, 0, 0)
+	records := hm.ReadRecords(entries) // Compliance scores are only kept in the records
+
+	values := map[string]func(AuditRecord) (float64, bool){
+		hardeningSeries: func(record AuditRecord) (float64, bool) {
+			return parseFloat(record.HardeningIndex), record.HardeningIndex != ""
+		},
+	}
+	for _, record := range records {
+		for framework := range record.ComplianceScores {
+			framework := framework
+			values[framework] = func(record AuditRecord) (float64, bool) {
+				score, ok := record.ComplianceScores[framework]
+				return score, ok
+			}
+		}
+	}
+
+	series := map[string]fittedSeries{}
+	for name, value := range values {
+		xs, ys := dailyAverages(records, now, value)
+		if len(xs) < minForecastSamples {
+			continue
+		}
+
+		var model forecastModel
+		if query.Method == "ewma" {
+			model = fitHolt(xs, ys)
+		} else {
+			model = fitLinear(xs, ys)
+		}
+		series[name] = fittedSeries{model: model, samples: len(xs), last: ys[len(ys)-1]}
+	}
+
+	if _, ok := series[hardeningSeries]; !ok {
+		return nil, fmt.Errorf("forecasting needs audits on at least %d days in the last %s", minForecastSamples, formatTrendDuration(query.Lookback))
+	}
+	return series, nil
+}
+
+// buildForecast projects fitted series over the horizon and estimates when each reaches the target
+func buildForecast(serverID string, series map[string]fittedSeries, query ForecastQuery, now time.Time) *Forecast {
+	forecast := &Forecast{
+		ServerID:    serverID,
+		Method:      query.Method,
+		Lookback:    formatTrendDuration(query.Lookback),
+		Horizon:     formatTrendDuration(query.Horizon),
+		Confidence:  query.Confidence,
+		GeneratedAt: now,
+		Frameworks:  map[string]*SeriesForecast{},
+	}
+
+	for name, fitted := range series {
+		projected := projectSeries(fitted, query, now)
+		if name == hardeningSeries {
+			forecast.HardeningIndex = projected
+		} else {
+			forecast.Frameworks[name] = projected
+		}
+	}
+
+	return forecast
+}
+
+func projectSeries(fitted fittedSeries, query ForecastQuery, now time.Time) *SeriesForecast {
+	z := forecastConfidence[query.Confidence]
+	model := fitted.model
+
+	projected := &SeriesForecast{
+		Samples:     fitted.samples,
+		Last:        fitted.last,
+		Current:     clampScore(model.value(0)),
+		SlopePerDay: model.value(1) - model.value(0),
+		Points:      []ForecastPoint{},
+	}
+
+	horizon := query.Horizon.Hours() / 24
+	step := query.Step.Hours() / 24
+	for days := 0.0; days <= horizon+1e-9; days += step {
+		value, spread := model.value(days), z*model.spread(days)
+		projected.Points = append(projected.Points, ForecastPoint{
+			Timestamp: now.Add(time.Duration(days * float64(trendDay))),
+			Value:     clampScore(value),
+			Lower:     clampScore(value - spread),
+			Upper:     clampScore(value + spread),
+		})
+	}
+
+	// Trends are linear in time, so the crossing of the trend itself is exact; the bands widen
+	// with time and are searched day by day
+	estimate := TargetEstimate{Target: query.Target, Status: "not_on_track"}
+	at := func(days float64) *time.Time {
+		t := now.Add(time.Duration(days * float64(trendDay)))
+		return &t
+	}
+	switch {
+	case model.value(0) >= query.Target:
+		estimate.Status = "reached"
+	case projected.SlopePerDay > 0:
+		days := (query.Target - model.value(0)) / projected.SlopePerDay
+		if days <= maxForecastDays {
+			estimate.Status = "on_track"
+			estimate.Days = math.Round(days*10) / 10
+			estimate.ReachedAt = at(days)
+		}
+	}
+	if estimate.Status != "reached" {
+		for days := 0; days <= maxForecastDays && estimate.Latest == nil; days++ {
+			value, spread := model.value(float64(days)), z*model.spread(float64(days))
+			if estimate.Earliest == nil && value+spread >= query.Target {
+				estimate.Earliest = at(float64(days))
+			}
+			if value-spread >= query.Target {
+				estimate.Latest = at(float64(days))
+			}
+		}
+	}
+	projected.Target = estimate
+
+	return projected
+}
+
+// dailyAverages averages a series per UTC day, returning each day's mean offset from now in days
+func dailyAverages(records []AuditRecord, now time.Time, value func(AuditRecord) (float64, bool)) ([]float64, []float64) {
+	type day struct {
+		x, y  float64
+		count int
+	}
+	days := map[time.Time]*day{}
+	for _, record := range records {
+		y, ok := value(record)
+		if !ok {
+			continue
+		}
+
+		start := record.Timestamp.UTC().Truncate(trendDay)
+		if days[start] == nil {
+			days[start] = &day{}
+		}
+		days[start].x += record.Timestamp.Sub(now).Hours() / 24
+		days[start].y += y
+		days[start].count++
+	}
+
+	starts := make([]time.Time, 0, len(days))
+	for start := range days {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+
+	xs, ys := make([]float64, len(starts)), make([]float64, len(starts))
+	for i, start := range starts {
+		xs[i] = days[start].x / float64(days[start].count)
+		ys[i] = days[start].y / float64(days[start].count)
+	}
+	return xs, ys
+}
+
+// linearModel is an ordinary least squares fit with prediction intervals
+type linearModel struct {
+	intercept, slope float64
+	sigma            float64 // Residual standard error
+	n                int
+	meanX, sxx       float64
+}
+
+func fitLinear(xs, ys []float64) linearModel {
+	n := float64(len(xs))
+	var meanX, meanY float64
+	for i := range xs {
+		meanX += xs[i] / n
+		meanY += ys[i] / n
+	}
+
+	var sxx, sxy float64
+	for i := range xs {
+		sxx += (xs[i] - meanX) * (xs[i] - meanX)
+		sxy += (xs[i] - meanX) * (ys[i] - meanY)
+	}
+
+	m := linearModel{n: len(xs), meanX: meanX, sxx: sxx}
+	if sxx > 0 {
+		m.slope = sxy / sxx
+	}
+	m.intercept = meanY - m.slope*meanX
+
+	var sse float64
+	for i := range xs {
+		residual := ys[i] - m.value(xs[i])
+		sse += residual * residual
+	}
+	m.sigma = math.Sqrt(sse / (n - 2))
+
+	return m
+}
+
+func (m linearModel) value(days float64) float64 {
+	return m.intercept + m.slope*days
+}
+
+func (m linearModel) spread(days float64) float64 {
+	leverage := 1 / float64(m.n)
+	if m.sxx > 0 {
+		leverage += (days - m.meanX) * (days - m.meanX) / m.sxx
+	}
+	return m.sigma * math.Sqrt(1+leverage)
+}
+
+// holtModel is Holt's exponentially weighted level and trend, adapted to irregular audit days
+type holtModel struct {
+	level, trend float64
+	lastX        float64 // Offset of the last observation
+	sigma        float64 // RMS of one-step-ahead errors
+	meanStep     float64 // Mean days between observations
+}
+
+func fitHolt(xs, ys []float64) holtModel {
+	m := holtModel{
+		level:    ys[0],
+		trend:    (ys[1] - ys[0]) / math.Max(xs[1]-xs[0], 1e-9),
+		lastX:    xs[0],
+		meanStep: (xs[len(xs)-1] - xs[0]) / float64(len(xs)-1),
+	}
+
+	var sse float64
+	for i := 1; i < len(xs); i++ {
+		dt := math.Max(xs[i]-m.lastX, 1e-9)
+		predicted := m.level + m.trend*dt
+		sse += (ys[i] - predicted) * (ys[i] - predicted)
+
+		level := holtAlpha*ys[i] + (1-holtAlpha)*predicted
+		m.trend = holtBeta*(level-m.level)/dt + (1-holtBeta)*m.trend
+		m.level = level
+		m.lastX = xs[i]
+	}
+	m.sigma = math.Sqrt(sse / float64(len(xs)-1))
+
+	return m
+}
+
+func (m holtModel) value(days float64) float64 {
+	return m.level + m.trend*(days-m.lastX)
+}
+
+// spread uses the variance of an h-step Holt forecast, counting steps in mean audit intervals
+func (m holtModel) spread(days float64) float64 {
+	k := math.Max((days-m.lastX)/math.Max(m.meanStep, 1e-9)-1, 0)
+	a, b := holtAlpha, holtBeta
+	variance := 1 + a*a*(k+b*k*(k+1)+b*b*k*(k+1)*(2*k+1)/6)
+	return m.sigma * math.Sqrt(variance)
+}
+
+// averageModel is the mean of independent models, used for the fleet
+type averageModel []forecastModel
+
+func (models averageModel) value(days float64) float64 {
+	var sum float64
+	for _, model := range models {
+		sum += model.value(days)
+	}
+	return sum / float64(len(models))
+}
+
+func (models averageModel) spread(days float64) float64 {
+	var variance float64
+	for _, model := range models {
+		variance += model.spread(days) * model.spread(days)
+	}
+	return math.Sqrt(variance) / float64(len(models))
+}
+
+func (q ForecastQuery) normalize() (ForecastQuery, error) {
+	if q.Method == "" {
+		q.Method = "linear"
+	}
+	if q.Method != "linear" && q.Method != "ewma" {
+		return q, fmt.Errorf("unknown forecast method %q (use linear or ewma)", q.Method)
+	}
+	if q.Lookback == 0 {
+		q.Lookback = 90 * trendDay
+	}
+	if q.Horizon == 0 {
+		q.Horizon = 30 * trendDay
+	}
+	if q.Step == 0 {
+		q.Step = trendDay
+		if q.Horizon > 180*trendDay {
+			q.Step = trendWeek
+		}
+	}
+	if q.Horizon/q.Step > 1000 {
+		return q, fmt.Errorf("horizon %s needs more than 1000 steps of %s", formatTrendDuration(q.Horizon), formatTrendDuration(q.Step))
+	}
+	if q.Target == 0 {
+		q.Target = 80
+	}
+	if q.Target < 0 || q.Target > 100 {
+		return q, fmt.Errorf("target must be between 0 and 100")
+	}
+	if q.Confidence == 0 {
+		q.Confidence = 0.95
+	}
+	if _, ok := forecastConfidence[q.Confidence]; !ok {
+		return q, fmt.Errorf("confidence must be 0.8, 0.9, 0.95 or 0.99")
+	}
+	return q, nil
+}
+
+func clampScore(score float64) float64 {
+	return math.Round(math.Max(0, math.Min(100, score))*10) / 10
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFitLinear(t *testing.T) {
+	tests := []struct {
+		name             string
+		xs, ys           []float64
+		slope, intercept float64
+		sigma            float64
+	}{
+		{"exact line", []float64{0, 1, 2, 3, 4}, []float64{10, 12, 14, 16, 18}, 2, 10, 0},
+		{"flat", []float64{0, 3, 7}, []float64{50, 50, 50}, 0, 50, 0},
+		{"irregular days", []float64{0, 1, 5, 6}, []float64{60, 59.5, 57.5, 57}, -0.5, 60, 0},
+		{"noisy", []float64{0, 1, 2, 3}, []float64{1, 3, 2, 4}, 0.8, 1.3, math.Sqrt(0.9)},
+		{"all on one day", []float64{5, 5, 5}, []float64{1, 2, 3}, 0, 2, math.Sqrt(2)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := fitLinear(tt.xs, tt.ys)
+			if !approxEqual(m.slope, tt.slope) || !approxEqual(m.intercept, tt.intercept) || !approxEqual(m.sigma, tt.sigma) {
+				t.Errorf("fitLinear() = slope %v, intercept %v, sigma %v, want %v, %v, %v", m.slope, m.intercept, m.sigma, tt.slope, tt.intercept, tt.sigma)
+			}
+			if got, want := m.value(10), tt.intercept+tt.slope*10; !approxEqual(got, want) {
+				t.Errorf("value(10) = %v, want %v", got, want)
+			}
+
+			// Prediction intervals widen away from the observed days
+			last := tt.xs[len(tt.xs)-1]
+			if m.spread(last+30) < m.spread(last) {
+				t.Errorf("spread narrows with the horizon: %v at +30 days, %v at the last audit", m.spread(last+30), m.spread(last))
+			}
+			if tt.sigma == 0 && m.spread(last+30) != 0 {
+				t.Errorf("spread = %v for an exact fit, want 0", m.spread(last+30))
+			}
+		})
+	}
+}
+
+func TestFitHolt(t *testing.T) {
+	tests := []struct {
+		name   string
+		xs, ys []float64
+		at     float64 // Day to forecast
+		want   float64
+		exact  bool // One-step errors are all zero
+	}{
+		{"exact line", []float64{0, 1, 2, 3, 4}, []float64{10, 12, 14, 16, 18}, 10, 30, true},
+		{"exact line on irregular days", []float64{0, 2, 3, 7}, []float64{80, 79, 78.5, 76.5}, 10, 75, true},
+		{"flat", []float64{0, 1, 2}, []float64{50, 50, 50}, 30, 50, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := fitHolt(tt.xs, tt.ys)
+			if got := m.value(tt.at); !approxEqual(got, tt.want) {
+				t.Errorf("value(%v) = %v, want %v", tt.at, got, tt.want)
+			}
+			if tt.exact && !approxEqual(m.sigma, 0) {
+				t.Errorf("sigma = %v, want 0", m.sigma)
+			}
+			if m.lastX != tt.xs[len(tt.xs)-1] {
+				t.Errorf("lastX = %v, want the last day %v", m.lastX, tt.xs[len(tt.xs)-1])
+			}
+		})
+	}
+
+	// After a flat start the recent climb dominates Holt's trend, while a line through all audits
+	// is pulled down by the flat part
+	xs := []float64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	ys := []float64{50, 50, 50, 50, 50, 52, 54, 56, 58, 60}
+	holt, linear := fitHolt(xs, ys), fitLinear(xs, ys)
+	if holt.trend <= linear.slope {
+		t.Errorf("Holt trend %v isn't steeper than the linear slope %v after a recent climb", holt.trend, linear.slope)
+	}
+	if holt.sigma <= 0 {
+		t.Errorf("sigma = %v, want one-step errors from the change in trend", holt.sigma)
+	}
+	if holt.spread(30) <= holt.spread(10) {
+		t.Errorf("spread narrows with the horizon: %v at day 30, %v at day 10", holt.spread(30), holt.spread(10))
+	}
+}
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
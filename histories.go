@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// HistoryManagers hands out the history of every server, the dashboard host included, loading
+// each one on first use
+type HistoryManagers struct {
+	store    Storage
+	servers  *ServerManager
+	signer   *ChainSigner
+	managers map[string]*HistoryManager
+	mu       sync.Mutex
+}
+
+// NewHistoryManagers creates the registry and loads the dashboard host's history up front
+func NewHistoryManagers(store Storage, servers *ServerManager, signer *ChainSigner) (*HistoryManagers, error) {
+	hms := &HistoryManagers{
+		store:    store,
+		servers:  servers,
+		signer:   signer,
+		managers: make(map[string]*HistoryManager),
+	}
+
+	if _, err := hms.For(localServerID); err != nil {
+		return nil, err
+	}
+
+	return hms, nil
+}
+
+// For returns the history of a registered server
+func (hms *HistoryManagers) For(serverID string) (*HistoryManager, error) {
+	hms.mu.Lock()
+	defer hms.mu.Unlock()
+
+	if hm, exists := hms.managers[serverID]; exists {
+		return hm, nil
+	}
+
+	if _, err := hms.servers.GetServer(serverID); err != nil && serverID != localServerID {
+		return nil, err
+	}
+
+	hm, err := NewHistoryManager(hms.store, serverID, hms.signer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load history of %s: %w", serverID, err)
+	}
+
+	// Agents that reported before servers had their own history start with their stored metrics
+	if serverID != localServerID && hm.indexedCount() == 0 {
+		if count, err := hms.backfill(hm); err != nil {
+			log.Printf("⚠️ Failed to build history of %s from its metrics: %v", serverID, err)
+		} else if count > 0 {
+			log.Printf("🗂️ Built history of %s from %d stored audits", serverID, count)
+		}
+	}
+
+	hms.managers[serverID] = hm
+	return hm, nil
+}
+
+// RebuildAll rebuilds the index of every loaded history, e.g. after records were imported
+func (hms *HistoryManagers) RebuildAll() error {
+	hms.mu.Lock()
+	defer hms.mu.Unlock()
+
+	for serverID, hm := range hms.managers {
+		if _, err := hm.RebuildIndex(); err != nil {
+			return fmt.Errorf("failed to reindex history of %s: %w", serverID, err)
+		}
+	}
+
+	return nil
+}
+
+// Forget drops a server's cached history, used when the server is removed
+func (hms *HistoryManagers) Forget(serverID string) {
+	hms.mu.Lock()
+	defer hms.mu.Unlock()
+
+	delete(hms.managers, serverID)
+}
+
+// backfill records every stored metrics submission of a server in its history
+func (hms *HistoryManagers) backfill(hm *HistoryManager) (int, error) {
+	keys, err := hms.store.Keys(auditsBucket(hm.serverID))
+	if err != nil || len(keys) == 0 {
+		return 0, err
+	}
+
+	metrics, err := hms.servers.GetServerMetrics(hm.serverID, len(keys))
+	if err != nil {
+		return 0, err
+	}
+
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+
+	// Metrics come newest first
+	count := 0
+	prevHash := ""
+	for i := len(metrics) - 1; i >= 0; i-- {
+		if len(metrics[i].RawData) == 0 {
+			continue
+		}
+		record, err := hm.writeRecord(metrics[i].RawData, analyzeCompliance(metrics[i].RawData), metrics[i].Timestamp, prevHash)
+		if err != nil {
+			return count, err
+		}
+		prevHash = record.Hash
+		count++
+	}
+
+	// Index everything in one pass rather than once per record
+	keys, err = hms.store.Keys(hm.buckets.records)
+	if err != nil {
+		return count, err
+	}
+	_, err = hm.rebuildIndex(keys)
+	return count, err
+}
@@ -1,36 +1,31 @@
 package main
 
 import (
+	"bytes"
 	"compress/gzip"
 	"encoding/json"
 	"fmt"
 	"io"
-	"os"
-	"path/filepath"
-	"sort"
+	"log"
+	"sync"
 	"time"
 )
 
-// HistoryConfig manages historical audit data
-type HistoryConfig struct {
-	StoragePath       string
-	MaxFullRecords    int           // Keep last N full records
-	RetentionDays     int           // Delete records older than N days
-	CompressionAge    time.Duration // Compress records older than this
-	EnableCompression bool
-}
-
 // AuditRecord represents a single audit snapshot
 type AuditRecord struct {
-	Timestamp        time.Time              `json:"timestamp"`
-	HardeningIndex   string                 `json:"hardening_index"`
-	Warnings         string                 `json:"warnings"`
-	TestsPerformed   string                 `json:"tests_performed"`
-	Suggestions      int                    `json:"suggestions"`
-	ComplianceScores map[string]float64     `json:"compliance_scores"`
-	KeyMetrics       map[string]string      `json:"key_metrics"` // Store only important fields
-	FullDataHash     string                 `json:"full_data_hash"`
-	Compressed       bool                   `json:"compressed"`
+	ID               string             `json:"id"` // Storage key, e.g. audit_2024-01-31_02-00-00
+	Timestamp        time.Time          `json:"timestamp"`
+	HardeningIndex   string             `json:"hardening_index"`
+	Warnings         string             `json:"warnings"`
+	TestsPerformed   string             `json:"tests_performed"`
+	Suggestions      int                `json:"suggestions"`
+	ComplianceScores map[string]float64 `json:"compliance_scores"`
+	KeyMetrics       map[string]string  `json:"key_metrics"` // Store only important fields
+	FullDataHash     string             `json:"full_data_hash"`
+	Compressed       bool               `json:"compressed"`
+	ChainLink
+
+	storedSize int // Bytes in storage, compressed or not
 }
 
 // TrendData represents trend analysis over time
@@ -38,7 +33,12 @@ type TrendData struct {
 	SecurityScoreTrend []DataPoint `json:"security_score_trend"`
 	WarningsTrend      []DataPoint `json:"warnings_trend"`
 	TestsTrend         []DataPoint `json:"tests_trend"`
-	Period             string      `json:"period"` // "7d", "30d", "90d"
+	Period             string      `json:"period,omitempty"` // e.g. "7d", "30d", "365d"
+	From               time.Time   `json:"from"`
+	To                 time.Time   `json:"to"`
+	Bucket             string      `json:"bucket,omitempty"` // Empty for one point per record
+	Aggregation        string      `json:"aggregation"`
+	Source             string      `json:"source"` // records, daily_rollup or weekly_rollup
 }
 
 // DataPoint represents a single data point in time series
@@ -47,35 +47,61 @@ type DataPoint struct {
 	Value     float64   `json:"value"`
 }
 
-// HistoryManager manages audit history
+// HistoryManager manages the audit history of one server
 type HistoryManager struct {
-	config HistoryConfig
+	serverID string
+	buckets  historyBuckets
+	store    Storage
+	index    []IndexEntry // Summary of every record, oldest first
+	rollups  historyRollups
+	signer   *ChainSigner // Signs chained records, nil leaves them unsigned
+	mu       sync.RWMutex
+}
+
+// historyBuckets names where one server's history lives
+type historyBuckets struct {
+	records   string
+	index     string
+	rollups   string
+	snapshots string
 }
 
-// NewHistoryManager creates a new history manager
-func NewHistoryManager(storagePath string) *HistoryManager {
-	if storagePath == "" {
-		storagePath = "./history"
+// NewHistoryManager creates the history manager of a server on top of the given storage
+func NewHistoryManager(store Storage, serverID string, signer *ChainSigner) (*HistoryManager, error) {
+	hm := &HistoryManager{
+		serverID: serverID,
+		buckets:  serverHistoryBuckets(serverID),
+		store:    store,
+		signer:   signer,
+	}
+
+	if err := hm.loadIndex(); err != nil {
+		return nil, err
 	}
 
-	// Create storage directory if it doesn't exist
-	os.MkdirAll(storagePath, 0755)
+	return hm, nil
+}
 
-	return &HistoryManager{
-		config: HistoryConfig{
-			StoragePath:       storagePath,
-			MaxFullRecords:    90,                   // Keep 90 days of full data
-			RetentionDays:     365,                  // Keep 1 year of summary data
-			CompressionAge:    30 * 24 * time.Hour, // Compress data older than 30 days
-			EnableCompression: true,
-		},
+// SaveAudit saves an audit taken at the given time to history and returns its record ID
+func (hm *HistoryManager) SaveAudit(data map[string]string, compliance ComplianceAnalysis, timestamp time.Time) (string, error) {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+
+	prevHash, err := hm.chainHead(timestamp)
+	if err != nil {
+		return "", err
 	}
+	record, err := hm.writeRecord(data, compliance, timestamp, prevHash)
+	if err != nil {
+		return "", err
+	}
+	return record.ID, hm.indexRecord(*record)
 }
 
-// SaveAudit saves the current audit data to history
-func (hm *HistoryManager) SaveAudit(data map[string]string, compliance ComplianceAnalysis) error {
+// writeRecord stores a record and its snapshot without indexing it, chained to the record with prevHash
+func (hm *HistoryManager) writeRecord(data map[string]string, compliance ComplianceAnalysis, timestamp time.Time, prevHash string) (*AuditRecord, error) {
 	record := AuditRecord{
-		Timestamp:      time.Now(),
+		Timestamp:      timestamp,
 		HardeningIndex: data["hardening_index"],
 		Warnings:       data["warnings"],
 		TestsPerformed: data["lynis_tests_done"],
@@ -90,167 +116,91 @@ func (hm *HistoryManager) SaveAudit(data map[string]string, compliance Complianc
 		KeyMetrics: extractKeyMetrics(data),
 	}
 
-	// Generate filename with timestamp
-	filename := fmt.Sprintf("audit_%s.json", record.Timestamp.Format("2006-01-02_15-04-05"))
-	filepath := filepath.Join(hm.config.StoragePath, filename)
+	record.ID = auditKey(record.Timestamp, func(key string) bool {
+		_, err := hm.store.Get(hm.buckets.records, key)
+		return err == nil
+	})
 
-	// Save to file
-	file, err := os.Create(filepath)
+	// Keep the complete report so it can be reopened later
+	hash, err := saveSnapshot(hm.store, hm.buckets.snapshots, data)
 	if err != nil {
-		return fmt.Errorf("failed to create history file: %w", err)
+		return nil, err
 	}
-	defer file.Close()
+	record.FullDataHash = hash
 
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	if err := encoder.Encode(record); err != nil {
-		return fmt.Errorf("failed to encode history data: %w", err)
+	// The snapshot hash ties the full report into the chain as well
+	record.PrevHash = prevHash
+	sum, err := record.chainHash()
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash history record: %w", err)
 	}
+	hm.signer.seal(&record.ChainLink, sum)
 
-	// Run cleanup in background
-	go hm.CleanupOldRecords()
+	encoded, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode history data: %w", err)
+	}
 
-	return nil
+	if err := hm.store.Put(hm.buckets.records, record.ID, encoded); err != nil {
+		return nil, fmt.Errorf("failed to save history record: %w", err)
+	}
+	record.storedSize = len(encoded)
+
+	return &record, nil
 }
 
-// GetTrend returns trend data for specified period
+// GetTrend returns one point per record for a period ending now, such as "7d" or "12w"
 func (hm *HistoryManager) GetTrend(period string) (*TrendData, error) {
-	var duration time.Duration
-	switch period {
-	case "7d":
-		duration = 7 * 24 * time.Hour
-	case "30d":
-		duration = 30 * 24 * time.Hour
-	case "90d":
-		duration = 90 * 24 * time.Hour
-	default:
-		duration = 30 * 24 * time.Hour
-	}
-
-	records, err := hm.GetRecordsSince(time.Now().Add(-duration))
+	duration, err := parseTrendDuration(period)
 	if err != nil {
 		return nil, err
 	}
 
-	trend := &TrendData{
-		Period:             period,
-		SecurityScoreTrend: []DataPoint{},
-		WarningsTrend:      []DataPoint{},
-		TestsTrend:         []DataPoint{},
-	}
-
-	for _, record := range records {
-		// Parse values
-		score := parseFloat(record.HardeningIndex)
-		warnings := parseFloat(record.Warnings)
-		tests := parseFloat(record.TestsPerformed)
-
-		trend.SecurityScoreTrend = append(trend.SecurityScoreTrend, DataPoint{
-			Timestamp: record.Timestamp,
-			Value:     score,
-		})
-
-		trend.WarningsTrend = append(trend.WarningsTrend, DataPoint{
-			Timestamp: record.Timestamp,
-			Value:     warnings,
-		})
-
-		trend.TestsTrend = append(trend.TestsTrend, DataPoint{
-			Timestamp: record.Timestamp,
-			Value:     tests,
-		})
+	trend, err := hm.GetTrendRange(TrendQuery{From: time.Now().Add(-duration)})
+	if err != nil {
+		return nil, err
 	}
+	trend.Period = period
 
 	return trend, nil
 }
 
-// GetRecordsSince returns all records since specified time
+// GetRecordsSince returns all records since specified time, found through the index
 func (hm *HistoryManager) GetRecordsSince(since time.Time) ([]AuditRecord, error) {
-	files, err := os.ReadDir(hm.config.StoragePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read history directory: %w", err)
-	}
-
-	var records []AuditRecord
-
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
-
-		filePath := filepath.Join(hm.config.StoragePath, file.Name())
-		
-		// Try to read record
-		record, err := hm.readRecord(filePath)
-		if err != nil {
-			continue // Skip corrupted files
-		}
-
-		// Filter by time
-		if record.Timestamp.After(since) {
-			records = append(records, *record)
-		}
-	}
-
-	// Sort by timestamp
-	sort.Slice(records, func(i, j int) bool {
-		return records[i].Timestamp.Before(records[j].Timestamp)
-	})
-
-	return records, nil
+	entries, _ := hm.GetRecordsPage(since, time.Time{}, 0, 0)
+	return hm.ReadRecords(entries), nil
 }
 
-// GetLatestRecord returns the most recent audit record
+// GetLatestRecord returns the most recent audit record by audit timestamp
 func (hm *HistoryManager) GetLatestRecord() (*AuditRecord, error) {
-	files, err := os.ReadDir(hm.config.StoragePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read history directory: %w", err)
-	}
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
 
-	if len(files) == 0 {
+	if len(hm.index) == 0 {
 		return nil, fmt.Errorf("no history records found")
 	}
 
-	// Sort files by modification time (newest first)
-	sort.Slice(files, func(i, j int) bool {
-		infoI, _ := files[i].Info()
-		infoJ, _ := files[j].Info()
-		return infoI.ModTime().After(infoJ.ModTime())
-	})
-
-	// Read the latest file
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
-
-		filePath := filepath.Join(hm.config.StoragePath, file.Name())
-		record, err := hm.readRecord(filePath)
-		if err == nil {
-			return record, nil
-		}
-	}
-
-	return nil, fmt.Errorf("no valid records found")
+	return hm.readRecord(hm.index[len(hm.index)-1].ID)
 }
 
-// CompareWithPrevious compares current audit with previous one
-func (hm *HistoryManager) CompareWithPrevious(current map[string]string) (map[string]interface{}, error) {
-	previous, err := hm.GetLatestRecord()
-	if err != nil {
-		return nil, err
+// CompareWithPrevious compares the newest audit with the one before it
+func (hm *HistoryManager) CompareWithPrevious() (map[string]interface{}, error) {
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+
+	if len(hm.index) < 2 {
+		return nil, ErrNoEarlierAudit
 	}
+	latest, previous := hm.index[len(hm.index)-1], hm.index[len(hm.index)-2]
 
-	currentScore := parseFloat(current["hardening_index"])
+	latestScore := parseFloat(latest.HardeningIndex)
 	previousScore := parseFloat(previous.HardeningIndex)
-	
-	currentWarnings := parseFloat(current["warnings"])
-	previousWarnings := parseFloat(previous.Warnings)
 
 	comparison := map[string]interface{}{
-		"score_change":    currentScore - previousScore,
-		"warnings_change": currentWarnings - previousWarnings,
-		"improved":        currentScore > previousScore,
+		"score_change":    latestScore - previousScore,
+		"warnings_change": parseFloat(latest.Warnings) - parseFloat(previous.Warnings),
+		"improved":        latestScore > previousScore,
+		"latest_date":     latest.Timestamp,
 		"previous_date":   previous.Timestamp,
 		"days_since":      time.Since(previous.Timestamp).Hours() / 24,
 	}
@@ -258,79 +208,91 @@ func (hm *HistoryManager) CompareWithPrevious(current map[string]string) (map[st
 	return comparison, nil
 }
 
-// CleanupOldRecords removes old records based on retention policy
-func (hm *HistoryManager) CleanupOldRecords() error {
-	files, err := os.ReadDir(hm.config.StoragePath)
-	if err != nil {
-		return err
-	}
+// CleanupOldRecords deletes and compresses records according to a retention policy. Records under
+// legal hold are never deleted. Returns the hashes of deleted records so chain gaps can be explained.
+func (hm *HistoryManager) CleanupOldRecords(policy RetentionPolicy, held func(time.Time) bool) (RetentionCounts, []string, error) {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
 
-	cutoffDate := time.Now().AddDate(0, 0, -hm.config.RetentionDays)
-	compressionDate := time.Now().Add(-hm.config.CompressionAge)
+	var counts RetentionCounts
+	var pruned []string // Hashes of deleted chained records
 
-	for _, file := range files {
-		if file.IsDir() {
-			continue
+	kept := hm.index[:0]
+	var removedSnapshots []string
+	for _, record := range hm.index {
+		// Delete very old records
+		if policy.expired(record.Timestamp) {
+			if held(record.Timestamp) {
+				counts.Held++
+			} else if err := hm.store.Delete(hm.buckets.records, record.ID); err == nil {
+				if err := hm.deleteEntry(record.ID); err != nil {
+					log.Printf("⚠️ %v", err)
+				}
+				removedSnapshots = append(removedSnapshots, record.FullDataHash)
+				if record.Hash != "" {
+					pruned = append(pruned, record.Hash)
+				}
+				counts.Deleted++
+				continue
+			}
 		}
 
-		filePath := filepath.Join(hm.config.StoragePath, file.Name())
-		record, err := hm.readRecord(filePath)
-		if err != nil {
-			continue
+		// Compress old records (if enabled and not already compressed)
+		if !record.Compressed && policy.compressible(record.Timestamp) {
+			if size, err := hm.compressRecord(record.ID); err == nil {
+				record.Compressed = true
+				record.Size = size
+				counts.Compressed++
+				if err := hm.saveEntry(record); err != nil {
+					log.Printf("⚠️ %v", err)
+				}
+			}
 		}
 
-		// Delete very old records
-		if record.Timestamp.Before(cutoffDate) {
-			os.Remove(filePath)
-			continue
-		}
+		kept = append(kept, record)
+	}
+	hm.index = kept
 
-		// Compress old records (if enabled and not already compressed)
-		if hm.config.EnableCompression && !record.Compressed && record.Timestamp.Before(compressionDate) {
-			hm.compressRecord(filePath)
+	if counts.Deleted == 0 && counts.Compressed == 0 {
+		return counts, pruned, nil
+	}
+	if counts.Deleted > 0 {
+		if err := hm.rebuildRollups(); err != nil {
+			return counts, pruned, err
 		}
 	}
 
-	return nil
+	// Snapshots are shared between identical reports, only drop unreferenced ones
+	hm.pruneSnapshots(removedSnapshots)
+	return counts, pruned, nil
 }
 
-// GetStorageStats returns storage usage statistics
+// GetStorageStats returns storage usage statistics, from the index rather than the records
 func (hm *HistoryManager) GetStorageStats() (map[string]interface{}, error) {
-	files, err := os.ReadDir(hm.config.StoragePath)
-	if err != nil {
-		return nil, err
-	}
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
 
 	var totalSize int64
 	var compressedCount int
-	var recordCount int
+	recordCount := len(hm.index)
 
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
-
-		info, err := file.Info()
-		if err != nil {
-			continue
-		}
-
-		totalSize += info.Size()
-		recordCount++
-
-		if filepath.Ext(file.Name()) == ".gz" {
+	for _, entry := range hm.index {
+		totalSize += int64(entry.Size)
+		if entry.Compressed {
 			compressedCount++
 		}
 	}
 
 	stats := map[string]interface{}{
 		"total_records":     recordCount,
+		"indexed_records":   recordCount,
 		"compressed_count":  compressedCount,
 		"total_size_bytes":  totalSize,
 		"total_size_kb":     totalSize / 1024,
 		"total_size_mb":     float64(totalSize) / (1024 * 1024),
 		"avg_record_size":   totalSize / int64(max(recordCount, 1)),
-		"storage_path":      hm.config.StoragePath,
+		"storage_backend":   hm.store.Backend(),
+		"server_id":         hm.serverID,
 		"compression_ratio": float64(compressedCount) / float64(max(recordCount, 1)) * 100,
 	}
 
@@ -339,65 +301,87 @@ func (hm *HistoryManager) GetStorageStats() (map[string]interface{}, error) {
 
 // Helper functions
 
-func (hm *HistoryManager) readRecord(filePath string) (*AuditRecord, error) {
-	var reader io.Reader
-	file, err := os.Open(filePath)
+// serverHistoryBuckets keeps the dashboard host's history where it has always been and nests
+// every other server's history under that server's bucket
+func serverHistoryBuckets(serverID string) historyBuckets {
+	if serverID == localServerID {
+		return historyBuckets{
+			records:   historyBucket,
+			index:     historyIndexBucket,
+			rollups:   historyRollupsBucket,
+			snapshots: snapshotsBucket,
+		}
+	}
+
+	base := serverBucket(serverID)
+	return historyBuckets{
+		records:   base + "/" + historyBucket,
+		index:     base + "/" + historyIndexBucket,
+		rollups:   base + "/" + historyRollupsBucket,
+		snapshots: base + "/" + snapshotsBucket,
+	}
+}
+
+// auditKey returns the key for a record taken at timestamp. Keys are built from UTC so they sort
+// chronologically across DST changes, and a record from a second already taken is numbered.
+func auditKey(timestamp time.Time, exists func(key string) bool) string {
+	base := fmt.Sprintf("audit_%s", timestamp.UTC().Format("2006-01-02_15-04-05"))
+	key := base
+	for n := 2; exists(key); n++ {
+		key = fmt.Sprintf("%s_%02d", base, n)
+	}
+	return key
+}
+
+func (hm *HistoryManager) readRecord(key string) (*AuditRecord, error) {
+	value, err := hm.store.Get(hm.buckets.records, key)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
 
-	// Check if file is gzipped
-	if filepath.Ext(filePath) == ".gz" {
-		gzReader, err := gzip.NewReader(file)
+	// Check if the record is gzipped
+	var reader io.Reader = bytes.NewReader(value)
+	if isGzipped(value) {
+		gzReader, err := gzip.NewReader(reader)
 		if err != nil {
 			return nil, err
 		}
 		defer gzReader.Close()
 		reader = gzReader
-	} else {
-		reader = file
 	}
 
 	var record AuditRecord
 	if err := json.NewDecoder(reader).Decode(&record); err != nil {
 		return nil, err
 	}
+	record.ID = key
+	record.Compressed = isGzipped(value)
+	record.storedSize = len(value)
 
 	return &record, nil
 }
 
-func (hm *HistoryManager) compressRecord(filePath string) error {
-	// Read original file
-	data, err := os.ReadFile(filePath)
-	if err != nil {
-		return err
+// compressRecord gzips a stored record and returns its new size
+func (hm *HistoryManager) compressRecord(key string) (int, error) {
+	// Read original record
+	data, err := hm.store.Get(hm.buckets.records, key)
+	if err != nil || isGzipped(data) {
+		return len(data), err
 	}
 
-	// Create compressed file
-	gzPath := filePath + ".gz"
-	gzFile, err := os.Create(gzPath)
+	compressed, err := gzipValue(data)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	defer gzFile.Close()
-
-	gzWriter := gzip.NewWriter(gzFile)
-	defer gzWriter.Close()
 
-	_, err = gzWriter.Write(data)
-	if err != nil {
-		return err
-	}
-
-	// Remove original file after successful compression
-	return os.Remove(filePath)
+	// Replaces the uncompressed record
+	return len(compressed), hm.store.Put(hm.buckets.records, key, compressed)
 }
 
 func extractKeyMetrics(data map[string]string) map[string]string {
 	// Extract only the most important metrics to save space
 	metrics := make(map[string]string)
-	
+
 	importantKeys := []string{
 		"os", "hostname", "kernel_version", "firewall_software",
 		"firewall_status", "ssh_daemon_status", "logging_daemon",
@@ -442,4 +426,3 @@ func max(a, b int) int {
 	}
 	return b
 }
-
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// The history index keeps one entry per record, under the record's key
+const (
+	historyIndexBucket    = "history_index"
+	legacyHistoryIndexKey = "index" // The whole index as one value, replaced by per-record entries
+)
+
+// IndexEntry summarises one history record so queries don't decode the records themselves
+type IndexEntry struct {
+	ID             string    `json:"id"` // Key of the record in the history bucket
+	Timestamp      time.Time `json:"timestamp"`
+	HardeningIndex string    `json:"hardening_index"`
+	Warnings       string    `json:"warnings"`
+	TestsPerformed string    `json:"tests_performed"`
+	FullDataHash   string    `json:"full_data_hash"`
+	Compressed     bool      `json:"compressed"`
+	Size           int       `json:"size"`           // Bytes the record takes in storage
+	Hash           string    `json:"hash,omitempty"` // Chain hash, linked to by the next record
+}
+
+// newIndexEntry summarises a record for the index
+func newIndexEntry(record *AuditRecord) IndexEntry {
+	return IndexEntry{
+		ID:             record.ID,
+		Timestamp:      record.Timestamp,
+		HardeningIndex: record.HardeningIndex,
+		Warnings:       record.Warnings,
+		TestsPerformed: record.TestsPerformed,
+		FullDataHash:   record.FullDataHash,
+		Compressed:     record.Compressed,
+		Size:           record.storedSize,
+		Hash:           record.Hash,
+	}
+}
+
+// loadIndex reads the index, rebuilding it when it is missing or out of step with the records
+func (hm *HistoryManager) loadIndex() error {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+
+	keys, err := hm.store.Keys(hm.buckets.records)
+	if err != nil {
+		return fmt.Errorf("failed to list history records: %w", err)
+	}
+
+	entries, err := hm.readIndex()
+	if err == nil && indexMatchesKeys(entries, keys) {
+		hm.index = entries
+		return hm.loadRollups()
+	}
+
+	if len(keys) > 0 {
+		log.Println("🗂️ History index missing or stale, rebuilding from records...")
+	}
+	_, err = hm.rebuildIndex(keys)
+	return err
+}
+
+// RebuildIndex regenerates the index from the raw history records
+func (hm *HistoryManager) RebuildIndex() (int, error) {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+
+	keys, err := hm.store.Keys(hm.buckets.records)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list history records: %w", err)
+	}
+
+	return hm.rebuildIndex(keys)
+}
+
+// GetRecord returns one indexed record by ID, read in full from storage
+func (hm *HistoryManager) GetRecord(id string) (*AuditRecord, error) {
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+
+	if _, ok := hm.findEntry(id); !ok {
+		return nil, fmt.Errorf("history record %s not found", id)
+	}
+
+	return hm.readRecord(id)
+}
+
+// GetRecordsPage returns index entries in [from, to) ordered oldest first, skipping offset and
+// returning at most limit (0 for all), plus the total number of matching records
+func (hm *HistoryManager) GetRecordsPage(from, to time.Time, offset, limit int) ([]IndexEntry, int) {
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+
+	// The index is sorted, so binary search the range bounds
+	start := 0
+	if !from.IsZero() {
+		start = sort.Search(len(hm.index), func(i int) bool {
+			return !hm.index[i].Timestamp.Before(from)
+		})
+	}
+	end := len(hm.index)
+	if !to.IsZero() {
+		end = sort.Search(len(hm.index), func(i int) bool {
+			return !hm.index[i].Timestamp.Before(to)
+		})
+	}
+	if end < start {
+		end = start
+	}
+
+	total := end - start
+	start += offset
+	if start > end {
+		start = end
+	}
+	if limit > 0 && start+limit < end {
+		end = start + limit
+	}
+
+	entries := make([]IndexEntry, end-start)
+	copy(entries, hm.index[start:end])
+	return entries, total
+}
+
+// ReadRecords reads the full records of index entries, skipping unreadable ones
+func (hm *HistoryManager) ReadRecords(entries []IndexEntry) []AuditRecord {
+	records := make([]AuditRecord, 0, len(entries))
+	for _, entry := range entries {
+		record, err := hm.readRecord(entry.ID)
+		if err != nil {
+			log.Printf("⚠️ Skipping unreadable history record %s: %v", entry.ID, err)
+			continue
+		}
+		records = append(records, *record)
+	}
+	return records
+}
+
+// Helper functions
+
+func (hm *HistoryManager) indexedCount() int {
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+
+	return len(hm.index)
+}
+
+func (hm *HistoryManager) findEntry(id string) (int, bool) {
+	for i := range hm.index {
+		if hm.index[i].ID == id {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// readIndex reads every entry of the index, sorted by timestamp. An index in the legacy format
+// counts as missing.
+func (hm *HistoryManager) readIndex() ([]IndexEntry, error) {
+	keys, err := hm.store.Keys(hm.buckets.index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list history index: %w", err)
+	}
+
+	entries := make([]IndexEntry, 0, len(keys))
+	for _, key := range keys {
+		if key == legacyHistoryIndexKey {
+			return nil, ErrNotFound
+		}
+
+		data, err := hm.store.Get(hm.buckets.index, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read history index: %w", err)
+		}
+		var entry IndexEntry
+		if err := json.Unmarshal(data, &entry); err != nil || entry.ID != key {
+			return nil, fmt.Errorf("corrupt history index entry %s", key)
+		}
+		entries = append(entries, entry)
+	}
+
+	sortIndex(entries)
+	return entries, nil
+}
+
+func (hm *HistoryManager) rebuildIndex(keys []string) (int, error) {
+	// Drop the old entries, including a legacy whole-index value
+	stale, err := hm.store.Keys(hm.buckets.index)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list history index: %w", err)
+	}
+	for _, key := range stale {
+		if err := hm.store.Delete(hm.buckets.index, key); err != nil && !errors.Is(err, ErrNotFound) {
+			return 0, fmt.Errorf("failed to clear history index: %w", err)
+		}
+	}
+
+	entries := make([]IndexEntry, 0, len(keys))
+	for _, key := range keys {
+		record, err := hm.readRecord(key)
+		if err != nil {
+			log.Printf("⚠️ Skipping unreadable history record %s: %v", key, err)
+			continue
+		}
+		entry := newIndexEntry(record)
+		entry.ID = key
+		if err := hm.saveEntry(entry); err != nil {
+			return 0, err
+		}
+		entries = append(entries, entry)
+	}
+
+	sortIndex(entries)
+	hm.index = entries
+	return len(entries), hm.rebuildRollups()
+}
+
+// indexRecord adds a new record to the index, writing only its own entry
+func (hm *HistoryManager) indexRecord(record AuditRecord) error {
+	entry := newIndexEntry(&record)
+
+	i := sort.Search(len(hm.index), func(i int) bool {
+		return hm.index[i].Timestamp.After(entry.Timestamp)
+	})
+	hm.index = append(hm.index, IndexEntry{})
+	copy(hm.index[i+1:], hm.index[i:])
+	hm.index[i] = entry
+
+	if err := hm.saveEntry(entry); err != nil {
+		return err
+	}
+	return hm.rollupRecord(entry)
+}
+
+// saveEntry writes one index entry; each entry is replaced atomically on its own
+func (hm *HistoryManager) saveEntry(entry IndexEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if err := hm.store.Put(hm.buckets.index, entry.ID, data); err != nil {
+		return fmt.Errorf("failed to save history index: %w", err)
+	}
+
+	return nil
+}
+
+func (hm *HistoryManager) deleteEntry(id string) error {
+	if err := hm.store.Delete(hm.buckets.index, id); err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("failed to update history index: %w", err)
+	}
+	return nil
+}
+
+func sortIndex(entries []IndexEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+}
+
+// indexMatchesKeys reports whether the index has an entry for exactly the stored records. Entries
+// written before sizes were indexed count as stale.
+func indexMatchesKeys(entries []IndexEntry, keys []string) bool {
+	if len(entries) != len(keys) {
+		return false
+	}
+
+	indexed := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		if entry.Size == 0 {
+			return false
+		}
+		indexed[entry.ID] = true
+	}
+	for _, key := range keys {
+		if !indexed[key] {
+			return false
+		}
+	}
+
+	return true
+}
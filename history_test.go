@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCompareWithPrevious(t *testing.T) {
+	hm := newTestHistory(t)
+
+	if _, err := hm.CompareWithPrevious(); !errors.Is(err, ErrNoEarlierAudit) {
+		t.Errorf("CompareWithPrevious() without audits: error = %v, want ErrNoEarlierAudit", err)
+	}
+
+	base := time.Date(2026, 5, 4, 10, 0, 0, 0, time.UTC)
+	saveTestAudit(t, hm, base, "60", "5")
+	if _, err := hm.CompareWithPrevious(); !errors.Is(err, ErrNoEarlierAudit) {
+		t.Errorf("CompareWithPrevious() after one audit: error = %v, want ErrNoEarlierAudit", err)
+	}
+
+	saveTestAudit(t, hm, base.Add(24*time.Hour), "66", "3")
+	comparison, err := hm.CompareWithPrevious()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comparison["score_change"] != 6.0 || comparison["warnings_change"] != -2.0 || comparison["improved"] != true {
+		t.Errorf("CompareWithPrevious() = %v, want the second audit against the first", comparison)
+	}
+	if comparison["previous_date"] != base || comparison["latest_date"] != base.Add(24*time.Hour) {
+		t.Errorf("CompareWithPrevious() compared %v with %v", comparison["latest_date"], comparison["previous_date"])
+	}
+}
+
+func TestGetRecordsPage(t *testing.T) {
+	hm := newTestHistory(t)
+
+	base := time.Date(2026, 5, 4, 10, 0, 0, 0, time.UTC)
+	var ids []string
+	for day := 0; day < 5; day++ {
+		ids = append(ids, saveTestAudit(t, hm, base.AddDate(0, 0, day), "60", "5"))
+	}
+	day := func(n int) time.Time { return base.AddDate(0, 0, n) }
+
+	tests := []struct {
+		name          string
+		from, to      time.Time
+		offset, limit int
+		want          []string
+		total         int
+	}{
+		{name: "everything", want: ids, total: 5},
+		{name: "from is inclusive", from: day(1), want: ids[1:], total: 4},
+		{name: "to is exclusive", to: day(3), want: ids[:3], total: 3},
+		{name: "range", from: day(1), to: day(3), want: ids[1:3], total: 2},
+		{name: "between audits", from: day(1).Add(time.Minute), to: day(2), want: []string{}, total: 0},
+		{name: "offset and limit", offset: 1, limit: 2, want: ids[1:3], total: 5},
+		{name: "offset past the end", from: day(3), offset: 5, want: []string{}, total: 2},
+		{name: "empty range", from: day(3), to: day(1), want: []string{}, total: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, total := hm.GetRecordsPage(tt.from, tt.to, tt.offset, tt.limit)
+			got := []string{}
+			for _, entry := range entries {
+				got = append(got, entry.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) || total != tt.total {
+				t.Errorf("GetRecordsPage() = %v of %d, want %v of %d", got, total, tt.want, tt.total)
+			}
+		})
+	}
+}
+
+func TestGetStorageStats(t *testing.T) {
+	hm := newTestHistory(t)
+
+	base := time.Now().AddDate(0, 0, -100)
+	for day := 0; day < 4; day++ {
+		saveTestAudit(t, hm, base.AddDate(0, 0, day*30), "60", "5")
+	}
+	want := storedHistorySize(t, hm)
+
+	// The oldest audits get compressed, which shrinks them
+	counts, _, err := hm.CleanupOldRecords(RetentionPolicy{CompressAfterDays: 50}, func(time.Time) bool { return false })
+	if err != nil || counts.Compressed != 2 {
+		t.Fatalf("CleanupOldRecords() = %+v, %v, want 2 compressed", counts, err)
+	}
+	compressed := storedHistorySize(t, hm)
+	if compressed >= want {
+		t.Fatalf("compressed records take %d bytes, uncompressed %d", compressed, want)
+	}
+
+	stats, err := hm.GetStorageStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats["total_records"] != 4 || stats["compressed_count"] != 2 || stats["total_size_bytes"] != compressed {
+		t.Errorf("GetStorageStats() = %v, want 4 records, 2 compressed, %d bytes", stats, compressed)
+	}
+
+	// Sizes survive reloading the index
+	reloaded, err := NewHistoryManager(hm.store, localServerID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats, _ := reloaded.GetStorageStats(); stats["total_size_bytes"] != compressed {
+		t.Errorf("after reloading GetStorageStats() = %v, want %d bytes", stats, compressed)
+	}
+}
+
+func newTestHistory(t *testing.T) *HistoryManager {
+	t.Helper()
+
+	store, err := OpenDBStorage(t.TempDir() + "/dashboard.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	hm, err := NewHistoryManager(store, localServerID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hm
+}
+
+func saveTestAudit(t *testing.T, hm *HistoryManager, at time.Time, hardeningIndex, warnings string) string {
+	t.Helper()
+
+	data := map[string]string{"hardening_index": hardeningIndex, "warnings": warnings}
+	id, err := hm.SaveAudit(data, analyzeCompliance(data), at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// storedHistorySize adds up the bytes of every stored record
+func storedHistorySize(t *testing.T, hm *HistoryManager) int64 {
+	t.Helper()
+
+	keys, err := hm.store.Keys(hm.buckets.records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var size int64
+	for _, key := range keys {
+		value, err := hm.store.Get(hm.buckets.records, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size += int64(len(value))
+	}
+	return size
+}
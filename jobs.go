@@ -0,0 +1,484 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	auditJobsBucket     = "audit_jobs"
+	maxQueuedJobs       = 32        // Audits waiting behind the running one, room for a full catch-up
+	maxAuditJobs        = 200       // Finished jobs kept for /api/jobs
+	maxJobOutputBytes   = 256 << 10 // Lynis output kept per job; the tail is kept
+	defaultAuditTimeout = 30 * time.Minute
+	auditKillGrace      = 10 * time.Second // Between SIGTERM and SIGKILL of a stopped audit's process group
+)
+
+var (
+	// ErrQueueFull is returned when too many audits are already waiting
+	ErrQueueFull = errors.New("too many audits queued")
+	// ErrJobFinished is returned when cancelling a job that already ended
+	ErrJobFinished = errors.New("job already finished")
+)
+
+// AuditJob is one local Lynis audit, from the request that triggered it to the history record it stored
+type AuditJob struct {
+	ID             string    `json:"id"`
+	Trigger        string    `json:"trigger"`            // manual, schedule, catch-up or startup
+	Schedule       string    `json:"schedule,omitempty"` // Schedules that fired, for scheduled audits
+	Quiet          bool      `json:"quiet"`
+	State          string    `json:"state"`             // queued, deferred, running, succeeded, failed, cancelled, timed_out
+	Timeout        string    `json:"timeout,omitempty"` // Limit of the Lynis run, e.g. "30m0s"; empty for none
+	QueuedAt       time.Time `json:"queued_at"`
+	DeferredUntil  time.Time `json:"deferred_until,omitempty"` // When maintenance settings let the audit start
+	DeferredReason string    `json:"deferred_reason,omitempty"`
+	StartedAt      time.Time `json:"started_at,omitempty"`
+	FinishedAt     time.Time `json:"finished_at,omitempty"`
+	ExitCode       int       `json:"exit_code"` // -1 when Lynis didn't run
+	Output         string    `json:"output,omitempty"`
+	RecordID       string    `json:"record_id,omitempty"`
+	Error          string    `json:"error,omitempty"`
+}
+
+// JobQueue runs local audits one at a time, so manual and scheduled audits never run Lynis concurrently
+type JobQueue struct {
+	store       Storage
+	recordAudit func(data map[string]string) (string, error) // Stores a report, returning its record ID
+	maintenance *MaintenanceManager                          // Defers audits outside maintenance windows
+	progress    *ProgressHub                                 // Relays running audits to dashboards
+	runner      Runner
+	reportPath  string        // Where finished audits leave their report
+	timeout     time.Duration // Default limit of a Lynis run, 0 for none
+	pending     chan *AuditJob
+	cancels     map[string]context.CancelFunc // Stops the running job
+	mu          sync.Mutex                    // Guards stored jobs and cancels
+}
+
+// NewJobQueue creates the queue and starts its worker. Audits are stopped after
+// UBUNTUSHIELD_AUDIT_TIMEOUT (a duration such as "45m", 0 for no limit, 30 minutes by default).
+// Jobs left unfinished by a previous process are marked failed.
+func NewJobQueue(store Storage, config RunnerConfig, maintenance *MaintenanceManager, progress *ProgressHub, recordAudit func(data map[string]string) (string, error)) (*JobQueue, error) {
+	runner, err := NewRunner(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(config.ReportPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create report directory: %w", err)
+	}
+
+	timeout := defaultAuditTimeout
+	if value := os.Getenv("UBUNTUSHIELD_AUDIT_TIMEOUT"); value != "" {
+		var err error
+		if timeout, err = parseAuditTimeout(value); err != nil {
+			return nil, fmt.Errorf("invalid UBUNTUSHIELD_AUDIT_TIMEOUT: %w", err)
+		}
+	}
+
+	q := &JobQueue{
+		store:       store,
+		recordAudit: recordAudit,
+		maintenance: maintenance,
+		progress:    progress,
+		runner:      runner,
+		reportPath:  config.ReportPath,
+		timeout:     timeout,
+		pending:     make(chan *AuditJob, maxQueuedJobs),
+		cancels:     make(map[string]context.CancelFunc),
+	}
+
+	jobs, err := q.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		if job.State == "queued" || job.State == "deferred" || job.State == "running" {
+			job.State = "failed"
+			job.Error = "interrupted by a dashboard restart"
+			job.FinishedAt = time.Now()
+			if err := q.save(job); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	go q.worker()
+	return q, nil
+}
+
+// Submit queues a local audit with the default timeout and returns its job right away
+func (q *JobQueue) Submit(trigger, schedule string, quiet bool) (*AuditJob, error) {
+	return q.Enqueue(AuditJob{Trigger: trigger, Schedule: schedule, Quiet: quiet}, q.timeout)
+}
+
+// Enqueue queues a local audit described by request's trigger, schedule and quiet fields,
+// stopped after timeout (0 for no limit)
+func (q *JobQueue) Enqueue(request AuditJob, timeout time.Duration) (*AuditJob, error) {
+	job := &AuditJob{
+		ID:       generateID(),
+		Trigger:  request.Trigger,
+		Schedule: request.Schedule,
+		Quiet:    request.Quiet,
+		State:    "queued",
+		QueuedAt: time.Now(),
+		ExitCode: -1,
+	}
+	if timeout > 0 {
+		job.Timeout = timeout.String()
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	select {
+	case q.pending <- job:
+	default:
+		return nil, ErrQueueFull
+	}
+
+	if err := q.save(job); err != nil {
+		return nil, err
+	}
+	q.prune()
+	if err := q.progress.Open(job.ID, localServerID); err != nil {
+		log.Printf("⚠️ Failed to relay progress of audit job %s: %v\n", job.ID, err)
+	}
+	q.progress.State(job.ID, job.State, "")
+
+	// The worker owns job from here on
+	queued := *job
+	log.Printf("📋 Audit job %s queued (%s)\n", job.ID, job.Trigger)
+	return &queued, nil
+}
+
+// Available returns why audits can't run on the dashboard host, e.g. Lynis isn't installed
+func (q *JobQueue) Available() error {
+	return q.runner.Available()
+}
+
+// Get returns a job by ID
+func (q *JobQueue) Get(id string) (*AuditJob, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.load(id)
+}
+
+// Cancel stops a job: a queued or deferred job won't start and a running audit is killed. The job ends as
+// cancelled once its processes are gone.
+func (q *JobQueue) Cancel(id string) (*AuditJob, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, err := q.load(id)
+	if err != nil {
+		return nil, err
+	}
+
+	switch job.State {
+	case "queued", "deferred":
+		// The worker skips it when it comes up
+		job.State = "cancelled"
+		job.Error = "cancelled before it started"
+		job.FinishedAt = time.Now()
+		if err := q.save(job); err != nil {
+			return nil, err
+		}
+		if cancel, ok := q.cancels[id]; ok {
+			cancel()
+		}
+		q.progress.Finish(id, job.State, job.Error, nil)
+	case "running":
+		if cancel, ok := q.cancels[id]; ok {
+			cancel()
+		}
+	default:
+		return job, ErrJobFinished
+	}
+
+	log.Printf("🛑 Audit job %s cancelled\n", id)
+	return job, nil
+}
+
+// List returns all kept jobs, newest first
+func (q *JobQueue) List() ([]*AuditJob, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.list()
+}
+
+// Helper functions
+
+// worker runs queued audits in order; it's the only place Lynis is started from
+func (q *JobQueue) worker() {
+	for job := range q.pending {
+		if !q.awaitMaintenance(job) {
+			continue
+		}
+		ctx, cancel, ok := q.start(job)
+		if !ok {
+			continue
+		}
+		log.Printf("🔍 Starting Lynis audit (job %s, %s) with %s\n", job.ID, job.Trigger, q.runner)
+
+		// Lynis writes next to the report and only a finished audit replaces it, so a stopped audit
+		// can't leave a partial report behind
+		jobReport := q.reportPath + "." + job.ID + ".partial"
+		var output bytes.Buffer
+		lines := &lineWriter{hub: q.progress, auditID: job.ID}
+		exitCode, err := q.runner.Run(ctx, jobReport, job.Quiet, io.MultiWriter(&output, lines))
+		lines.Flush()
+		state := "failed"
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			state = "timed_out"
+			err = fmt.Errorf("Lynis didn't finish within %s", job.Timeout)
+		case errors.Is(err, context.Canceled):
+			state = "cancelled"
+			err = errors.New("cancelled while running")
+		case err == nil:
+			log.Println("✅ Lynis audit completed successfully")
+		}
+
+		var recordID string
+		var summary *AuditSummary
+		if err == nil {
+			var data map[string]string
+			recordID, data, err = q.storeReport(jobReport)
+			if err == nil {
+				state = "succeeded"
+				summary = newAuditSummary(recordID, data)
+			}
+		} else {
+			os.Remove(jobReport)
+		}
+
+		q.mu.Lock()
+		delete(q.cancels, job.ID)
+		q.mu.Unlock()
+		cancel()
+
+		q.update(job, func(job *AuditJob) {
+			job.FinishedAt = time.Now()
+			job.ExitCode = exitCode
+			job.Output = tailOutput(output.Bytes())
+			job.RecordID = recordID
+			job.State = state
+			if err != nil {
+				job.Error = err.Error()
+			}
+		})
+		q.progress.Finish(job.ID, job.State, job.Error, summary)
+
+		if err != nil {
+			log.Printf("❌ Audit job %s %s: %v\n", job.ID, state, err)
+			if !job.Quiet && output.Len() > 0 {
+				log.Printf("Output: %s\n", output.String())
+			}
+		}
+	}
+}
+
+// awaitMaintenance holds a job back while maintenance windows or blackouts rule out audits of the
+// dashboard host, and returns false if it was cancelled meanwhile
+func (q *JobQueue) awaitMaintenance(job *AuditJob) bool {
+	for {
+		check := q.maintenance.Check(localServerID, time.Now())
+		if check.Allowed {
+			return true
+		}
+
+		// Check again at least every minute, since windows and blackouts can change meanwhile
+		wait := time.Minute
+		if !check.NextAllowed.IsZero() && time.Until(check.NextAllowed) < wait {
+			wait = time.Until(check.NextAllowed)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), wait)
+
+		q.mu.Lock()
+		if stored, err := q.load(job.ID); err == nil && stored.State == "cancelled" {
+			q.mu.Unlock()
+			cancel()
+			return false
+		}
+		if job.State != "deferred" || !job.DeferredUntil.Equal(check.NextAllowed) {
+			job.State = "deferred"
+			job.DeferredUntil = check.NextAllowed
+			job.DeferredReason = check.Reason
+			if err := q.save(job); err != nil {
+				log.Printf("⚠️ Failed to save audit job %s: %v\n", job.ID, err)
+			}
+			log.Printf("⏸️ Audit job %s deferred: %s\n", job.ID, check.Reason)
+			q.progress.State(job.ID, job.State, check.Reason)
+		}
+		q.cancels[job.ID] = cancel
+		q.mu.Unlock()
+
+		<-ctx.Done()
+
+		q.mu.Lock()
+		delete(q.cancels, job.ID)
+		q.mu.Unlock()
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return false
+		}
+	}
+}
+
+// start marks a job as running and returns the context that stops it, or false if the job was
+// cancelled while queued
+func (q *JobQueue) start(job *AuditJob) (context.Context, context.CancelFunc, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if stored, err := q.load(job.ID); err == nil && stored.State == "cancelled" {
+		return nil, nil, false
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if timeout, err := time.ParseDuration(job.Timeout); err == nil && timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	}
+	q.cancels[job.ID] = cancel
+
+	job.State = "running"
+	job.StartedAt = time.Now()
+	if err := q.save(job); err != nil {
+		log.Printf("⚠️ Failed to save audit job %s: %v\n", job.ID, err)
+	}
+	q.progress.State(job.ID, job.State, "")
+	return ctx, cancel, true
+}
+
+// storeReport moves the report of a finished audit into place and saves it like any server's audit,
+// returning the record ID and report data
+func (q *JobQueue) storeReport(jobReport string) (string, map[string]string, error) {
+	log.Println("💾 Saving audit results to history...")
+	if err := os.Rename(jobReport, q.reportPath); err != nil {
+		os.Remove(jobReport)
+		return "", nil, fmt.Errorf("failed to install Lynis report: %w", err)
+	}
+
+	data, err := parseLynisReportFile(q.reportPath)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse Lynis report: %w", err)
+	}
+
+	recordID, err := q.recordAudit(data)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to save to history: %w", err)
+	}
+
+	log.Println("✅ Audit results saved to history")
+	if hardening, exists := data["hardening_index"]; exists {
+		log.Printf("📊 Security Score: %s%%\n", hardening)
+	}
+	if warnings, exists := data["warnings"]; exists {
+		log.Printf("⚠️ Warnings: %s\n", warnings)
+	}
+	return recordID, data, nil
+}
+
+// update applies a change to a job and saves it
+func (q *JobQueue) update(job *AuditJob, change func(job *AuditJob)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	change(job)
+	if err := q.save(job); err != nil {
+		log.Printf("⚠️ Failed to save audit job %s: %v\n", job.ID, err)
+	}
+}
+
+// prune removes the oldest finished jobs beyond maxAuditJobs
+func (q *JobQueue) prune() {
+	jobs, err := q.list()
+	if err != nil || len(jobs) <= maxAuditJobs {
+		return
+	}
+
+	// Only jobs that are still waiting or running are kept past the limit
+	for _, job := range jobs[maxAuditJobs:] {
+		switch job.State {
+		case "queued", "deferred", "running":
+		default:
+			q.store.Delete(auditJobsBucket, job.ID)
+		}
+	}
+}
+
+func (q *JobQueue) save(job *AuditJob) error {
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return q.store.Put(auditJobsBucket, job.ID, data)
+}
+
+func (q *JobQueue) load(id string) (*AuditJob, error) {
+	data, err := q.store.Get(auditJobsBucket, id)
+	if err != nil {
+		return nil, fmt.Errorf("job not found: %w", err)
+	}
+
+	var job AuditJob
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+func (q *JobQueue) list() ([]*AuditJob, error) {
+	ids, err := q.store.Keys(auditJobsBucket)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := []*AuditJob{}
+	for _, id := range ids {
+		job, err := q.load(id)
+		if err != nil {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].QueuedAt.After(jobs[j].QueuedAt)
+	})
+
+	return jobs, nil
+}
+
+// parseAuditTimeout parses a timeout such as "45m"; 0 means no limit
+func parseAuditTimeout(value string) (time.Duration, error) {
+	if value == "0" {
+		return 0, nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("%q is not a duration such as 45m or 0 for no limit", value)
+	}
+	return timeout, nil
+}
+
+// tailOutput keeps the end of long output, where Lynis prints its summary
+func tailOutput(output []byte) string {
+	if len(output) > maxJobOutputBytes {
+		output = output[len(output)-maxJobOutputBytes:]
+	}
+	return string(output)
+}
@@ -0,0 +1,25 @@
+//go:build !windows
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup starts a command in a process group of its own, so it can be stopped with its children
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcessGroup sends SIGTERM, or SIGKILL when forced, to a command's process group. SIGCONT
+// follows SIGTERM so processes stopped on terminal input, like sudo asking for a password, see it.
+func killProcessGroup(cmd *exec.Cmd, force bool) error {
+	if force {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+
+	err := syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGCONT)
+	return err
+}
@@ -0,0 +1,11 @@
+package main
+
+import "os/exec"
+
+// setProcessGroup is a no-op on Windows, where Lynis doesn't run
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills the command itself
+func killProcessGroup(cmd *exec.Cmd, force bool) error {
+	return cmd.Process.Kill()
+}
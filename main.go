@@ -2,14 +2,20 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"crypto/subtle"
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"log"
 	"net/http"
 	"os"
-	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -61,73 +67,94 @@ type Control struct {
 
 // SecurityFinding represents a security issue found by Lynis
 type SecurityFinding struct {
-	ID           string   `json:"id"`
-	Title        string   `json:"title"`
-	Description  string   `json:"description"`
-	Severity     string   `json:"severity"`
-	Category     string   `json:"category"`
-	Mappings     []string `json:"mappings"` // CIS controls, ISO controls, etc.
-	FixAvailable bool     `json:"fix_available"`
+	ID           string       `json:"id"`
+	Title        string       `json:"title"`
+	Description  string       `json:"description"`
+	Severity     string       `json:"severity"`
+	Category     string       `json:"category"`
+	Mappings     []string     `json:"mappings"` // CIS controls, ISO controls, etc.
+	FixAvailable bool         `json:"fix_available"`
+	Remediation  string       `json:"remediation"` // Remediation ID, or "manual" when the catalog has no fix
+	RiskScore    float64      `json:"risk_score"`  // 0-100, see risk_factors for the breakdown
+	RiskFactors  []RiskFactor `json:"risk_factors"`
 }
 
 // Remediation represents an automated fix
 type Remediation struct {
-	ID          string `json:"id"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Command     string `json:"command"`
-	Risk        string `json:"risk"`
-	FindingID   string `json:"finding_id"`
+	ID          string   `json:"id"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Command     string   `json:"command"`
+	Risk        string   `json:"risk"`
+	Downtime    string   `json:"downtime"`
+	Verify      []string `json:"verify"`
+	FindingID   string   `json:"finding_id"`
+	Distro      string   `json:"distro"`                // Distribution the command was chosen for
+	Variant     string   `json:"variant,omitempty"`     // Catalog variant used, e.g. "rhel >= 8"
+	Supported   bool     `json:"supported"`             // False when no variant exists for the distribution
+	Unsupported string   `json:"unsupported,omitempty"` // Why no command is available
 }
 
-// parseLynisReport reads and parses the Lynis report file from multiple locations
+// ErrNoAudit means no audit has left a report yet
+var ErrNoAudit = errors.New("no audit yet")
+
+// parseLynisReport reads and parses the report of the latest local audit
 func parseLynisReport() (map[string]string, error) {
-	// Try multiple locations for the Lynis report file
-	reportPaths := []string{
-		"/Users/apple/lynis-report.dat",
-		"/Users/apple/Desktop/untitled folder/untitled folder/lynis-report.dat",
-		"./lynis-report.dat",
-		"/tmp/lynis-report.dat",
-		"/usr/local/var/log/lynis-report.dat",
-		"/var/log/lynis-report.dat",
-		"/usr/share/lynis/lynis-report.dat",
-		os.Getenv("HOME") + "/lynis-report.dat",
-	}
-
-	for _, reportPath := range reportPaths {
-		file, err := os.Open(reportPath)
-		if err != nil {
+	data, err := parseLynisReportFile(runnerConfig.ReportPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s doesn't exist, run an audit first", ErrNoAudit, runnerConfig.ReportPath)
+	}
+	return data, err
+}
+
+// parseLynisReportFile reads and parses one Lynis report file
+func parseLynisReportFile(reportPath string) (map[string]string, error) {
+	file, err := os.Open(reportPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
-		defer file.Close()
-
-		data := make(map[string]string)
-		scanner := bufio.NewScanner(file)
 
-		for scanner.Scan() {
-			line := strings.TrimSpace(scanner.Text())
-			if line == "" || strings.HasPrefix(line, "#") {
-				continue
-			}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) == 2 {
+			key := strings.TrimSpace(parts[0])
+			value := strings.TrimSpace(parts[1])
 
-			parts := strings.SplitN(line, "=", 2)
-			if len(parts) == 2 {
-				key := strings.TrimSpace(parts[0])
-				value := strings.TrimSpace(parts[1])
+			// Keep every entry of array keys like suggestion[], one per line
+			if strings.HasSuffix(key, "[]") && data[key] != "" {
+				data[key] += "\n" + value
+			} else {
 				data[key] = value
 			}
 		}
+	}
 
-		if err := scanner.Err(); err != nil {
-			continue
-		}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
 
-		if len(data) > 0 {
-			return data, nil
-		}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%s is empty", reportPath)
 	}
+	return data, nil
+}
 
-	return nil, fmt.Errorf("No Lynis report file found in any location. Tried: %v", reportPaths)
+// reportArray returns the entries of an array key (e.g. "suggestion" for suggestion[]) from parsed report data
+func reportArray(data map[string]string, key string) []string {
+	value := data[key+"[]"]
+	if value == "" {
+		return []string{}
+	}
+	return strings.Split(value, "\n")
 }
 
 // reportHandler handles the /report API endpoint
@@ -135,6 +162,10 @@ func reportHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	data, err := parseLynisReport()
+	if errors.Is(err, ErrNoAudit) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error parsing report: %v", err), http.StatusInternalServerError)
 		return
@@ -142,8 +173,9 @@ func reportHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Analyze compliance and generate findings
 	complianceScore := analyzeCompliance(data)
-	findings := extractSecurityFindings(data)
-	remediations := generateRemediations(findings)
+	findings := scoredFindings(localServerID, data)
+	remediations := generateRemediations(findings, detectDistro(data, ""))
+	sortFindings(findings, r.URL.Query().Get("sort"))
 
 	report := LynisReport{
 		Data:            data,
@@ -152,15 +184,7 @@ func reportHandler(w http.ResponseWriter, r *http.Request) {
 		Remediations:    remediations,
 	}
 
-	// Save to history automatically (in background, don't block response)
-	go func() {
-		if historyManager != nil {
-			if err := historyManager.SaveAudit(data, complianceScore); err != nil {
-				log.Printf("Warning: Failed to save audit to history: %v", err)
-			}
-		}
-	}()
-
+	// Audits are stored by the job queue that ran them; viewing a report doesn't record it again
 	json.NewEncoder(w).Encode(report)
 }
 
@@ -194,7 +218,7 @@ func multiServerDashboardHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// runAuditHandler handles running Lynis audit
+// runAuditHandler queues a Lynis audit of the dashboard host; follow it at /api/jobs/{id}
 func runAuditHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -204,59 +228,177 @@ func runAuditHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// Check if Lynis is available
-	_, err := exec.LookPath("lynis")
-	if err != nil {
+	if err := auditJobs.Available(); err != nil {
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
-			"error":   "Lynis not found. Please install Lynis first.",
+			"error":   err.Error(),
 		})
 		return
 	}
 
-	// Run Lynis audit in background
-	go func() {
-		log.Println("Starting Lynis audit...")
-
-		// Run the audit
-		cmd := exec.Command("sudo", "lynis", "audit", "system", "--quick")
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			log.Printf("Lynis audit error: %v\nOutput: %s", err, string(output))
+	// ?timeout=45m overrides the default limit for this audit, 0 for none
+	timeout := auditJobs.timeout
+	if value := r.URL.Query().Get("timeout"); value != "" {
+		var err error
+		if timeout, err = parseAuditTimeout(value); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+	}
+
+	job, err := auditJobs.Enqueue(AuditJob{Trigger: "manual"}, timeout)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	message := "Lynis audit queued. This may take a few minutes to complete."
+	if check := maintenanceManager.Check(localServerID, time.Now()); !check.Allowed {
+		message = "Lynis audit queued and deferred: " + check.Reason
+	}
 
-		log.Println("Lynis audit completed")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": message,
+		"job_id":  job.ID,
+		"job":     job,
+		"events":  "/api/jobs/" + job.ID + "/events",
+	})
+}
 
-		// Try to copy the report to the expected location
-		reportPath := "/tmp/lynis-report.dat"
-		targetPath := "/usr/local/var/log/lynis-report.dat"
+// jobsListHandler lists local audit jobs, newest first, optionally filtered by ?state=
+func jobsListHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
 
-		// Create target directory
-		exec.Command("sudo", "mkdir", "-p", "/usr/local/var/log").Run()
+	jobs, err := auditJobs.List()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error listing jobs: %v", err), http.StatusInternalServerError)
+		return
+	}
 
-		// Copy report file
-		if _, err := os.Stat(reportPath); err == nil {
-			copyCmd := exec.Command("sudo", "cp", reportPath, targetPath)
-			if err := copyCmd.Run(); err != nil {
-				log.Printf("Failed to copy report file: %v", err)
-			} else {
-				log.Println("Report file copied successfully")
-			}
+	state := r.URL.Query().Get("state")
+	listed := []*AuditJob{}
+	for _, job := range jobs {
+		if state != "" && job.State != state {
+			continue
 		}
-	}()
+		job.Output = "" // Output is only returned by /api/jobs/{id}
+		listed = append(listed, job)
+	}
 
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"message": "Lynis audit started. This may take a few minutes to complete.",
+		"jobs":  listed,
+		"count": len(listed),
 	})
 }
 
+// jobDetailHandler returns one audit job with its output (GET) or cancels it (DELETE)
+func jobDetailHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	jobID := strings.TrimPrefix(r.URL.Path, "/api/jobs/")
+	if jobID == "" {
+		jobsListHandler(w, r)
+		return
+	}
+	if strings.HasSuffix(jobID, "/events") {
+		jobEventsHandler(w, r, strings.TrimSuffix(jobID, "/events"))
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		job, err := auditJobs.Cancel(jobID)
+		switch {
+		case errors.Is(err, ErrJobFinished):
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"message": fmt.Sprintf("Job already %s", job.State),
+			})
+		case err != nil:
+			http.Error(w, "Job not found", http.StatusNotFound)
+		default:
+			message := "Audit job cancelled"
+			if job.State == "running" {
+				message = "Audit job is being stopped"
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": true,
+				"message": message,
+				"job":     job,
+			})
+		}
+		return
+	}
+
+	job, err := auditJobs.Get(jobID)
+	if err != nil {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(job)
+}
+
+// jobEventsHandler streams the progress of a local audit job as server-sent events, ending with a
+// complete event carrying the new results
+func jobEventsHandler(w http.ResponseWriter, r *http.Request, jobID string) {
+	job, err := auditJobs.Get(jobID)
+	if err != nil {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	lastAudit, after := lastEventID(r)
+	if lastAudit != job.ID {
+		after = 0
+	}
+
+	subscription, err := auditProgress.Subscribe(job.ID, after)
+	if err != nil {
+		// The job ended too long ago, or before a restart; all that's left is its outcome
+		subscription = &AuditSubscription{AuditID: job.ID, Done: true}
+		if after == 0 {
+			subscription.Replay = []AuditEvent{{
+				ID:       1,
+				Type:     eventComplete,
+				AuditID:  job.ID,
+				ServerID: localServerID,
+				Time:     job.FinishedAt,
+				State:    job.State,
+				Error:    job.Error,
+			}}
+		}
+	}
+	defer auditProgress.Unsubscribe(subscription)
+
+	// Nothing new after the complete event; 204 stops EventSource from reconnecting
+	if subscription.Done && len(subscription.Replay) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	flusher, ok := startEventStream(w)
+	if !ok {
+		return
+	}
+	sendAuditEvents(w, r, flusher, subscription)
+}
+
 // complianceProfileHandler handles compliance profile endpoints
 func complianceProfileHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	profile := r.URL.Query().Get("profile")
 
 	data, err := parseLynisReport()
+	if errors.Is(err, ErrNoAudit) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error parsing report: %v", err), http.StatusInternalServerError)
 		return
@@ -306,6 +448,7 @@ func remediateHandler(w http.ResponseWriter, r *http.Request) {
 
 	var request struct {
 		RemediationID string `json:"remediation_id"`
+		DryRun        bool   `json:"dry_run"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
@@ -313,12 +456,79 @@ func remediateHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Execute remediation (simulate for now)
+	entry, ok := getRemediationByID(request.RemediationID)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unknown remediation ID: %s", request.RemediationID), http.StatusBadRequest)
+		return
+	}
+
+	// Without a configured token remediations on the dashboard host are only simulated
+	if remediationToken == "" {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":    true,
+			"simulated":  true,
+			"message":    fmt.Sprintf("Remediation %s applied successfully", request.RemediationID),
+			"applied_at": time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(extractAPIKey(r)), []byte(remediationToken)) != 1 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Like agent jobs, remediations on the dashboard host wait for its maintenance windows and blackouts.
+	// The request can't wait that long, so it's refused with the time to try again.
+	if check := maintenanceManager.Check(localServerID, time.Now()); !check.Allowed {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":     false,
+			"deferred":    true,
+			"maintenance": check,
+			"message":     fmt.Sprintf("Remediation %s not run: %s", request.RemediationID, check.Reason),
+		})
+		return
+	}
+
+	// Run the same bundle the script export produces, so preconditions and backups apply
+	var findings []SecurityFinding
+	var hostname string
+	distro := detectDistro(nil, "")
+	if data, err := parseLynisReport(); err == nil {
+		findings = extractSecurityFindings(data)
+		hostname = data["hostname"]
+		distro = detectDistro(data, "")
+	}
+
+	script, err := buildRemediationScript([]*RemediationCatalogEntry{entry}, findings, hostname, distro)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": fmt.Sprintf("Cannot apply remediation %s: %v", request.RemediationID, err),
+		})
+		return
+	}
+
+	output, exitCode, err := runRemediationScript(script, request.DryRun)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": fmt.Sprintf("Failed to run remediation %s: %v", request.RemediationID, err),
+		})
+		return
+	}
+
 	result := map[string]interface{}{
-		"success":    true,
-		"message":    fmt.Sprintf("Remediation %s applied successfully", request.RemediationID),
+		"success":    exitCode == 0,
+		"dry_run":    request.DryRun,
+		"exit_code":  exitCode,
+		"output":     output,
 		"applied_at": time.Now().Format(time.RFC3339),
 	}
+	if exitCode == 0 {
+		result["message"] = fmt.Sprintf("Remediation %s applied successfully", request.RemediationID)
+	} else {
+		result["message"] = fmt.Sprintf("Remediation %s failed with exit code %d", request.RemediationID, exitCode)
+	}
 
 	json.NewEncoder(w).Encode(result)
 }
@@ -680,43 +890,116 @@ func extractSecurityFindings(data map[string]string) []SecurityFinding {
 		})
 	}
 
+	// Every Lynis warning and suggestion becomes a finding keyed by its test ID
+	findings = append(findings, extractLynisFindings(reportArray(data, "warning"), "high")...)
+	findings = append(findings, extractLynisFindings(reportArray(data, "suggestion"), "low")...)
+
+	// Attach the catalog remediation, or flag the finding for manual follow-up
+	for i := range findings {
+		if entry, ok := getRemediationForFinding(findings[i].ID); ok {
+			findings[i].Remediation = entry.ID
+			findings[i].FixAvailable = true
+		} else {
+			findings[i].Remediation = "manual"
+			findings[i].FixAvailable = false
+		}
+	}
+
+	return findings
+}
+
+// extractLynisFindings converts warning[] or suggestion[] entries (TEST-ID|text|details|solution|) into findings
+func extractLynisFindings(entries []string, defaultSeverity string) []SecurityFinding {
+	var findings []SecurityFinding
+	index := make(map[string]int)
+
+	for _, entry := range entries {
+		parts := strings.Split(entry, "|")
+		testID := strings.TrimSpace(parts[0])
+		if testID == "" {
+			continue
+		}
+
+		text := ""
+		if len(parts) > 1 {
+			text = strings.TrimSpace(parts[1])
+		}
+		if len(parts) > 2 && parts[2] != "-" && parts[2] != "" {
+			text += " (" + strings.TrimSpace(parts[2]) + ")"
+		}
+
+		// Lynis may report the same test several times with different details
+		if i, exists := index[testID]; exists {
+			findings[i].Description += "; " + text
+			continue
+		}
+
+		finding := SecurityFinding{
+			ID:          testID,
+			Title:       text,
+			Description: text,
+			Severity:    defaultSeverity,
+			Category:    lynisCategory(testID),
+			Mappings:    []string{},
+		}
+
+		// The catalog knows more about suggestions than Lynis does
+		if catalogEntry, ok := getRemediationForFinding(testID); ok {
+			if defaultSeverity != "high" && catalogEntry.Severity != "" {
+				finding.Severity = catalogEntry.Severity
+			}
+			if catalogEntry.Category != "" {
+				finding.Category = catalogEntry.Category
+			}
+			finding.Mappings = catalogEntry.Mappings
+		}
+
+		index[testID] = len(findings)
+		findings = append(findings, finding)
+	}
+
 	return findings
 }
 
-// generateRemediations generates automated remediation suggestions
-func generateRemediations(findings []SecurityFinding) []Remediation {
+// lynisCategory derives a finding category from a Lynis test ID prefix
+func lynisCategory(testID string) string {
+	prefix := strings.SplitN(testID, "-", 2)[0]
+
+	switch prefix {
+	case "AUTH", "PAM", "SSH":
+		return "authentication"
+	case "FIRE", "NETW":
+		return "network"
+	case "KRNL", "PROC":
+		return "kernel"
+	case "PKGS":
+		return "packages"
+	case "ACCT", "LOGG":
+		return "accounting"
+	case "FILE", "STRG", "USB", "FINT":
+		return "storage"
+	case "HRDN", "MALW":
+		return "malware"
+	case "BANN":
+		return "banners"
+	default:
+		return strings.ToLower(prefix)
+	}
+}
+
+// generateRemediations generates automated remediation suggestions for the target distribution
+func generateRemediations(findings []SecurityFinding, distro DistroInfo) []Remediation {
 	var remediations []Remediation
 
+	seen := make(map[string]bool)
+
 	for _, finding := range findings {
-		switch finding.ID {
-		case "SSH-001":
-			remediations = append(remediations, Remediation{
-				ID:          "REM-SSH-001",
-				Title:       "Disable SSH Root Login",
-				Description: "Modify SSH configuration to disable direct root login",
-				Command:     "sudo sed -i 's/#PermitRootLogin yes/PermitRootLogin no/' /etc/ssh/sshd_config && sudo systemctl restart ssh",
-				Risk:        "low",
-				FindingID:   finding.ID,
-			})
-		case "NET-001":
-			remediations = append(remediations, Remediation{
-				ID:          "REM-NET-001",
-				Title:       "Enable UFW Firewall",
-				Description: "Enable and configure UFW firewall with basic rules",
-				Command:     "sudo ufw enable && sudo ufw default deny incoming && sudo ufw default allow outgoing && sudo ufw allow ssh",
-				Risk:        "medium",
-				FindingID:   finding.ID,
-			})
-		case "UPD-001":
-			remediations = append(remediations, Remediation{
-				ID:          "REM-UPD-001",
-				Title:       "Enable Automatic Updates",
-				Description: "Install and configure unattended-upgrades for automatic security updates",
-				Command:     "sudo apt update && sudo apt install -y unattended-upgrades && sudo dpkg-reconfigure -plow unattended-upgrades",
-				Risk:        "low",
-				FindingID:   finding.ID,
-			})
+		entry, ok := getRemediationForFinding(finding.ID)
+		if !ok || seen[entry.ID] {
+			continue
 		}
+		seen[entry.ID] = true
+		remediations = append(remediations, entry.ToRemediation(finding.ID, distro))
 	}
 
 	return remediations
@@ -1012,30 +1295,168 @@ func analyzeFISMA(data map[string]string) ComplianceProfile {
 	}
 }
 
-// historyTrendHandler returns trend data for charts
+// historyTrendHandler returns trend data for charts. The range is either ?period=30d ending now or
+// ?from=&to= (RFC3339 or YYYY-MM-DD); ?bucket=6h|1d|1w|raw|auto and ?agg=avg|min|max|last control
+// how records are combined.
 func historyTrendHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	period := r.URL.Query().Get("period")
-	if period == "" {
-		period = "30d"
+	history, ok := historyForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	params := r.URL.Query()
+	query := TrendQuery{Aggregation: params.Get("agg")}
+
+	var err error
+	if query.From, err = parseTrendTime(params.Get("from")); err != nil {
+		http.Error(w, "Invalid 'from' (expected RFC3339 or YYYY-MM-DD)", http.StatusBadRequest)
+		return
+	}
+	if query.To, err = parseTrendTime(params.Get("to")); err != nil {
+		http.Error(w, "Invalid 'to' (expected RFC3339 or YYYY-MM-DD)", http.StatusBadRequest)
+		return
+	}
+
+	period := params.Get("period")
+	if query.From.IsZero() {
+		if period == "" {
+			period = "30d"
+		}
+		duration, err := parseTrendDuration(period)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid 'period': %v", err), http.StatusBadRequest)
+			return
+		}
+		end := query.To
+		if end.IsZero() {
+			end = time.Now()
+		}
+		query.From = end.Add(-duration)
+	} else {
+		period = ""
+	}
+
+	switch bucket := params.Get("bucket"); bucket {
+	case "raw":
+	case "", "auto":
+		end := query.To
+		if end.IsZero() {
+			end = time.Now()
+		}
+		query.Bucket = autoTrendBucket(end.Sub(query.From))
+	default:
+		if query.Bucket, err = parseTrendDuration(bucket); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid 'bucket': %v", err), http.StatusBadRequest)
+			return
+		}
 	}
 
-	trend, err := historyManager.GetTrend(period)
+	trend, err := history.GetTrendRange(query)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting trend: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Error getting trend: %v", err), http.StatusBadRequest)
 		return
 	}
+	trend.Period = period
 
 	json.NewEncoder(w).Encode(trend)
 }
 
+// parseTrendTime parses an RFC3339 timestamp or a plain date; empty means unset
+func parseTrendTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// historyForecastHandler projects a server's scores (?server=<id>, or ?server=fleet for every server).
+// ?method=linear|ewma, ?lookback=90d, ?horizon=30d, ?step=1d, ?target=80 and ?confidence=0.95 tune
+// the forecast.
+func historyForecastHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	query, err := parseForecastQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var forecast *Forecast
+	if r.URL.Query().Get("server") == fleetServerID {
+		servers, err := serverManager.ListServers()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error listing servers: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		var managers []*HistoryManager
+		for _, server := range servers {
+			if history, err := histories.For(server.ID); err == nil {
+				managers = append(managers, history)
+			}
+		}
+		forecast, err = FleetForecast(managers, query)
+	} else {
+		history, ok := historyForRequest(w, r)
+		if !ok {
+			return
+		}
+		forecast, err = history.Forecast(query)
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error forecasting: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	json.NewEncoder(w).Encode(forecast)
+}
+
+// parseForecastQuery reads forecast parameters; anything unset keeps its default
+func parseForecastQuery(r *http.Request) (ForecastQuery, error) {
+	params := r.URL.Query()
+	query := ForecastQuery{Method: params.Get("method")}
+
+	for name, target := range map[string]*time.Duration{"lookback": &query.Lookback, "horizon": &query.Horizon, "step": &query.Step} {
+		if value := params.Get(name); value != "" {
+			duration, err := parseTrendDuration(value)
+			if err != nil {
+				return query, fmt.Errorf("invalid '%s': %v", name, err)
+			}
+			*target = duration
+		}
+	}
+
+	for name, target := range map[string]*float64{"target": &query.Target, "confidence": &query.Confidence} {
+		if value := params.Get(name); value != "" {
+			number, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return query, fmt.Errorf("invalid '%s': %v", name, err)
+			}
+			*target = number
+		}
+	}
+
+	return query, nil
+}
+
 // historyRecordsHandler returns all historical records
 func historyRecordsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
+	history, ok := historyForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+
 	// Parse 'since' parameter (optional)
-	sinceStr := r.URL.Query().Get("since")
+	sinceStr := query.Get("since")
 	var since time.Time
 	if sinceStr != "" {
 		var err error
@@ -1047,174 +1468,1234 @@ func historyRecordsHandler(w http.ResponseWriter, r *http.Request) {
 		since = time.Now().AddDate(0, 0, -30) // Default: 30 days
 	}
 
-	records, err := historyManager.GetRecordsSince(since)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting records: %v", err), http.StatusInternalServerError)
+	// Optional upper bound and paging
+	var until time.Time
+	if untilStr := query.Get("until"); untilStr != "" {
+		var err error
+		until, err = time.Parse(time.RFC3339, untilStr)
+		if err != nil {
+			http.Error(w, "Invalid 'until' timestamp (expected RFC3339)", http.StatusBadRequest)
+			return
+		}
+	}
+	offset, _ := strconv.Atoi(query.Get("offset"))
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if offset < 0 || limit < 0 {
+		http.Error(w, "offset and limit must not be negative", http.StatusBadRequest)
 		return
 	}
 
+	entries, total := history.GetRecordsPage(since, until, offset, limit)
+	records := history.ReadRecords(entries)
+
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"records": records,
 		"count":   len(records),
+		"total":   total,
+		"offset":  offset,
 		"since":   since,
+		"server":  history.serverID,
 	})
 }
 
-// historyCompareHandler compares current with previous audit
-func historyCompareHandler(w http.ResponseWriter, r *http.Request) {
+// historyDiffHandler returns what changed between two audits of a server (?from=<id>&to=<id>, both optional)
+func historyDiffHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	data, err := parseLynisReport()
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error parsing current report: %v", err), http.StatusInternalServerError)
+	history, ok := historyForRequest(w, r)
+	if !ok {
 		return
 	}
 
-	comparison, err := historyManager.CompareWithPrevious(data)
+	diff, err := history.DiffRecords(r.URL.Query().Get("from"), r.URL.Query().Get("to"))
 	if err != nil {
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "No previous audit found for comparison",
-		})
+		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success":    true,
-		"comparison": comparison,
-	})
+	json.NewEncoder(w).Encode(diff)
 }
 
-// historyStatsHandler returns storage statistics
-func historyStatsHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	stats, err := historyManager.GetStorageStats()
+// serverDiffHandler returns what changed between two audits of a server
+func serverDiffHandler(w http.ResponseWriter, r *http.Request, serverID string) {
+	history, err := histories.For(serverID)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting stats: %v", err), http.StatusInternalServerError)
+		http.Error(w, "Server not found", http.StatusNotFound)
 		return
 	}
 
-	json.NewEncoder(w).Encode(stats)
+	diff, err := history.DiffRecords(r.URL.Query().Get("from"), r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(diff)
+}
+
+// chainVerifyHandler verifies the hash chains of a server's audits (?server=<id>, the dashboard host by default)
+func chainVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	serverID := r.URL.Query().Get("server")
+	if serverID == "" {
+		serverID = localServerID
+	}
+
+	report, err := verifyServerChain(serverID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(report)
+}
+
+// verifyServerChain checks both chains kept for a server: its history records and its stored metrics
+func verifyServerChain(serverID string) (*ChainReport, error) {
+	history, err := histories.For(serverID)
+	if err != nil {
+		return nil, fmt.Errorf("server not found: %w", err)
+	}
+
+	report := &ChainReport{
+		ServerID:          serverID,
+		SignaturesChecked: chainSigner != nil,
+		PublicKey:         chainSigner.PublicKey(),
+	}
+	historyPruned, metricsPruned, err := retentionManager.PrunedHashes(serverID)
+	if err != nil {
+		return nil, err
+	}
+	if report.History, err = history.VerifyChain(historyPruned); err != nil {
+		return nil, err
+	}
+	if report.Metrics, err = serverManager.VerifyChain(serverID, metricsPruned); err != nil {
+		return nil, err
+	}
+	report.Valid = report.History.Valid && report.Metrics.Valid
+
+	return report, nil
+}
+
+// regressionsHandler lists regression events (?server=<id>&limit=N)
+func regressionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	events, err := regressionDetector.Events(r.URL.Query().Get("server"), limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error loading regressions: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"events": events,
+		"count":  len(events),
+	})
+}
+
+// regressionRulesHandler shows (GET) or replaces (PUT/POST) the regression rules
+func regressionRulesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(regressionDetector.Rules())
+	case http.MethodPut, http.MethodPost:
+		var rules RegressionRules
+		if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		if err := regressionDetector.SetRules(rules); err != nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"rules":   rules,
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// retentionHandler returns or replaces the retention policies (PUT keeps legal holds)
+func retentionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(retentionManager.Config())
+	case http.MethodPut, http.MethodPost:
+		var config RetentionConfig
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		if err := retentionManager.SetPolicies(config); err != nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":   true,
+			"retention": retentionManager.Config(),
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// retentionPolicyHandler returns the policy and legal holds that apply to ?server=<id>
+func retentionPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	serverID := r.URL.Query().Get("server")
+	if serverID == "" {
+		serverID = localServerID
+	}
+
+	policy, err := retentionManager.PolicyFor(serverID)
+	if err != nil {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(policy)
+}
+
+// retentionHoldsHandler lists (GET), places (POST) and lifts (DELETE ?id=<hold>) legal holds
+func retentionHoldsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"holds": retentionManager.Config().Holds,
+		})
+	case http.MethodPost:
+		var hold LegalHold
+		if err := json.NewDecoder(r.Body).Decode(&hold); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		created, err := retentionManager.AddHold(hold)
+		if err != nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"hold":    created,
+		})
+	case http.MethodDelete:
+		if err := retentionManager.RemoveHold(r.URL.Query().Get("id")); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"message": "Legal hold lifted",
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// maintenanceHandler returns the maintenance windows and blackouts
+func maintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(maintenanceManager.Config())
+}
+
+// maintenanceWindowsHandler lists (GET), adds or replaces by name (POST) and removes (DELETE ?id=)
+// recurring maintenance windows
+func maintenanceWindowsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"windows": maintenanceManager.Config().Windows,
+		})
+	case http.MethodPost:
+		var window MaintenanceWindow
+		if err := json.NewDecoder(r.Body).Decode(&window); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		created, err := maintenanceManager.AddWindow(window)
+		if err != nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"window":  created,
+		})
+	case http.MethodDelete:
+		if err := maintenanceManager.RemoveWindow(r.URL.Query().Get("id")); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"message": "Maintenance window removed",
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// maintenanceBlackoutsHandler lists (GET), adds (POST) and ends (DELETE ?id=) blackout periods
+func maintenanceBlackoutsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"blackouts": maintenanceManager.Config().Blackouts,
+		})
+	case http.MethodPost:
+		var blackout Blackout
+		if err := json.NewDecoder(r.Body).Decode(&blackout); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		created, err := maintenanceManager.AddBlackout(blackout)
+		if err != nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":  true,
+			"blackout": created,
+		})
+	case http.MethodDelete:
+		if err := maintenanceManager.RemoveBlackout(r.URL.Query().Get("id")); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"message": "Blackout ended",
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// maintenanceStatusHandler says whether audits and remediations may run now on ?server=<id>, or on
+// every server
+func maintenanceStatusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	now := time.Now()
+	if serverID := r.URL.Query().Get("server"); serverID != "" {
+		if _, err := serverManager.GetServer(serverID); err != nil {
+			http.Error(w, "Server not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(maintenanceManager.Check(serverID, now))
+		return
+	}
+
+	servers, err := serverManager.ListServers()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error listing servers: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	checks := []MaintenanceCheck{}
+	for _, server := range servers {
+		checks = append(checks, maintenanceManager.Check(server.ID, now))
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"servers": checks,
+	})
+}
+
+// retentionRunHandler applies retention now to ?server=<id>, or to every server
+func retentionRunHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var runs []*RetentionRun
+	if serverID := r.URL.Query().Get("server"); serverID != "" {
+		run, err := retentionManager.Run(serverID)
+		if run == nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		runs = []*RetentionRun{run}
+	} else {
+		var err error
+		if runs, err = retentionManager.RunAll(); err != nil {
+			http.Error(w, fmt.Sprintf("Error applying retention: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"runs":    runs,
+	})
+}
+
+// retentionRunsHandler lists logged retention runs (?server=<id>&limit=N)
+func retentionRunsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	runs, err := retentionManager.Runs(r.URL.Query().Get("server"), limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error loading retention runs: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"runs":  runs,
+		"count": len(runs),
+	})
+}
+
+// historyReportHandler returns the complete report captured with a history record
+func historyReportHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	history, ok := historyForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Record id is required (?id=audit_2006-01-02_15-04-05)", http.StatusBadRequest)
+		return
+	}
+
+	record, data, err := history.GetFullReport(id)
+	if record == nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"record":  record,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"record":  record,
+		"report":  data,
+	})
+}
+
+// historyReindexHandler rebuilds the history index from the stored records
+func historyReindexHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	history, ok := historyForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	count, err := history.RebuildIndex()
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"records": count,
+	})
+}
+
+// archiveExportHandler downloads every history record, snapshot, server and metric as one archive
+func archiveExportHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=ubuntushield-archive-%s.tar.gz", time.Now().Format("20060102-150405")))
+
+	if _, err := ExportArchive(dataStore, w); err != nil {
+		// Headers are already sent, so all we can do is log and cut the download short
+		log.Printf("❌ Archive export failed: %v", err)
+	}
+}
+
+// archiveImportHandler merges an uploaded archive (?dry_run=true only reports what would change)
+func archiveImportHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Accept the archive as the raw body or as a multipart "archive" file
+	r.Body = http.MaxBytesReader(w, r.Body, maxArchiveSize)
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("archive")
+		if err != nil {
+			http.Error(w, "Missing 'archive' file", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+	report, err := ImportArchive(dataStore, body, dryRun)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": err.Error(),
+			"report":  report,
+		})
+		return
+	}
+
+	// Imported records only show up in queries once they are indexed
+	if !dryRun && report.Categories["history"].Added > 0 {
+		if err := histories.RebuildAll(); err != nil {
+			log.Printf("⚠️ Failed to reindex history after import: %v", err)
+		}
+	}
+	if !dryRun && report.Categories["jobs"].Added > 0 {
+		serverManager.ReloadDispatchedJobs()
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"report":  report,
+	})
+}
+
+// historyCompareHandler compares a server's newest audit with the one before it
+func historyCompareHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	history, ok := historyForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	comparison, err := history.CompareWithPrevious()
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "No previous audit found for comparison",
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"comparison": comparison,
+	})
+}
+
+// historyStatsHandler returns storage statistics
+func historyStatsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	history, ok := historyForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	stats, err := history.GetStorageStats()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error getting stats: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(stats)
+}
+
+// schedulerStatusHandler returns scheduler status
+func schedulerStatusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	status := auditScheduler.GetStatus()
+	json.NewEncoder(w).Encode(status)
+}
+
+// schedulerConfigHandler updates scheduler configuration
+func schedulerConfigHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodGet {
+		// Return current config
+		config := auditScheduler.GetStatus()
+		json.NewEncoder(w).Encode(config)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Update config
+	var request struct {
+		Enabled      bool            `json:"enabled"`
+		Interval     string          `json:"interval"`  // "hourly", "daily", "weekly", "monthly" or a cron expression
+		Schedules    []AuditSchedule `json:"schedules"` // Named cron schedules, replacing the current ones
+		RunOnStartup bool            `json:"run_on_startup"`
+		QuietMode    bool            `json:"quiet_mode"`
+		CatchUp      string          `json:"catch_up"` // "once", "skip" or "all" runs missed while down
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	// Keep the current schedules and catch-up policy unless new ones are given
+	config := auditScheduler.Config()
+	config.Enabled = request.Enabled
+	config.RunOnStartup = request.RunOnStartup
+	config.QuietMode = request.QuietMode
+	if request.CatchUp != "" {
+		config.CatchUp = request.CatchUp
+	}
+
+	switch {
+	case len(request.Schedules) > 0:
+		config.Schedules = request.Schedules
+	case request.Interval != "":
+		config.Schedules = []AuditSchedule{{Name: "default", Cron: request.Interval}}
+	}
+
+	if err := auditScheduler.UpdateConfig(config); err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Scheduler configuration updated",
+		"config":  auditScheduler.GetStatus(),
+	})
+}
+
+// schedulerSchedulesHandler lists (GET), adds or replaces by name (POST) and removes (DELETE ?name=)
+// named audit schedules
+func schedulerSchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	config := auditScheduler.Config()
+
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"schedules": auditScheduler.GetStatus()["schedules"],
+		})
+		return
+	case http.MethodPost:
+		var schedule AuditSchedule
+		if err := json.NewDecoder(r.Body).Decode(&schedule); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		replaced := false
+		for i := range config.Schedules {
+			if config.Schedules[i].Name == schedule.Name {
+				config.Schedules[i] = schedule
+				replaced = true
+			}
+		}
+		if !replaced {
+			config.Schedules = append(config.Schedules, schedule)
+		}
+	case http.MethodDelete:
+		name := r.URL.Query().Get("name")
+		kept := []AuditSchedule{}
+		for _, schedule := range config.Schedules {
+			if schedule.Name != name {
+				kept = append(kept, schedule)
+			}
+		}
+		if len(kept) == len(config.Schedules) {
+			http.Error(w, fmt.Sprintf("Schedule %q not found", name), http.StatusNotFound)
+			return
+		}
+		config.Schedules = kept
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := auditScheduler.UpdateConfig(config); err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"schedules": auditScheduler.GetStatus()["schedules"],
+	})
+}
+
+// agentRegisterHandler handles agent registration
+func agentRegisterHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req struct {
+		Hostname     string `json:"hostname"`
+		IPAddress    string `json:"ip_address"`
+		OS           string `json:"os"`
+		Arch         string `json:"arch"`
+		AgentVersion string `json:"agent_version"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	// Register the server
+	server, err := serverManager.RegisterServer(
+		req.Hostname,
+		req.IPAddress,
+		req.OS,
+		req.Arch,
+		req.AgentVersion,
+	)
+	if err != nil {
+		log.Printf("Failed to register server: %v", err)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "Failed to register server: " + err.Error(),
+		})
+		return
+	}
+
+	log.Printf("✅ New server registered: %s (%s)", server.Hostname, server.ID)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"server_id":  server.ID,
+		"api_key":    server.APIKey,
+		"public_key": chainSigner.PublicKey(), // Agents pin it to check remediation jobs
+		"message":    "Server registered successfully",
+	})
+}
+
+// agentHeartbeatHandler handles agent heartbeats
+func agentHeartbeatHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// Authenticate agent
+	apiKey := extractAPIKey(r)
+	if apiKey == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	server, err := serverManager.GetServerByAPIKey(apiKey)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Update heartbeat
+	if err := serverManager.UpdateHeartbeat(server.ID); err != nil {
+		log.Printf("Failed to update heartbeat for %s: %v", server.ID, err)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "Failed to update heartbeat",
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Heartbeat received",
+	})
+}
+
+// agentMetricsHandler handles agent metrics submission
+func agentMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// Authenticate agent
+	apiKey := extractAPIKey(r)
+	if apiKey == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	server, err := serverManager.GetServerByAPIKey(apiKey)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Parse metrics
+	var metrics ServerMetrics
+	if err := json.NewDecoder(r.Body).Decode(&metrics); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	// Ensure server ID matches
+	metrics.ServerID = server.ID
+
+	// Save metrics, ending the live progress of the audit that produced them
+	relayed := metrics.AuditID != "" && auditProgress.Open(metrics.AuditID, server.ID) == nil
+	if err := recordAudit(&metrics); err != nil {
+		log.Printf("Failed to save metrics for %s: %v", server.ID, err)
+		message := "Failed to save metrics"
+		if errors.Is(err, ErrOutOfOrder) {
+			message = "Failed to save metrics: the audit is older than the newest one stored for this server"
+		}
+		if relayed {
+			auditProgress.Finish(metrics.AuditID, "failed", message, nil)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": message,
+		})
+		return
+	}
+	if relayed {
+		auditProgress.Finish(metrics.AuditID, "succeeded", "", newAuditSummary(metrics.ID, metrics.RawData))
+	}
+
+	log.Printf("📊 Received metrics from %s: Score=%s%%, Warnings=%s",
+		server.Hostname, metrics.HardeningIndex, metrics.Warnings)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Metrics received",
+	})
+}
+
+// agentAuditProgressHandler relays the output of an audit an agent is running to dashboards following
+// it. The agent's metrics submission for the audit completes it.
+func agentAuditProgressHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// Authenticate agent
+	apiKey := extractAPIKey(r)
+	if apiKey == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	server, err := serverManager.GetServerByAPIKey(apiKey)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var progress struct {
+		AuditID string   `json:"audit_id"`
+		State   string   `json:"state"` // running when the audit starts, failed when it ends without results
+		Lines   []string `json:"lines"`
+		Error   string   `json:"error"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&progress); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := auditProgress.Open(progress.AuditID, server.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if progress.State == "running" {
+		auditProgress.State(progress.AuditID, progress.State, "")
+	}
+	auditProgress.Output(progress.AuditID, progress.Lines...)
+	if progress.State == "failed" {
+		auditProgress.Finish(progress.AuditID, progress.State, progress.Error, nil)
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+	})
+}
+
+// serverEventsHandler streams the progress of a server's audits as server-sent events: the running or
+// last audit, or else the next one to start
+func serverEventsHandler(w http.ResponseWriter, r *http.Request, serverID string) {
+	if _, err := serverManager.GetServer(serverID); err != nil {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+
+	flusher, ok := startEventStream(w)
+	if !ok {
+		return
+	}
+
+	lastAudit, after := lastEventID(r)
+	for {
+		ctx, cancel := context.WithTimeout(r.Context(), eventKeepAlive)
+		subscription, err := auditProgress.Follow(ctx, serverID, lastAudit, after)
+		cancel()
+		if err == nil {
+			sendAuditEvents(w, r, flusher, subscription)
+			auditProgress.Unsubscribe(subscription)
+			return
+		}
+		if r.Context().Err() != nil {
+			return
+		}
+
+		fmt.Fprint(w, ": waiting for an audit\n\n")
+		flusher.Flush()
+	}
+}
+
+// startEventStream sends the headers of a server-sent event stream
+func startEventStream(w http.ResponseWriter) (http.Flusher, bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Keep reverse proxies from holding events back
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	return flusher, true
+}
+
+// sendAuditEvents writes a subscription's events until the audit completes, the subscriber falls
+// behind or the client goes away
+func sendAuditEvents(w http.ResponseWriter, r *http.Request, flusher http.Flusher, subscription *AuditSubscription) {
+	for _, event := range subscription.Replay {
+		writeAuditEvent(w, event)
+	}
+	flusher.Flush()
+	if subscription.Done {
+		return
+	}
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case event, ok := <-subscription.Events:
+			if !ok {
+				return
+			}
+			writeAuditEvent(w, event)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeAuditEvent writes one server-sent event. Its ID names the audit, so a reconnecting client
+// resumes the right one.
+func writeAuditEvent(w http.ResponseWriter, event AuditEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "id: %s:%d\nevent: %s\ndata: %s\n\n", event.AuditID, event.ID, event.Type, data)
+}
+
+// lastEventID parses the Last-Event-ID header (or ?last_event_id=) of a reconnecting client into the
+// audit and the last event it saw
+func lastEventID(r *http.Request) (string, int) {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("last_event_id")
+	}
+
+	i := strings.LastIndex(value, ":")
+	if i < 0 {
+		return "", 0
+	}
+	after, err := strconv.Atoi(value[i+1:])
+	if err != nil {
+		return "", 0
+	}
+	return value[:i], after
 }
 
-// schedulerStatusHandler returns scheduler status
-func schedulerStatusHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+// serversListHandler lists all servers
+func serversListHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	servers, err := serverManager.ListServers()
+	if err != nil {
+		http.Error(w, "Failed to list servers", http.StatusInternalServerError)
+		return
+	}
+
+	// Get latest metrics for each server
+	type ServerWithMetrics struct {
+		*ServerInfo
+		LatestMetrics *ServerMetrics `json:"latest_metrics,omitempty"`
+	}
+
+	serversWithMetrics := make([]ServerWithMetrics, 0, len(servers))
+	for _, server := range servers {
+		swm := ServerWithMetrics{ServerInfo: server}
+
+		// Try to get latest metrics
+		if metrics, err := serverManager.GetLatestMetrics(server.ID); err == nil {
+			swm.LatestMetrics = metrics
+		}
+
+		serversWithMetrics = append(serversWithMetrics, swm)
+	}
+
+	// Get dashboard stats
+	stats, _ := serverManager.GetDashboardStats()
 
-	status := auditScheduler.GetStatus()
-	json.NewEncoder(w).Encode(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"servers": serversWithMetrics,
+		"stats":   stats,
+		"count":   len(servers),
+	})
 }
 
-// schedulerConfigHandler updates scheduler configuration
-func schedulerConfigHandler(w http.ResponseWriter, r *http.Request) {
+// serversDetailHandler handles individual server details
+func serversDetailHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	if r.Method == http.MethodGet {
-		// Return current config
-		config := auditScheduler.GetStatus()
-		json.NewEncoder(w).Encode(config)
+	// Extract server ID from URL
+	serverID := strings.TrimPrefix(r.URL.Path, "/api/servers/")
+	if serverID == "" {
+		http.Error(w, "Server ID required", http.StatusBadRequest)
 		return
 	}
 
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	// Route sub-resources: /api/servers/{id}/{resource}
+	if parts := strings.SplitN(serverID, "/", 2); len(parts) == 2 {
+		serverID = parts[0]
+		switch parts[1] {
+		case "remediations":
+			serverRemediationsHandler(w, r, serverID)
+		case "diff":
+			serverDiffHandler(w, r, serverID)
+		case "events":
+			serverEventsHandler(w, r, serverID)
+		default:
+			http.Error(w, "Not found", http.StatusNotFound)
+		}
 		return
 	}
 
-	// Update config
-	var request struct {
-		Enabled      bool   `json:"enabled"`
-		Interval     string `json:"interval"` // "hourly", "daily", "weekly", "monthly"
-		RunOnStartup bool   `json:"run_on_startup"`
-		QuietMode    bool   `json:"quiet_mode"`
-	}
+	// Update server settings
+	if r.Method == http.MethodPatch || r.Method == http.MethodPut {
+		var request struct {
+			Criticality *string   `json:"criticality"`
+			Tags        *[]string `json:"tags"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
 
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		server, err := serverManager.GetServer(serverID)
+		if err == nil && request.Criticality != nil {
+			server, err = serverManager.SetCriticality(serverID, *request.Criticality)
+		}
+		if err == nil && request.Tags != nil {
+			server, err = serverManager.SetTags(serverID, *request.Tags)
+		}
+		if err != nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"server":  server,
+		})
 		return
 	}
 
-	// Parse interval
-	var config SchedulerConfig
-	config.Enabled = request.Enabled
-	config.RunOnStartup = request.RunOnStartup
-	config.QuietMode = request.QuietMode
-
-	switch request.Interval {
-	case "hourly":
-		config.Interval = 1 * time.Hour
-	case "daily":
-		config.Interval = 24 * time.Hour
-	case "weekly":
-		config.Interval = 7 * 24 * time.Hour
-	case "monthly":
-		config.Interval = 30 * 24 * time.Hour
-	default:
-		config.Interval = 24 * time.Hour // Default to daily
+	// Get server info
+	server, err := serverManager.GetServer(serverID)
+	if err != nil {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
 	}
 
-	auditScheduler.UpdateConfig(config)
+	// Get metrics history (last 30 audits)
+	metrics, err := serverManager.GetServerMetrics(serverID, 30)
+	if err != nil {
+		metrics = []*ServerMetrics{}
+	}
 
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"message": "Scheduler configuration updated",
-		"config":  auditScheduler.GetStatus(),
+		"server":  server,
+		"metrics": metrics,
+		"count":   len(metrics),
 	})
 }
 
-// agentRegisterHandler handles agent registration
-func agentRegisterHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// serverRemediationsHandler queues and lists remediation jobs for a remote server
+func serverRemediationsHandler(w http.ResponseWriter, r *http.Request, serverID string) {
+	if _, err := serverManager.GetServer(serverID); err != nil {
+		http.Error(w, "Server not found", http.StatusNotFound)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-
-	var req struct {
-		Hostname     string `json:"hostname"`
-		IPAddress    string `json:"ip_address"`
-		OS           string `json:"os"`
-		Arch         string `json:"arch"`
-		AgentVersion string `json:"agent_version"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+	// No agent polls for the dashboard host's jobs
+	if serverID == localServerID {
+		http.Error(w, "The local host is remediated through /remediate", http.StatusBadRequest)
 		return
 	}
 
-	// Register the server
-	server, err := serverManager.RegisterServer(
-		req.Hostname,
-		req.IPAddress,
-		req.OS,
-		req.Arch,
-		req.AgentVersion,
-	)
-	if err != nil {
-		log.Printf("Failed to register server: %v", err)
+	switch r.Method {
+	case http.MethodGet:
+		jobs, err := serverManager.ListRemediationJobs(serverID)
+		if err != nil {
+			http.Error(w, "Failed to list remediation jobs", http.StatusInternalServerError)
+			return
+		}
+
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "Failed to register server: " + err.Error(),
+			"jobs":  jobs,
+			"count": len(jobs),
 		})
-		return
-	}
 
-	log.Printf("✅ New server registered: %s (%s)", server.Hostname, server.ID)
+	case http.MethodPost:
+		var request struct {
+			RemediationIDs []string `json:"remediation_ids"`
+			DryRun         bool     `json:"dry_run"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
 
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success":   true,
-		"server_id": server.ID,
-		"api_key":   server.APIKey,
-		"message":   "Server registered successfully",
-	})
+		if len(request.RemediationIDs) == 0 {
+			http.Error(w, "At least one remediation ID is required", http.StatusBadRequest)
+			return
+		}
+
+		var entries []*RemediationCatalogEntry
+		for _, id := range request.RemediationIDs {
+			entry, ok := getRemediationByID(id)
+			if !ok {
+				http.Error(w, fmt.Sprintf("Unknown remediation ID: %s", id), http.StatusBadRequest)
+				return
+			}
+			entries = append(entries, entry)
+		}
+
+		job, err := serverManager.QueueRemediationJob(serverID, entries, request.DryRun)
+		if err != nil {
+			log.Printf("Failed to queue remediation job for %s: %v", serverID, err)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"message": "Failed to queue remediation job: " + err.Error(),
+			})
+			return
+		}
+
+		log.Printf("🔧 Queued remediation job %s for %s: %v", job.ID, serverID, job.RemediationIDs)
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"job":     job,
+			"message": "Remediation job queued. It will run on the agent's next poll.",
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
 }
 
-// agentHeartbeatHandler handles agent heartbeats
-func agentHeartbeatHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+// agentJobsHandler hands queued remediation jobs to an agent
+func agentJobsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
@@ -1234,24 +2715,39 @@ func agentHeartbeatHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Update heartbeat
-	if err := serverManager.UpdateHeartbeat(server.ID); err != nil {
-		log.Printf("Failed to update heartbeat for %s: %v", server.ID, err)
+	// Outside maintenance windows remediations and audits wait; the agent defers its own audits too
+	check := maintenanceManager.Check(server.ID, time.Now())
+	if !check.Allowed {
+		if err := serverManager.DeferRemediationJobs(server.ID, check); err != nil {
+			log.Printf("Failed to defer jobs for %s: %v", server.ID, err)
+		}
+
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "Failed to update heartbeat",
+			"success":     true,
+			"jobs":        []*RemediationJob{},
+			"run_audit":   false,
+			"maintenance": check,
 		})
 		return
 	}
 
+	jobs, err := serverManager.DispatchRemediationJobs(server.ID)
+	if err != nil {
+		log.Printf("Failed to dispatch jobs for %s: %v", server.ID, err)
+		http.Error(w, "Failed to load jobs", http.StatusInternalServerError)
+		return
+	}
+
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"message": "Heartbeat received",
+		"success":     true,
+		"jobs":        jobs,
+		"run_audit":   server.AuditRequested,
+		"maintenance": check,
 	})
 }
 
-// agentMetricsHandler handles agent metrics submission
-func agentMetricsHandler(w http.ResponseWriter, r *http.Request) {
+// agentJobResultHandler records the outcome of a remediation job run by an agent
+func agentJobResultHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -1272,102 +2768,214 @@ func agentMetricsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse metrics
-	var metrics ServerMetrics
-	if err := json.NewDecoder(r.Body).Decode(&metrics); err != nil {
+	var result struct {
+		JobID    string `json:"job_id"`
+		ExitCode int    `json:"exit_code"`
+		Output   string `json:"output"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&result); err != nil || result.JobID == "" {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
 
-	// Ensure server ID matches
-	metrics.ServerID = server.ID
-
-	// Save metrics
-	if err := serverManager.SaveMetrics(&metrics); err != nil {
-		log.Printf("Failed to save metrics for %s: %v", server.ID, err)
+	job, err := serverManager.CompleteRemediationJob(server.ID, result.JobID, result.ExitCode, result.Output)
+	if err != nil {
+		log.Printf("Failed to record job result for %s: %v", server.ID, err)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
-			"message": "Failed to save metrics",
+			"message": "Failed to record job result: " + err.Error(),
 		})
 		return
 	}
 
-	log.Printf("📊 Received metrics from %s: Score=%s%%, Warnings=%s",
-		server.Hostname, metrics.HardeningIndex, metrics.Warnings)
+	log.Printf("🔧 Remediation job %s on %s finished: %s (exit %d)", job.ID, server.Hostname, job.Status, job.ExitCode)
 
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"message": "Metrics received",
+		"success":   true,
+		"message":   "Job result recorded",
+		"run_audit": !job.DryRun,
 	})
 }
 
-// serversListHandler lists all servers
-func serversListHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	servers, err := serverManager.ListServers()
-	if err != nil {
-		http.Error(w, "Failed to list servers", http.StatusInternalServerError)
-		return
+// recordAudit stores an audit of any server, the dashboard host included, and updates what is
+// derived from it: the server's history, finding lifecycles and regression events
+func recordAudit(metrics *ServerMetrics) error {
+	if metrics.ComplianceScore == nil {
+		metrics.ComplianceScore = make(map[string]interface{})
+		for framework, profile := range analyzeCompliance(metrics.RawData).Profiles() {
+			metrics.ComplianceScore[framework] = profile.Score
+		}
 	}
 
-	// Get latest metrics for each server
-	type ServerWithMetrics struct {
-		*ServerInfo
-		LatestMetrics *ServerMetrics `json:"latest_metrics,omitempty"`
+	if err := serverManager.SaveMetrics(metrics); err != nil {
+		return err
 	}
 
-	serversWithMetrics := make([]ServerWithMetrics, 0, len(servers))
-	for _, server := range servers {
-		swm := ServerWithMetrics{ServerInfo: server}
-		
-		// Try to get latest metrics
-		if metrics, err := serverManager.GetLatestMetrics(server.ID); err == nil {
-			swm.LatestMetrics = metrics
-		}
-
-		serversWithMetrics = append(serversWithMetrics, swm)
+	if history, err := histories.For(metrics.ServerID); err != nil {
+		log.Printf("⚠️ Failed to load history of %s: %v", metrics.ServerID, err)
+	} else if recordID, err := history.SaveAudit(metrics.RawData, analyzeCompliance(metrics.RawData), metrics.Timestamp); err != nil {
+		log.Printf("⚠️ Failed to save audit of %s to history: %v", metrics.ServerID, err)
+	} else {
+		// Compare with the audit before it, which isn't the newest one when submissions arrive out of order
+		regressionDetector.Observe(history.DiffRecords("", recordID))
 	}
 
-	// Get dashboard stats
-	stats, _ := serverManager.GetDashboardStats()
+	// Track finding lifecycles for this server
+	if err := findingsStore.ProcessAudit(metrics.ServerID, extractSecurityFindings(metrics.RawData), metrics.Timestamp); err != nil {
+		log.Printf("⚠️ Failed to update findings for %s: %v", metrics.ServerID, err)
+	}
 
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"servers": serversWithMetrics,
-		"stats":   stats,
-		"count":   len(servers),
-	})
+	return nil
 }
 
-// serversDetailHandler handles individual server details
-func serversDetailHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+// recordLocalAudit stores a report of the dashboard host the same way as an agent submission and
+// returns its record ID
+func recordLocalAudit(data map[string]string) (string, error) {
+	metrics := &ServerMetrics{
+		ServerID:       localServerID,
+		Timestamp:      time.Now(),
+		HardeningIndex: data["hardening_index"],
+		Warnings:       data["warnings"],
+		TestsPerformed: data["lynis_tests_done"],
+		RawData:        data,
+	}
+	if err := recordAudit(metrics); err != nil {
+		return "", err
+	}
+	return metrics.ID, nil
+}
 
-	// Extract server ID from URL
-	serverID := strings.TrimPrefix(r.URL.Path, "/api/servers/")
+// historyForRequest returns the history of ?server=<id>, the dashboard host by default
+func historyForRequest(w http.ResponseWriter, r *http.Request) (*HistoryManager, bool) {
+	serverID := r.URL.Query().Get("server")
 	if serverID == "" {
-		http.Error(w, "Server ID required", http.StatusBadRequest)
-		return
+		serverID = localServerID
 	}
 
-	// Get server info
-	server, err := serverManager.GetServer(serverID)
+	history, err := histories.For(serverID)
 	if err != nil {
 		http.Error(w, "Server not found", http.StatusNotFound)
-		return
+		return nil, false
 	}
 
-	// Get metrics history (last 30 audits)
-	metrics, err := serverManager.GetServerMetrics(serverID, 30)
+	return history, true
+}
+
+// latestReportData returns the most recent report fields for a server (local or agent)
+func latestReportData(serverID string) (map[string]string, error) {
+	if serverID == localServerID {
+		return parseLynisReport()
+	}
+
+	metrics, err := serverManager.GetLatestMetrics(serverID)
 	if err != nil {
-		metrics = []*ServerMetrics{}
+		return nil, err
+	}
+	return metrics.RawData, nil
+}
+
+// serverCriticality returns the configured criticality of a server
+func serverCriticality(serverID string) string {
+	if server, err := serverManager.GetServer(serverID); err == nil {
+		return normalizeCriticality(server.Criticality)
 	}
+	return normalizeCriticality("")
+}
+
+// scoredFindings extracts findings from report data and scores their risk for a server
+func scoredFindings(serverID string, data map[string]string) []SecurityFinding {
+	findings := extractSecurityFindings(data)
+
+	applyRiskScores(findings, newRiskContext(data, serverCriticality(serverID)), func(findingID string) time.Time {
+		if record, err := findingsStore.Get(serverID, findingID); err == nil && record.Status != "resolved" {
+			return record.FirstSeen
+		}
+		return time.Time{}
+	})
+
+	return findings
+}
+
+// findingsHandler lists finding lifecycles and updates their status or assignee
+func findingsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		filter := FindingsFilter{
+			ServerID: query.Get("server"),
+			Status:   query.Get("status"),
+			Severity: query.Get("severity"),
+			Assignee: query.Get("assignee"),
+		}
+
+		records, err := findingsStore.Query(filter)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error querying findings: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		// Score open findings against each server's latest report
+		contexts := make(map[string]RiskContext)
+		for _, record := range records {
+			if record.Status == "resolved" {
+				continue
+			}
+
+			ctx, exists := contexts[record.ServerID]
+			if !exists {
+				data, _ := latestReportData(record.ServerID)
+				ctx = newRiskContext(data, serverCriticality(record.ServerID))
+				contexts[record.ServerID] = ctx
+			}
+
+			record.RiskScore, record.RiskFactors = scoreRisk(record.Severity, record.Category, record.FirstSeen, ctx)
+		}
+
+		if query.Get("sort") == "risk" {
+			sort.SliceStable(records, func(i, j int) bool {
+				return records[i].RiskScore > records[j].RiskScore
+			})
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"findings": records,
+			"count":    len(records),
+		})
+
+	case http.MethodPost, http.MethodPatch:
+		var request struct {
+			ServerID  string  `json:"server_id"`
+			FindingID string  `json:"finding_id"`
+			Status    *string `json:"status"`
+			Assignee  *string `json:"assignee"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.FindingID == "" {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		if request.ServerID == "" {
+			request.ServerID = localServerID
+		}
+
+		record, err := findingsStore.Update(request.ServerID, request.FindingID, request.Status, request.Assignee)
+		if err != nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"finding": record,
+		})
 
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"server":  server,
-		"metrics": metrics,
-		"count":   len(metrics),
-	})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
 }
 
 // extractAPIKey extracts API key from Authorization header
@@ -1389,33 +2997,33 @@ func extractAPIKey(r *http.Request) string {
 // analysisAPIHandler returns the local system's Lynis analysis as JSON
 func analysisAPIHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	
+
 	// Check if full data is requested
 	fullData := r.URL.Query().Get("full") == "true"
-	
+
 	// Parse the Lynis report
 	data, err := parseLynisReport()
 	if err != nil {
 		// Return empty data if file not found
 		json.NewEncoder(w).Encode(map[string]string{
-			"error": "No Lynis report found",
+			"error":           "No Lynis report found",
 			"hardening_index": "0",
 			"tests_performed": "0",
-			"warnings": "0",
-			"suggestions": "0",
+			"warnings":        "0",
+			"suggestions":     "0",
 		})
 		return
 	}
-	
+
 	// Count warnings and suggestions by reading the file again
 	warningCount, suggestionCount, testCount := countArrayEntries()
-	
+
 	// Get tests_performed or use count
 	testsPerformed := data["tests_performed"]
 	if testsPerformed == "" || testsPerformed == "0" {
 		testsPerformed = fmt.Sprintf("%d", testCount)
 	}
-	
+
 	if fullData {
 		// Return complete Lynis data with arrays
 		allData := parseCompleteLynisReport()
@@ -1423,126 +3031,54 @@ func analysisAPIHandler(w http.ResponseWriter, r *http.Request) {
 	} else {
 		// Extract key metrics only
 		response := map[string]string{
-			"hardening_index":  data["hardening_index"],
-			"tests_performed":  testsPerformed,
-			"warnings":         fmt.Sprintf("%d", warningCount),
-			"suggestions":      fmt.Sprintf("%d", suggestionCount),
-			"lynis_version":    data["lynis_version"],
-			"scan_date":        data["report_datetime_start"],
-			"os_name":          data["os"],
-			"os_fullname":      data["os_fullname"],
-			"os_version":       data["os_version"],
-		}
-		
+			"hardening_index": data["hardening_index"],
+			"tests_performed": testsPerformed,
+			"warnings":        fmt.Sprintf("%d", warningCount),
+			"suggestions":     fmt.Sprintf("%d", suggestionCount),
+			"lynis_version":   data["lynis_version"],
+			"scan_date":       data["report_datetime_start"],
+			"os_name":         data["os"],
+			"os_fullname":     data["os_fullname"],
+			"os_version":      data["os_version"],
+		}
+
 		json.NewEncoder(w).Encode(response)
 	}
 }
 
 // parseCompleteLynisReport parses the complete Lynis report including arrays
 func parseCompleteLynisReport() map[string]interface{} {
-	reportPaths := []string{
-		"/Users/apple/lynis-report.dat",
-		"/Users/apple/Desktop/untitled folder/untitled folder/lynis-report.dat",
-		"./lynis-report.dat",
-		"/tmp/lynis-report.dat",
-		"/usr/local/var/log/lynis-report.dat",
-		"/var/log/lynis-report.dat",
-		"/usr/share/lynis/lynis-report.dat",
-		os.Getenv("HOME") + "/lynis-report.dat",
-	}
-
-	result := make(map[string]interface{})
-	result["fields"] = make(map[string]string)
-	result["warnings"] = []string{}
-	result["suggestions"] = []string{}
-	result["tests"] = []string{}
-	result["network_interfaces"] = []string{}
-	result["network_ipv4"] = []string{}
-	result["network_ipv6"] = []string{}
-	result["network_listen_ports"] = []string{}
-	result["available_shells"] = []string{}
-	result["apache_modules"] = []string{}
-	result["package_managers"] = []string{}
-	result["nameservers"] = []string{}
-	result["default_gateways"] = []string{}
-
-	for _, reportPath := range reportPaths {
-		file, err := os.Open(reportPath)
-		if err != nil {
-			continue
-		}
-		defer file.Close()
-
-		fields := make(map[string]string)
-		var warnings, suggestions, tests []string
-		var networkInterfaces, networkIPv4, networkIPv6, listenPorts []string
-		var shells, apacheModules, packageManagers, nameservers, gateways []string
+	data, _ := parseLynisReport()
+	return completeReport(data)
+}
 
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			line := strings.TrimSpace(scanner.Text())
-			if line == "" || strings.HasPrefix(line, "#") {
-				continue
-			}
+// completeReport groups parsed report data into plain fields and named arrays, for any server
+func completeReport(data map[string]string) map[string]interface{} {
+	arrays := map[string]string{
+		"warning":              "warnings",
+		"suggestion":           "suggestions",
+		"test":                 "tests",
+		"network_interface":    "network_interfaces",
+		"network_ipv4_address": "network_ipv4",
+		"network_ipv6_address": "network_ipv6",
+		"network_listen_port":  "network_listen_ports",
+		"available_shell":      "available_shells",
+		"apache_module":        "apache_modules",
+		"package_manager":      "package_managers",
+		"nameserver":           "nameservers",
+		"default_gateway":      "default_gateways",
+	}
 
-			// Handle array entries
-			if strings.Contains(line, "[]=") {
-				parts := strings.SplitN(line, "[]=", 2)
-				if len(parts) == 2 {
-					key := parts[0]
-					value := parts[1]
-					
-					switch key {
-					case "warning":
-						warnings = append(warnings, value)
-					case "suggestion":
-						suggestions = append(suggestions, value)
-					case "test":
-						tests = append(tests, value)
-					case "network_interface":
-						networkInterfaces = append(networkInterfaces, value)
-					case "network_ipv4_address":
-						networkIPv4 = append(networkIPv4, value)
-					case "network_ipv6_address":
-						networkIPv6 = append(networkIPv6, value)
-					case "network_listen_port":
-						listenPorts = append(listenPorts, value)
-					case "available_shell":
-						shells = append(shells, value)
-					case "apache_module":
-						apacheModules = append(apacheModules, value)
-					case "package_manager":
-						packageManagers = append(packageManagers, value)
-					case "nameserver":
-						nameservers = append(nameservers, value)
-					case "default_gateway":
-						gateways = append(gateways, value)
-					}
-				}
-			} else if strings.Contains(line, "=") {
-				// Handle regular key=value
-				parts := strings.SplitN(line, "=", 2)
-				if len(parts) == 2 {
-					fields[parts[0]] = parts[1]
-				}
-			}
+	fields := make(map[string]string)
+	for key, value := range data {
+		if !strings.HasSuffix(key, "[]") {
+			fields[key] = value
 		}
+	}
 
-		result["fields"] = fields
-		result["warnings"] = warnings
-		result["suggestions"] = suggestions
-		result["tests"] = tests
-		result["network_interfaces"] = networkInterfaces
-		result["network_ipv4"] = networkIPv4
-		result["network_ipv6"] = networkIPv6
-		result["network_listen_ports"] = listenPorts
-		result["available_shells"] = shells
-		result["apache_modules"] = apacheModules
-		result["package_managers"] = packageManagers
-		result["nameservers"] = nameservers
-		result["default_gateways"] = gateways
-		
-		return result
+	result := map[string]interface{}{"fields": fields}
+	for key, name := range arrays {
+		result[name] = reportArray(data, key)
 	}
 
 	return result
@@ -1550,44 +3086,29 @@ func parseCompleteLynisReport() map[string]interface{} {
 
 // countArrayEntries counts warning[], suggestion[], and test[] entries in Lynis report
 func countArrayEntries() (int, int, int) {
-	reportPaths := []string{
-		"/Users/apple/lynis-report.dat",
-		"/Users/apple/Desktop/untitled folder/untitled folder/lynis-report.dat",
-		"./lynis-report.dat",
-		"/tmp/lynis-report.dat",
-		"/usr/local/var/log/lynis-report.dat",
-		"/var/log/lynis-report.dat",
-		"/usr/share/lynis/lynis-report.dat",
-		os.Getenv("HOME") + "/lynis-report.dat",
-	}
-
-	for _, reportPath := range reportPaths {
-		file, err := os.Open(reportPath)
-		if err != nil {
-			continue
-		}
-		defer file.Close()
+	file, err := os.Open(runnerConfig.ReportPath)
+	if err != nil {
+		return 0, 0, 0
+	}
+	defer file.Close()
 
-		warningCount := 0
-		suggestionCount := 0
-		testCount := 0
-		
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			line := strings.TrimSpace(scanner.Text())
-			if strings.HasPrefix(line, "warning[") {
-				warningCount++
-			} else if strings.HasPrefix(line, "suggestion[") {
-				suggestionCount++
-			} else if strings.HasPrefix(line, "test[") {
-				testCount++
-			}
-		}
+	warningCount := 0
+	suggestionCount := 0
+	testCount := 0
 
-		return warningCount, suggestionCount, testCount
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "warning[") {
+			warningCount++
+		} else if strings.HasPrefix(line, "suggestion[") {
+			suggestionCount++
+		} else if strings.HasPrefix(line, "test[") {
+			testCount++
+		}
 	}
 
-	return 0, 0, 0
+	return warningCount, suggestionCount, testCount
 }
 
 // analyzeCOBIT analyzes against COBIT framework
@@ -1651,126 +3172,185 @@ func analyzeCOBIT(data map[string]string) ComplianceProfile {
 // Global instances
 // exportJSONHandler exports data as JSON
 func exportJSONHandler(w http.ResponseWriter, r *http.Request) {
-	serverID := r.URL.Query().Get("server")
-	
-	if serverID == "" || serverID == "local" {
-		// Export local system data
-		completeData := parseCompleteLynisReport()
-		
-		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("Content-Disposition", "attachment; filename=lynis-report.json")
-		
-		json.NewEncoder(w).Encode(completeData)
-	} else {
-		// Export remote server data
-		server, err := serverManager.GetServer(serverID)
-		if err != nil {
-			http.Error(w, "Server not found", http.StatusNotFound)
-			return
-		}
-		
-		metrics, _ := serverManager.GetLatestMetrics(serverID)
-		
-		exportData := map[string]interface{}{
-			"server":  server,
-			"metrics": metrics,
-		}
-		
-		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=server-%s.json", serverID))
-		
-		json.NewEncoder(w).Encode(exportData)
+	server, data, ok := exportSource(w, r)
+	if !ok {
+		return
+	}
+
+	// The same document for every server: the grouped report, the server and its findings
+	exportData := completeReport(data)
+	exportData["server"] = server
+	if metrics, err := serverManager.GetLatestMetrics(server.ID); err == nil {
+		exportData["metrics"] = metrics
+	}
+	if data != nil {
+		exportData["findings"] = exportFindings(server.ID, data, r.URL.Query().Get("sort"))
 	}
+	if chain, err := verifyServerChain(server.ID); err == nil {
+		exportData["chain"] = chain
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.json", exportFilename(server.ID)))
+
+	json.NewEncoder(w).Encode(exportData)
 }
 
 // exportCSVHandler exports data as CSV
 func exportCSVHandler(w http.ResponseWriter, r *http.Request) {
-	serverID := r.URL.Query().Get("server")
-	
+	server, data, ok := exportSource(w, r)
+	if !ok {
+		return
+	}
+
 	w.Header().Set("Content-Type", "text/csv")
-	
-	if serverID == "" || serverID == "local" {
-		w.Header().Set("Content-Disposition", "attachment; filename=lynis-report.csv")
-		
-		completeData := parseCompleteLynisReport()
-		fields := completeData["fields"].(map[string]string)
-		
-		// Write CSV headers
-		fmt.Fprintln(w, "Field,Value")
-		
-		// Write all fields
-		for key, value := range fields {
-			// Escape commas and quotes in CSV
-			value = strings.ReplaceAll(value, "\"", "\"\"")
-			if strings.Contains(value, ",") || strings.Contains(value, "\"") {
-				value = "\"" + value + "\""
-			}
-			fmt.Fprintf(w, "%s,%s\n", key, value)
-		}
-		
-		// Add array data
-		if suggestions, ok := completeData["suggestions"].([]string); ok {
-			fmt.Fprintln(w, "\nSuggestions")
-			for i, s := range suggestions {
-				s = strings.ReplaceAll(s, "\"", "\"\"")
-				if strings.Contains(s, ",") {
-					s = "\"" + s + "\""
-				}
-				fmt.Fprintf(w, "%d,%s\n", i+1, s)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.csv", exportFilename(server.ID)))
+
+	completeData := completeReport(data)
+	fields := completeData["fields"].(map[string]string)
+
+	// Write CSV headers
+	fmt.Fprintln(w, "Field,Value")
+
+	// Server details first
+	fmt.Fprintf(w, "Server ID,%s\n", server.ID)
+	fmt.Fprintf(w, "Server Hostname,%s\n", server.Hostname)
+	fmt.Fprintf(w, "Server IP Address,%s\n", server.IPAddress)
+	fmt.Fprintf(w, "Server Status,%s\n", server.Status)
+	fmt.Fprintf(w, "Last Heartbeat,%s\n", server.LastHeartbeat.Format(time.RFC3339))
+
+	// Write all fields
+	for key, value := range fields {
+		// Escape commas and quotes in CSV
+		value = strings.ReplaceAll(value, "\"", "\"\"")
+		if strings.Contains(value, ",") || strings.Contains(value, "\"") {
+			value = "\"" + value + "\""
+		}
+		fmt.Fprintf(w, "%s,%s\n", key, value)
+	}
+
+	// Add array data
+	if suggestions, ok := completeData["suggestions"].([]string); ok {
+		fmt.Fprintln(w, "\nSuggestions")
+		for i, s := range suggestions {
+			s = strings.ReplaceAll(s, "\"", "\"\"")
+			if strings.Contains(s, ",") {
+				s = "\"" + s + "\""
 			}
+			fmt.Fprintf(w, "%d,%s\n", i+1, s)
 		}
-		
-		if warnings, ok := completeData["warnings"].([]string); ok && len(warnings) > 0 {
-			fmt.Fprintln(w, "\nWarnings")
-			for i, warn := range warnings {
-				warn = strings.ReplaceAll(warn, "\"", "\"\"")
-				if strings.Contains(warn, ",") {
-					warn = "\"" + warn + "\""
-				}
-				fmt.Fprintf(w, "%d,%s\n", i+1, warn)
+	}
+
+	if warnings, ok := completeData["warnings"].([]string); ok && len(warnings) > 0 {
+		fmt.Fprintln(w, "\nWarnings")
+		for i, warn := range warnings {
+			warn = strings.ReplaceAll(warn, "\"", "\"\"")
+			if strings.Contains(warn, ",") {
+				warn = "\"" + warn + "\""
 			}
+			fmt.Fprintf(w, "%d,%s\n", i+1, warn)
 		}
-	} else {
-		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=server-%s.csv", serverID))
-		
-		servers, _ := serverManager.ListServers()
-		
-		// Write CSV headers
-		fmt.Fprintln(w, "Field,Value")
-		
-		for _, server := range servers {
-			if server.ID == serverID {
-				fmt.Fprintf(w, "ID,%s\n", server.ID)
-				fmt.Fprintf(w, "Hostname,%s\n", server.Hostname)
-				fmt.Fprintf(w, "IP Address,%s\n", server.IPAddress)
-				fmt.Fprintf(w, "OS,%s\n", server.OS)
-				fmt.Fprintf(w, "Status,%s\n", server.Status)
-				fmt.Fprintf(w, "Last Heartbeat,%s\n", server.LastHeartbeat.Format(time.RFC3339))
-				
-				metrics, _ := serverManager.GetLatestMetrics(serverID)
-				if metrics != nil {
-					fmt.Fprintf(w, "Hardening Index,%s\n", metrics.HardeningIndex)
-					fmt.Fprintf(w, "Warnings,%s\n", metrics.Warnings)
-					fmt.Fprintf(w, "Tests Performed,%s\n", metrics.TestsPerformed)
-				}
-				break
-			}
+	}
+
+	if data != nil {
+		writeFindingsCSV(w, exportFindings(server.ID, data, r.URL.Query().Get("sort")))
+	}
+	if chain, err := verifyServerChain(server.ID); err == nil {
+		writeChainCSV(w, chain)
+	}
+}
+
+// exportSource resolves ?server=<id> (the dashboard host by default) to the server and its latest
+// report data, which is nil when the server has not been audited yet
+func exportSource(w http.ResponseWriter, r *http.Request) (*ServerInfo, map[string]string, bool) {
+	serverID := r.URL.Query().Get("server")
+	if serverID == "" {
+		serverID = localServerID
+	}
+
+	server, err := serverManager.GetServer(serverID)
+	if err != nil {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+
+	data, _ := latestReportData(serverID)
+	return server, data, true
+}
+
+// exportFilename keeps the dashboard host's historical export names
+func exportFilename(serverID string) string {
+	if serverID == localServerID {
+		return "lynis-report"
+	}
+	return "server-" + serverID
+}
+
+// exportFindings scores findings for an export, sorted by risk unless another order is requested
+func exportFindings(serverID string, data map[string]string, sortBy string) []SecurityFinding {
+	if sortBy == "" {
+		sortBy = "risk"
+	}
+
+	findings := scoredFindings(serverID, data)
+	sortFindings(findings, sortBy)
+	return findings
+}
+
+// writeFindingsCSV appends a findings section with risk breakdowns to a CSV export
+func writeFindingsCSV(w http.ResponseWriter, findings []SecurityFinding) {
+	fmt.Fprintln(w, "\nFindings")
+	fmt.Fprintln(w, "ID,Title,Severity,Category,Risk Score,Risk Factors,Remediation")
+
+	for _, finding := range findings {
+		factors := make([]string, len(finding.RiskFactors))
+		for i, factor := range finding.RiskFactors {
+			factors[i] = fmt.Sprintf("%s=%.1f", factor.Factor, factor.Points)
 		}
+
+		fmt.Fprintf(w, "%s,\"%s\",%s,%s,%.1f,%s,%s\n",
+			finding.ID,
+			strings.ReplaceAll(finding.Title, "\"", "\"\""),
+			finding.Severity,
+			finding.Category,
+			finding.RiskScore,
+			strings.Join(factors, " "),
+			finding.Remediation)
+	}
+}
+
+// writeChainCSV appends the audit chain proof to a CSV export
+func writeChainCSV(w http.ResponseWriter, chain *ChainReport) {
+	fmt.Fprintln(w, "\nAudit Chain")
+	fmt.Fprintln(w, "Chain,Records,Chained,Signed,Head,Valid")
+	fmt.Fprintf(w, "history,%d,%d,%d,%s,%t\n", chain.History.Records, chain.History.Chained, chain.History.Signed, chain.History.Head, chain.History.Valid)
+	fmt.Fprintf(w, "metrics,%d,%d,%d,%s,%t\n", chain.Metrics.Records, chain.Metrics.Chained, chain.Metrics.Signed, chain.Metrics.Head, chain.Metrics.Valid)
+	if chain.PublicKey != "" {
+		fmt.Fprintf(w, "Public Key,%s\n", chain.PublicKey)
+	}
+
+	for _, chainBreak := range append(chain.History.Breaks, chain.Metrics.Breaks...) {
+		fmt.Fprintf(w, "Break,%s,\"%s\"\n", chainBreak.ID, chainBreak.Problem)
 	}
 }
 
 // exportPDFHandler exports data as PDF (simplified HTML version)
 func exportPDFHandler(w http.ResponseWriter, r *http.Request) {
-	serverID := r.URL.Query().Get("server")
-	
+	server, data, ok := exportSource(w, r)
+	if !ok {
+		return
+	}
+
 	w.Header().Set("Content-Type", "text/html")
-	
-	if serverID == "" || serverID == "local" {
-		completeData := parseCompleteLynisReport()
-		fields := completeData["fields"].(map[string]string)
-		
-		// Generate print-friendly HTML
-		html := `<!DOCTYPE html>
+
+	completeData := completeReport(data)
+	fields := completeData["fields"].(map[string]string)
+	if fields["hostname"] == "" {
+		fields["hostname"] = server.Hostname
+	}
+
+	// Generate print-friendly HTML
+	html := `<!DOCTYPE html>
 <html>
 <head>
     <title>Lynis Security Report</title>
@@ -1833,6 +3413,9 @@ func exportPDFHandler(w http.ResponseWriter, r *http.Request) {
     <table>
         <tr><th>Property</th><th>Value</th></tr>
         <tr><td>Hostname</td><td>` + fields["hostname"] + `</td></tr>
+        <tr><td>Server ID</td><td>` + server.ID + `</td></tr>
+        <tr><td>IP Address</td><td>` + server.IPAddress + `</td></tr>
+        <tr><td>Status</td><td>` + server.Status + `</td></tr>
         <tr><td>Operating System</td><td>` + fields["os_fullname"] + `</td></tr>
         <tr><td>OS Version</td><td>` + fields["os_version"] + `</td></tr>
         <tr><td>Kernel Version</td><td>` + fields["os_kernel_version"] + `</td></tr>
@@ -1841,129 +3424,355 @@ func exportPDFHandler(w http.ResponseWriter, r *http.Request) {
         <tr><td>Scan Date</td><td>` + fields["report_datetime_start"] + `</td></tr>
         <tr><td>Uptime (days)</td><td>` + fields["uptime_in_days"] + `</td></tr>
     </table>`
-		
-		// Add warnings
-		if warnings, ok := completeData["warnings"].([]string); ok && len(warnings) > 0 {
-			html += `<h2>⚠️ Warnings</h2>`
-			for i, warning := range warnings {
-				html += fmt.Sprintf(`<div class="warning"><strong>%d.</strong> %s</div>`, i+1, warning)
-			}
+
+	// Add warnings
+	if warnings, ok := completeData["warnings"].([]string); ok && len(warnings) > 0 {
+		html += `<h2>⚠️ Warnings</h2>`
+		for i, warning := range warnings {
+			html += fmt.Sprintf(`<div class="warning"><strong>%d.</strong> %s</div>`, i+1, warning)
 		}
-		
-		// Add suggestions
-		if suggestions, ok := completeData["suggestions"].([]string); ok && len(suggestions) > 0 {
-			html += `<h2>💡 Suggestions</h2>`
-			for i, suggestion := range suggestions {
-				parts := strings.Split(suggestion, "|")
-				testID := parts[0]
-				description := parts[1]
-				if len(parts) > 1 {
-					html += fmt.Sprintf(`<div class="suggestion"><strong>%d. %s</strong><br>%s</div>`, i+1, testID, description)
-				} else {
-					html += fmt.Sprintf(`<div class="suggestion"><strong>%d.</strong> %s</div>`, i+1, suggestion)
-				}
+	}
+
+	// Add suggestions
+	if suggestions, ok := completeData["suggestions"].([]string); ok && len(suggestions) > 0 {
+		html += `<h2>💡 Suggestions</h2>`
+		for i, suggestion := range suggestions {
+			parts := strings.Split(suggestion, "|")
+			testID := parts[0]
+			description := parts[1]
+			if len(parts) > 1 {
+				html += fmt.Sprintf(`<div class="suggestion"><strong>%d. %s</strong><br>%s</div>`, i+1, testID, description)
+			} else {
+				html += fmt.Sprintf(`<div class="suggestion"><strong>%d.</strong> %s</div>`, i+1, suggestion)
 			}
 		}
-		
-		// Add network info
-		if netInterfaces, ok := completeData["network_interfaces"].([]string); ok && len(netInterfaces) > 0 {
-			html += `<h2>🌐 Network Configuration</h2>`
-			html += `<h3>Network Interfaces</h3><p>` + strings.Join(netInterfaces, ", ") + `</p>`
+	}
+
+	// Add network info
+	if netInterfaces, ok := completeData["network_interfaces"].([]string); ok && len(netInterfaces) > 0 {
+		html += `<h2>🌐 Network Configuration</h2>`
+		html += `<h3>Network Interfaces</h3><p>` + strings.Join(netInterfaces, ", ") + `</p>`
+	}
+
+	if ipv4, ok := completeData["network_ipv4"].([]string); ok && len(ipv4) > 0 {
+		html += `<h3>IPv4 Addresses</h3><p>` + strings.Join(ipv4, ", ") + `</p>`
+	}
+
+	// Add the audit chain proof
+	if chain, err := verifyServerChain(server.ID); err == nil {
+		status := "✅ Intact"
+		if !chain.Valid {
+			status = fmt.Sprintf("❌ %d broken link(s)", len(chain.History.Breaks)+len(chain.Metrics.Breaks))
 		}
-		
-		if ipv4, ok := completeData["network_ipv4"].([]string); ok && len(ipv4) > 0 {
-			html += `<h3>IPv4 Addresses</h3><p>` + strings.Join(ipv4, ", ") + `</p>`
+		html += `<h2>🔗 Audit Chain</h2>
+    <table>
+        <tr><th>Chain</th><th>Records</th><th>Signed</th><th>Head Hash</th></tr>`
+		html += fmt.Sprintf(`<tr><td>History</td><td>%d</td><td>%d</td><td><code>%s</code></td></tr>`, chain.History.Records, chain.History.Signed, chain.History.Head)
+		html += fmt.Sprintf(`<tr><td>Metrics</td><td>%d</td><td>%d</td><td><code>%s</code></td></tr>`, chain.Metrics.Records, chain.Metrics.Signed, chain.Metrics.Head)
+		html += `</table><p><strong>Status:</strong> ` + status + `</p>`
+		if chain.PublicKey != "" {
+			html += `<p><strong>Dashboard Public Key:</strong> <code>` + chain.PublicKey + `</code></p>`
 		}
-		
-		html += `
+	}
+
+	html += `
     <hr style="margin-top: 50px;">
     <p style="text-align: center; color: #6b7280; font-size: 0.9em;">
         Generated by UbuntuShield Security Monitoring Dashboard<br>
-        Data Source: /Users/apple/lynis-report.dat
+        Data Source: ` + exportFilename(server.ID) + `
     </p>
 </body>
 </html>`
-		
-		fmt.Fprint(w, html)
-	} else {
-		// Export remote server as HTML
-		server, err := serverManager.GetServer(serverID)
-		if err != nil {
-			http.Error(w, "Server not found", http.StatusNotFound)
+
+	fmt.Fprint(w, html)
+}
+
+// remediationCatalogHandler returns the active remediation catalog
+func remediationCatalogHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	entries := remediationCatalog.Entries()
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"version": remediationCatalog.Version,
+		"entries": entries,
+		"count":   len(entries),
+	})
+}
+
+// whatIfHandler projects compliance and hardening scores as if the given remediations or findings were fixed
+func whatIfHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var request struct {
+		ServerID string   `json:"server_id"`
+		IDs      []string `json:"ids"` // Remediation IDs (REM-SSH-001) or finding IDs (SSH-001, AUTH-9230)
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		request.ServerID = r.URL.Query().Get("server")
+		for _, param := range r.URL.Query()["ids"] {
+			request.IDs = append(request.IDs, strings.Split(param, ",")...)
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
 			return
 		}
-		
-		metrics, _ := serverManager.GetLatestMetrics(serverID)
-		
-		html := fmt.Sprintf(`<!DOCTYPE html>
-<html>
-<head>
-    <title>Server Report - %s</title>
-    <style>
-        body { font-family: Arial, sans-serif; max-width: 1200px; margin: 0 auto; padding: 20px; }
-        h1 { color: #2563eb; }
-        table { width: 100%%; border-collapse: collapse; margin: 20px 0; }
-        th, td { border: 1px solid #ddd; padding: 12px; text-align: left; }
-        th { background-color: #2563eb; color: white; }
-        .print-btn { padding: 10px 20px; background: #2563eb; color: white; border: none; border-radius: 5px; cursor: pointer; }
-    </style>
-</head>
-<body>
-    <button class="print-btn no-print" onclick="window.print()">🖨️ Print / Save as PDF</button>
-    <h1>Server Report: %s</h1>
-    <table>
-        <tr><th>Property</th><th>Value</th></tr>
-        <tr><td>Hostname</td><td>%s</td></tr>
-        <tr><td>IP Address</td><td>%s</td></tr>
-        <tr><td>Operating System</td><td>%s</td></tr>
-        <tr><td>Status</td><td>%s</td></tr>
-        <tr><td>Last Heartbeat</td><td>%s</td></tr>`, 
-			server.Hostname, server.Hostname, server.Hostname, server.IPAddress, 
-			server.OS, server.Status, server.LastHeartbeat.Format(time.RFC3339))
-		
-		if metrics != nil {
-			html += fmt.Sprintf(`
-        <tr><td>Hardening Index</td><td>%s%%</td></tr>
-        <tr><td>Warnings</td><td>%s</td></tr>
-        <tr><td>Tests Performed</td><td>%s</td></tr>`, 
-				metrics.HardeningIndex, metrics.Warnings, metrics.TestsPerformed)
-		}
-		
-		html += `
-    </table>
-</body>
-</html>`
-		
-		fmt.Fprint(w, html)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if len(request.IDs) == 0 {
+		http.Error(w, "At least one remediation or finding ID is required (?ids=REM-SSH-001,AUTH-9230)", http.StatusBadRequest)
+		return
+	}
+	if request.ServerID == "" {
+		request.ServerID = localServerID
+	}
+
+	data, err := latestReportData(request.ServerID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("No audit data for server %s: %v", request.ServerID, err), http.StatusNotFound)
+		return
+	}
+
+	agentOS := ""
+	if server, err := serverManager.GetServer(request.ServerID); err == nil {
+		agentOS = server.OS
+	}
+
+	result := projectRemediations(data, detectDistro(data, agentOS), request.IDs)
+	result.ServerID = request.ServerID
+
+	json.NewEncoder(w).Encode(result)
+}
+
+// exportRemediationScriptHandler exports a bash script for the selected remediations
+func exportRemediationScriptHandler(w http.ResponseWriter, r *http.Request) {
+	var ids []string
+
+	switch r.Method {
+	case http.MethodGet:
+		for _, param := range r.URL.Query()["ids"] {
+			for _, id := range strings.Split(param, ",") {
+				if id = strings.TrimSpace(id); id != "" {
+					ids = append(ids, id)
+				}
+			}
+		}
+	case http.MethodPost:
+		var request struct {
+			RemediationIDs []string `json:"remediation_ids"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		ids = request.RemediationIDs
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if len(ids) == 0 {
+		http.Error(w, "At least one remediation ID is required (?ids=REM-SSH-001,REM-NET-001)", http.StatusBadRequest)
+		return
+	}
+
+	// Resolve IDs against the catalog, keeping the requested order
+	var entries []*RemediationCatalogEntry
+	var unknown []string
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		entry, ok := getRemediationByID(id)
+		if !ok {
+			unknown = append(unknown, id)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	if len(unknown) > 0 {
+		http.Error(w, fmt.Sprintf("Unknown remediation IDs: %s", strings.Join(unknown, ", ")), http.StatusBadRequest)
+		return
+	}
+
+	// Use the current report to describe the findings in the script header
+	var findings []SecurityFinding
+	var hostname string
+	distro := detectDistro(nil, "")
+	if data, err := parseLynisReport(); err == nil {
+		findings = extractSecurityFindings(data)
+		hostname = data["hostname"]
+		distro = detectDistro(data, "")
+	}
+
+	script, err := buildRemediationScript(entries, findings, hostname, distro)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Cannot build remediation script: %v", err), http.StatusUnprocessableEntity)
+		return
 	}
+
+	w.Header().Set("Content-Type", "text/x-shellscript")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=ubuntushield-remediation-%s.sh", time.Now().Format("20060102-150405")))
+
+	fmt.Fprint(w, script)
 }
 
+// localServerID identifies the dashboard host in fleet-wide data
+const localServerID = "local"
+
 var (
-	historyManager *HistoryManager
+	dataStore      Storage
+	histories      *HistoryManagers
 	auditScheduler *AuditScheduler
 	serverManager  *ServerManager
+	findingsStore  *FindingsStore
+
+	regressionDetector *RegressionDetector
+	chainSigner        *ChainSigner
+	retentionManager   *RetentionManager
+	auditJobs          *JobQueue
+	maintenanceManager *MaintenanceManager
+	runnerConfig       RunnerConfig
+	auditProgress      *ProgressHub
+	remediationToken   string // Bearer token that lets /remediate run scripts on the dashboard host
 )
 
 func main() {
-	// Initialize history manager
-	historyManager = NewHistoryManager("./history")
+	// One-off maintenance commands
+	if len(os.Args) > 1 && os.Args[1] == "migrate-storage" {
+		if err := runStorageMigration(os.Args[2:]); err != nil {
+			log.Fatalf("❌ Storage migration failed: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && (os.Args[1] == "export-archive" || os.Args[1] == "import-archive") {
+		if err := runArchiveCommand(os.Args[1], os.Args[2:]); err != nil {
+			log.Fatalf("❌ Archive %s failed: %v", strings.TrimSuffix(os.Args[1], "-archive"), err)
+		}
+		return
+	}
+
+	// Load remediation catalog (built-in entries, overridable per deployment)
+	if err := loadRemediationCatalog("./data/remediation_catalog.json"); err != nil {
+		log.Fatalf("❌ Failed to load remediation catalog: %v", err)
+	}
+	log.Printf("🔧 Remediation catalog loaded (%d entries)", len(remediationCatalog.Remediations))
+
+	// Initialize storage (filesystem by default, UBUNTUSHIELD_STORAGE=db for the embedded database)
+	store, err := OpenStorage(DefaultStorageConfig())
+	if err != nil {
+		log.Fatalf("❌ Failed to open storage: %v", err)
+	}
+	defer store.Close()
+	dataStore = store
+	log.Printf("🗄️ Storage initialized (%s backend)", store.Backend())
+
+	// Load the dashboard key that signs audit chains (UBUNTUSHIELD_SIGNING_KEY, optional)
+	chainSigner, err = LoadChainSigner()
+	if err != nil {
+		log.Fatalf("❌ Failed to load signing key: %v", err)
+	}
+	if chainSigner != nil {
+		log.Printf("🔏 Audit records are signed (public key %s)", chainSigner.PublicKey())
+	}
+
+	// Initialize server manager (multi-server support), with the dashboard host as a server of its own
+	serverManager = NewServerManager(store, chainSigner)
+	hostname, _ := os.Hostname()
+	if _, err := serverManager.EnsureLocalServer(hostname, runtime.GOOS, runtime.GOARCH); err != nil {
+		log.Fatalf("❌ Failed to register the local host: %v", err)
+	}
+	log.Println("🌐 Server manager initialized (multi-server mode)")
+
+	// Initialize history (one per server, loaded on first use)
+	histories, err = NewHistoryManagers(store, serverManager, chainSigner)
+	if err != nil {
+		log.Fatalf("❌ Failed to initialize history: %v", err)
+	}
 	log.Println("💾 History manager initialized")
 
+	// Initialize retention (policies per server and tag, legal holds)
+	retentionManager, err = NewRetentionManager(store, serverManager, histories)
+	if err != nil {
+		log.Fatalf("❌ Failed to load retention settings: %v", err)
+	}
+	log.Println("🧹 Retention manager initialized")
+
+	// Initialize findings store
+	findingsStore = NewFindingsStore(store)
+	log.Println("🗂️ Findings store initialized")
+
+	// Initialize regression detection
+	regressionDetector, err = NewRegressionDetector(store)
+	if err != nil {
+		log.Fatalf("❌ Failed to load regression rules: %v", err)
+	}
+	log.Println("🚨 Regression detector initialized")
+
+	// Initialize maintenance windows and blackouts
+	maintenanceManager, err = NewMaintenanceManager(store, serverManager)
+	if err != nil {
+		log.Fatalf("❌ Failed to load maintenance settings: %v", err)
+	}
+	log.Println("🛠️ Maintenance windows initialized")
+
+	// Remediations only run on the dashboard host with UBUNTUSHIELD_REMEDIATION_TOKEN set
+	remediationToken = os.Getenv("UBUNTUSHIELD_REMEDIATION_TOKEN")
+	if remediationToken != "" {
+		log.Println("🔧 Local remediation enabled for requests carrying the remediation token")
+	}
+
+	// Initialize the audit job queue; every local Lynis run goes through it
+	auditProgress = NewProgressHub(serverManager)
+	runnerConfig = DefaultRunnerConfig()
+	auditJobs, err = NewJobQueue(store, runnerConfig, maintenanceManager, auditProgress, recordLocalAudit)
+	if err != nil {
+		log.Fatalf("❌ Failed to load audit jobs: %v", err)
+	}
+	log.Println("📋 Audit job queue initialized")
+
 	// Initialize audit scheduler
-	auditScheduler = NewAuditScheduler(historyManager)
+	auditScheduler, err = NewAuditScheduler(store, auditJobs.Submit)
+	if err != nil {
+		log.Fatalf("❌ Failed to load scheduler settings: %v", err)
+	}
 	auditScheduler.Start()
 	log.Println("⏰ Audit scheduler initialized")
 
-	// Initialize server manager (multi-server support)
-	serverManager = NewServerManager("./data")
-	log.Println("🌐 Server manager initialized (multi-server mode)")
-
-	// Start background task to update server status
+	// Start background task to update server status and time out remediation jobs of silent agents
 	go func() {
 		ticker := time.NewTicker(1 * time.Minute)
 		defer ticker.Stop()
 		for range ticker.C {
 			serverManager.UpdateServerStatus()
+			if expired, err := serverManager.ExpireRemediationJobs(); err != nil {
+				log.Printf("⚠️ Failed to expire remediation jobs: %v", err)
+			} else if expired > 0 {
+				log.Printf("⏱️ %d remediation job(s) got no result from their agent and timed out", expired)
+			}
+		}
+	}()
+
+	// Apply retention at startup and then hourly, rather than after every audit, so servers that
+	// stopped reporting are cleaned up too
+	go func() {
+		ticker := time.NewTicker(1 * time.Hour)
+		defer ticker.Stop()
+		for {
+			if _, err := retentionManager.RunAll(); err != nil {
+				log.Printf("⚠️ Retention run failed: %v", err)
+			}
+			<-ticker.C
 		}
 	}()
 
@@ -1972,29 +3781,57 @@ func main() {
 	http.HandleFunc("/servers", multiServerDashboardHandler)
 	http.HandleFunc("/report", reportHandler)
 	http.HandleFunc("/run-audit", runAuditHandler)
+	http.HandleFunc("/api/jobs", jobsListHandler)
+	http.HandleFunc("/api/jobs/", jobDetailHandler) // handles /api/jobs/{id}
 	http.HandleFunc("/compliance", complianceProfileHandler)
 	http.HandleFunc("/remediate", remediateHandler)
-	
+	http.HandleFunc("/api/remediations/catalog", remediationCatalogHandler)
+
 	// History and scheduling endpoints
 	http.HandleFunc("/history/trend", historyTrendHandler)
 	http.HandleFunc("/history/records", historyRecordsHandler)
 	http.HandleFunc("/history/compare", historyCompareHandler)
 	http.HandleFunc("/history/stats", historyStatsHandler)
+	http.HandleFunc("/history/reindex", historyReindexHandler)
+	http.HandleFunc("/history/report", historyReportHandler)
+	http.HandleFunc("/history/diff", historyDiffHandler)
+	http.HandleFunc("/history/forecast", historyForecastHandler)
+	http.HandleFunc("/api/chain/verify", chainVerifyHandler)
+	http.HandleFunc("/api/retention", retentionHandler)
+	http.HandleFunc("/api/retention/policy", retentionPolicyHandler)
+	http.HandleFunc("/api/retention/holds", retentionHoldsHandler)
+	http.HandleFunc("/api/retention/run", retentionRunHandler)
+	http.HandleFunc("/api/retention/runs", retentionRunsHandler)
+	http.HandleFunc("/api/maintenance", maintenanceHandler)
+	http.HandleFunc("/api/maintenance/windows", maintenanceWindowsHandler)
+	http.HandleFunc("/api/maintenance/blackouts", maintenanceBlackoutsHandler)
+	http.HandleFunc("/api/maintenance/status", maintenanceStatusHandler)
+	http.HandleFunc("/api/archive/export", archiveExportHandler)
+	http.HandleFunc("/api/archive/import", archiveImportHandler)
+	http.HandleFunc("/api/regressions", regressionsHandler)
+	http.HandleFunc("/api/regressions/rules", regressionRulesHandler)
 	http.HandleFunc("/scheduler/status", schedulerStatusHandler)
 	http.HandleFunc("/scheduler/config", schedulerConfigHandler)
-	
+	http.HandleFunc("/scheduler/schedules", schedulerSchedulesHandler)
+
 	// Multi-server API endpoints (for agents)
 	http.HandleFunc("/api/agents/register", agentRegisterHandler)
 	http.HandleFunc("/api/agents/heartbeat", agentHeartbeatHandler)
+	http.HandleFunc("/api/agents/jobs", agentJobsHandler)
+	http.HandleFunc("/api/agents/jobs/result", agentJobResultHandler)
+	http.HandleFunc("/api/agents/audits/progress", agentAuditProgressHandler)
 	http.HandleFunc("/api/metrics", agentMetricsHandler)
 	http.HandleFunc("/api/servers", serversListHandler)
 	http.HandleFunc("/api/servers/", serversDetailHandler) // handles /api/servers/{id}
 	http.HandleFunc("/api/analysis", analysisAPIHandler)   // Local system analysis
-	
+	http.HandleFunc("/api/findings", findingsHandler)
+	http.HandleFunc("/api/whatif", whatIfHandler)
+
 	// Export endpoints
 	http.HandleFunc("/api/export/json", exportJSONHandler)
 	http.HandleFunc("/api/export/csv", exportCSVHandler)
 	http.HandleFunc("/api/export/pdf", exportPDFHandler)
+	http.HandleFunc("/api/export/remediation-script", exportRemediationScriptHandler)
 
 	port := "5179"
 	fmt.Printf("🚀 Linux Hardening Dashboard starting on http://localhost:%s\n", port)
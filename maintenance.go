@@ -0,0 +1,355 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Maintenance settings live with the other settings
+const (
+	maintenanceSettingsKey = "maintenance"
+	maxMaintenanceSteps    = 1000 // Windows and blackouts walked looking for the next allowed time
+)
+
+// MaintenanceConfig holds the recurring windows heavy work is limited to and the blackout periods it
+// must avoid. Windows and blackouts without tags apply to every server, the others to servers with
+// any of their tags.
+type MaintenanceConfig struct {
+	Windows   []MaintenanceWindow `json:"windows"`
+	Blackouts []Blackout          `json:"blackouts"`
+}
+
+// MaintenanceWindow is a recurring period audits and remediations may run in. Once any window
+// applies to a server, work on it waits for one to open.
+type MaintenanceWindow struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Cron     string   `json:"cron"`     // When the window opens, e.g. "0 1 * * 1-5 Europe/Berlin"
+	Duration string   `json:"duration"` // How long it stays open, e.g. "4h"
+	Tags     []string `json:"tags,omitempty"`
+
+	spec     *CronSchedule
+	duration time.Duration
+}
+
+// Blackout is a one-off period, such as a change freeze, when no audits or remediations run
+type Blackout struct {
+	ID        string    `json:"id"`
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	Reason    string    `json:"reason"`
+	Tags      []string  `json:"tags,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MaintenanceCheck says whether heavy work may run on a server at a given time
+type MaintenanceCheck struct {
+	ServerID    string    `json:"server_id"`
+	Allowed     bool      `json:"allowed"`
+	Reason      string    `json:"reason,omitempty"`       // Why work is deferred
+	NextAllowed time.Time `json:"next_allowed,omitempty"` // When deferred work may run; zero if no window opens
+}
+
+// MaintenanceManager decides when audits and remediations may run
+type MaintenanceManager struct {
+	store   Storage
+	servers *ServerManager
+	config  MaintenanceConfig
+	mu      sync.RWMutex
+}
+
+// NewMaintenanceManager creates a maintenance manager, loading the saved windows and blackouts
+func NewMaintenanceManager(store Storage, servers *ServerManager) (*MaintenanceManager, error) {
+	mm := &MaintenanceManager{
+		store:   store,
+		servers: servers,
+		config: MaintenanceConfig{
+			Windows:   []MaintenanceWindow{},
+			Blackouts: []Blackout{},
+		},
+	}
+
+	data, err := store.Get(settingsBucket, maintenanceSettingsKey)
+	if errors.Is(err, ErrNotFound) {
+		return mm, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var config MaintenanceConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to decode maintenance settings: %w", err)
+	}
+	for i := range config.Windows {
+		if err := config.Windows[i].parse(); err != nil {
+			return nil, fmt.Errorf("invalid saved maintenance window %s: %w", config.Windows[i].Name, err)
+		}
+	}
+	if config.Windows == nil {
+		config.Windows = []MaintenanceWindow{}
+	}
+	if config.Blackouts == nil {
+		config.Blackouts = []Blackout{}
+	}
+	mm.config = config
+
+	return mm, nil
+}
+
+// Config returns the current windows and blackouts
+func (mm *MaintenanceManager) Config() MaintenanceConfig {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+
+	return mm.config
+}
+
+// AddWindow adds a maintenance window, replacing the one with the same name
+func (mm *MaintenanceManager) AddWindow(window MaintenanceWindow) (*MaintenanceWindow, error) {
+	if window.Name == "" {
+		return nil, fmt.Errorf("window name is required")
+	}
+	if err := window.parse(); err != nil {
+		return nil, err
+	}
+	window.ID = "window_" + generateID()[:8]
+
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	config := mm.config
+	config.Windows = []MaintenanceWindow{}
+	for _, existing := range mm.config.Windows {
+		if existing.Name != window.Name {
+			config.Windows = append(config.Windows, existing)
+		}
+	}
+	config.Windows = append(config.Windows, window)
+	if err := mm.save(config); err != nil {
+		return nil, err
+	}
+
+	return &window, nil
+}
+
+// RemoveWindow removes a maintenance window
+func (mm *MaintenanceManager) RemoveWindow(id string) error {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	config := mm.config
+	config.Windows = []MaintenanceWindow{}
+	for _, window := range mm.config.Windows {
+		if window.ID != id {
+			config.Windows = append(config.Windows, window)
+		}
+	}
+	if len(config.Windows) == len(mm.config.Windows) {
+		return fmt.Errorf("maintenance window %s not found", id)
+	}
+
+	return mm.save(config)
+}
+
+// AddBlackout adds a blackout period
+func (mm *MaintenanceManager) AddBlackout(blackout Blackout) (*Blackout, error) {
+	if blackout.From.IsZero() || blackout.To.IsZero() {
+		return nil, fmt.Errorf("blackout needs from and to")
+	}
+	if !blackout.To.After(blackout.From) {
+		return nil, fmt.Errorf("blackout must end after it starts")
+	}
+
+	blackout.ID = "blackout_" + generateID()[:8]
+	blackout.CreatedAt = time.Now()
+
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	config := mm.config
+	config.Blackouts = append(append([]Blackout{}, mm.config.Blackouts...), blackout)
+	if err := mm.save(config); err != nil {
+		return nil, err
+	}
+
+	return &blackout, nil
+}
+
+// RemoveBlackout ends a blackout early
+func (mm *MaintenanceManager) RemoveBlackout(id string) error {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	config := mm.config
+	config.Blackouts = []Blackout{}
+	for _, blackout := range mm.config.Blackouts {
+		if blackout.ID != id {
+			config.Blackouts = append(config.Blackouts, blackout)
+		}
+	}
+	if len(config.Blackouts) == len(mm.config.Blackouts) {
+		return fmt.Errorf("blackout %s not found", id)
+	}
+
+	return mm.save(config)
+}
+
+// Check returns whether heavy work may run on a server at t and, if not, when it may. A nil manager
+// allows everything.
+func (mm *MaintenanceManager) Check(serverID string, t time.Time) MaintenanceCheck {
+	check := MaintenanceCheck{ServerID: serverID, Allowed: true}
+	if mm == nil {
+		return check
+	}
+
+	var tags []string
+	if server, err := mm.servers.GetServer(serverID); err == nil {
+		tags = server.Tags
+	}
+
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+
+	var windows []MaintenanceWindow
+	for _, window := range mm.config.Windows {
+		if tagsMatch(window.Tags, tags) {
+			windows = append(windows, window)
+		}
+	}
+	var blackouts []Blackout
+	for _, blackout := range mm.config.Blackouts {
+		if tagsMatch(blackout.Tags, tags) && blackout.To.After(t) {
+			blackouts = append(blackouts, blackout)
+		}
+	}
+
+	// Step forward past blackouts and to window openings until both allow work
+	at := t
+	for step := 0; step < maxMaintenanceSteps; step++ {
+		if blackout, ok := activeBlackout(blackouts, at); ok {
+			if check.Reason == "" {
+				check.Reason = fmt.Sprintf("blackout until %s: %s", blackout.To.Format("2006-01-02 15:04 MST"), blackout.Reason)
+			}
+			at = blackout.To
+			continue
+		}
+
+		if len(windows) > 0 && !inWindow(windows, at) {
+			if check.Reason == "" {
+				check.Reason = fmt.Sprintf("outside maintenance windows (%s)", windowNames(windows))
+			}
+			opens := nextWindowOpening(windows, at)
+			if opens.IsZero() {
+				break
+			}
+			at = opens
+			continue
+		}
+
+		check.Allowed = !at.After(t)
+		if !check.Allowed {
+			check.NextAllowed = at
+		}
+		return check
+	}
+
+	// No window opens outside the blackouts
+	check.Allowed = false
+	return check
+}
+
+// Helper functions
+
+func (mm *MaintenanceManager) save(config MaintenanceConfig) error {
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := mm.store.Put(settingsBucket, maintenanceSettingsKey, data); err != nil {
+		return fmt.Errorf("failed to save maintenance settings: %w", err)
+	}
+
+	mm.config = config
+	return nil
+}
+
+// parse validates a window's schedule and duration
+func (w *MaintenanceWindow) parse() error {
+	spec, err := ParseCron(w.Cron)
+	if err != nil {
+		return err
+	}
+
+	duration, err := time.ParseDuration(w.Duration)
+	if err != nil || duration < time.Minute {
+		return fmt.Errorf("invalid window duration %q (expected e.g. 30m or 4h)", w.Duration)
+	}
+
+	w.Cron, w.spec, w.duration = spec.Expr, spec, duration
+	return nil
+}
+
+// open reports whether the window is open at t: it opened less than its duration ago
+func (w MaintenanceWindow) open(t time.Time) bool {
+	opened := w.spec.Next(t.Add(-w.duration))
+	return !opened.IsZero() && !opened.After(t)
+}
+
+func inWindow(windows []MaintenanceWindow, t time.Time) bool {
+	for _, window := range windows {
+		if window.open(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextWindowOpening returns the earliest opening of any window after t
+func nextWindowOpening(windows []MaintenanceWindow, t time.Time) time.Time {
+	var earliest time.Time
+	for _, window := range windows {
+		opens := window.spec.Next(t)
+		if !opens.IsZero() && (earliest.IsZero() || opens.Before(earliest)) {
+			earliest = opens
+		}
+	}
+	return earliest
+}
+
+func activeBlackout(blackouts []Blackout, t time.Time) (Blackout, bool) {
+	for _, blackout := range blackouts {
+		if !t.Before(blackout.From) && t.Before(blackout.To) {
+			return blackout, true
+		}
+	}
+	return Blackout{}, false
+}
+
+func windowNames(windows []MaintenanceWindow) string {
+	names := make([]string, len(windows))
+	for i, window := range windows {
+		names[i] = window.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// tagsMatch reports whether a window or blackout with scope tags applies to a server with tags
+func tagsMatch(scope, tags []string) bool {
+	if len(scope) == 0 {
+		return true
+	}
+	for _, want := range scope {
+		for _, tag := range tags {
+			if tag == want {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceCheck(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 4 May 2026 is a Monday
+	at := func(day, hour, minute int) time.Time { return time.Date(2026, 5, day, hour, minute, 0, 0, time.UTC) }
+	window := func(name, cron, duration string, tags ...string) MaintenanceWindow {
+		return MaintenanceWindow{Name: name, Cron: cron, Duration: duration, Tags: tags}
+	}
+	blackout := func(from, to time.Time, tags ...string) Blackout {
+		return Blackout{From: from, To: to, Reason: "change freeze", Tags: tags}
+	}
+	nightly := window("nightly", "0 1 * * * UTC", "4h")
+
+	tests := []struct {
+		name      string
+		tags      []string // The server's
+		windows   []MaintenanceWindow
+		blackouts []Blackout
+		at        time.Time
+		allowed   bool
+		next      time.Time // Zero when allowed or no window opens
+		reason    string    // Part of the reason work is deferred
+	}{
+		{name: "nothing configured", at: at(4, 12, 0), allowed: true},
+
+		{name: "inside a window", windows: []MaintenanceWindow{nightly}, at: at(4, 2, 0), allowed: true},
+		{name: "window opening", windows: []MaintenanceWindow{nightly}, at: at(4, 1, 0), allowed: true},
+		{name: "before a window", windows: []MaintenanceWindow{nightly}, at: at(4, 0, 30), next: at(4, 1, 0), reason: "outside maintenance windows (nightly)"},
+		{name: "window just closed", windows: []MaintenanceWindow{nightly}, at: at(4, 5, 0), next: at(5, 1, 0), reason: "nightly"},
+
+		// A window opening at 22:00 for 4 hours stays open past midnight
+		{name: "window before midnight", windows: []MaintenanceWindow{window("late", "0 22 * * * UTC", "4h")}, at: at(4, 23, 30), allowed: true},
+		{name: "window after midnight", windows: []MaintenanceWindow{window("late", "0 22 * * * UTC", "4h")}, at: at(5, 1, 59), allowed: true},
+		{name: "window closed after midnight", windows: []MaintenanceWindow{window("late", "0 22 * * * UTC", "4h")}, at: at(5, 2, 0), next: at(5, 22, 0), reason: "late"},
+		{name: "weekly window across midnight", windows: []MaintenanceWindow{window("weekend", "0 23 * * sun UTC", "2h")}, at: at(4, 0, 30), allowed: true},
+
+		// Windows follow the zone in their schedule: 01:00 in New York is 05:00 UTC during DST
+		{name: "window in another zone open", windows: []MaintenanceWindow{window("ny", "0 1 * * * America/New_York", "2h")}, at: at(4, 5, 30), allowed: true},
+		{name: "window in another zone closed", windows: []MaintenanceWindow{window("ny", "0 1 * * * America/New_York", "2h")}, at: at(4, 1, 30), next: time.Date(2026, 5, 4, 1, 0, 0, 0, newYork), reason: "ny"},
+		{name: "window in another zone after dst", windows: []MaintenanceWindow{window("ny", "0 1 * * * America/New_York", "2h")}, at: time.Date(2026, 11, 2, 1, 30, 0, 0, time.UTC), next: time.Date(2026, 11, 2, 6, 0, 0, 0, time.UTC), reason: "ny"},
+
+		// Any open window allows work
+		{name: "overlapping windows, first open", windows: []MaintenanceWindow{window("a", "0 1 * * * UTC", "2h"), window("b", "0 2 * * * UTC", "2h")}, at: at(4, 1, 30), allowed: true},
+		{name: "overlapping windows, second open", windows: []MaintenanceWindow{window("a", "0 1 * * * UTC", "2h"), window("b", "0 2 * * * UTC", "2h")}, at: at(4, 3, 30), allowed: true},
+		{name: "overlapping windows, both closed", windows: []MaintenanceWindow{window("a", "0 1 * * * UTC", "2h"), window("b", "0 2 * * * UTC", "2h")}, at: at(4, 4, 0), next: at(5, 1, 0), reason: "(a, b)"},
+		{name: "earliest window opens first", windows: []MaintenanceWindow{window("a", "0 9 * * * UTC", "1h"), window("b", "0 6 * * * UTC", "1h")}, at: at(4, 4, 0), next: at(4, 6, 0), reason: "a, b"},
+
+		{name: "during a blackout", blackouts: []Blackout{blackout(at(4, 10, 0), at(4, 12, 0))}, at: at(4, 11, 0), next: at(4, 12, 0), reason: "blackout until 2026-05-04 12:00 UTC: change freeze"},
+		{name: "blackout start", blackouts: []Blackout{blackout(at(4, 10, 0), at(4, 12, 0))}, at: at(4, 10, 0), next: at(4, 12, 0), reason: "blackout"},
+		{name: "blackout end", blackouts: []Blackout{blackout(at(4, 10, 0), at(4, 12, 0))}, at: at(4, 12, 0), allowed: true},
+		{name: "overlapping blackouts", blackouts: []Blackout{blackout(at(4, 10, 0), at(4, 12, 0)), blackout(at(4, 11, 0), at(4, 14, 0))}, at: at(4, 10, 30), next: at(4, 14, 0), reason: "blackout until 2026-05-04 12:00"},
+		{name: "adjacent blackouts", blackouts: []Blackout{blackout(at(4, 12, 0), at(4, 14, 0)), blackout(at(4, 10, 0), at(4, 12, 0))}, at: at(4, 10, 30), next: at(4, 14, 0), reason: "blackout"},
+
+		// Deferred work runs once both the blackouts and the windows allow it
+		{name: "blackout ending inside a window", windows: []MaintenanceWindow{nightly}, blackouts: []Blackout{blackout(at(4, 0, 0), at(4, 2, 0))}, at: at(4, 0, 30), next: at(4, 2, 0), reason: "blackout"},
+		{name: "blackout covering a window", windows: []MaintenanceWindow{nightly}, blackouts: []Blackout{blackout(at(4, 0, 0), at(4, 6, 0))}, at: at(4, 2, 0), next: at(5, 1, 0), reason: "blackout"},
+		{name: "blackout inside a closed window", windows: []MaintenanceWindow{nightly}, blackouts: []Blackout{blackout(at(4, 10, 0), at(4, 12, 0))}, at: at(4, 11, 0), next: at(5, 1, 0), reason: "blackout"},
+		{name: "blackout over the next opening", windows: []MaintenanceWindow{nightly}, blackouts: []Blackout{blackout(at(5, 0, 0), at(5, 3, 0))}, at: at(4, 12, 0), next: at(5, 3, 0), reason: "outside maintenance windows"},
+
+		// Windows and blackouts with tags only apply to servers with one of them
+		{name: "window for other servers", windows: []MaintenanceWindow{window("prod", "0 1 * * * UTC", "4h", "prod")}, at: at(4, 12, 0), allowed: true},
+		{name: "window for the server's tag", tags: []string{"web", "prod"}, windows: []MaintenanceWindow{window("prod", "0 1 * * * UTC", "4h", "prod")}, at: at(4, 12, 0), next: at(5, 1, 0), reason: "prod"},
+		{name: "blackout for other servers", tags: []string{"web"}, blackouts: []Blackout{blackout(at(4, 10, 0), at(4, 12, 0), "prod")}, at: at(4, 11, 0), allowed: true},
+		{name: "blackout for the server's tag", tags: []string{"prod"}, blackouts: []Blackout{blackout(at(4, 10, 0), at(4, 12, 0), "prod")}, at: at(4, 11, 0), next: at(4, 12, 0), reason: "blackout"},
+
+		{name: "window never opens", windows: []MaintenanceWindow{window("never", "0 0 30 2 * UTC", "1h")}, at: at(4, 12, 0), reason: "never"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := OpenDBStorage(t.TempDir() + "/dashboard.db")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			servers := NewServerManager(store, nil)
+			server, err := servers.RegisterServer("web-1", "10.0.0.5", "Ubuntu 22.04", "amd64", "1.0.0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := servers.SetTags(server.ID, tt.tags); err != nil {
+				t.Fatal(err)
+			}
+
+			mm, err := NewMaintenanceManager(store, servers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, w := range tt.windows {
+				if _, err := mm.AddWindow(w); err != nil {
+					t.Fatalf("AddWindow(%s): %v", w.Name, err)
+				}
+			}
+			for _, b := range tt.blackouts {
+				if _, err := mm.AddBlackout(b); err != nil {
+					t.Fatalf("AddBlackout(): %v", err)
+				}
+			}
+
+			check := mm.Check(server.ID, tt.at)
+			if check.Allowed != tt.allowed || !check.NextAllowed.Equal(tt.next) {
+				t.Errorf("Check(%s) = allowed %v until %s, want %v until %s (%s)", tt.at, check.Allowed, check.NextAllowed, tt.allowed, tt.next, check.Reason)
+			}
+			if tt.allowed && check.Reason != "" {
+				t.Errorf("Check(%s) reason = %q for allowed work", tt.at, check.Reason)
+			}
+			if !strings.Contains(check.Reason, tt.reason) {
+				t.Errorf("Check(%s) reason = %q, want it to mention %q", tt.at, check.Reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestMaintenanceCheckWithoutManager(t *testing.T) {
+	var mm *MaintenanceManager
+	if check := mm.Check("web-1", time.Now()); !check.Allowed || check.ServerID != "web-1" {
+		t.Errorf("nil manager Check() = %+v, want allowed", check)
+	}
+}
+
+func TestMaintenanceSettingsInvalid(t *testing.T) {
+	store, err := OpenDBStorage(t.TempDir() + "/dashboard.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	mm, err := NewMaintenanceManager(store, NewServerManager(store, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	windows := []MaintenanceWindow{
+		{Cron: "0 1 * * *", Duration: "4h"},
+		{Name: "bad cron", Cron: "0 25 * * *", Duration: "4h"},
+		{Name: "bad duration", Cron: "0 1 * * *", Duration: "four hours"},
+		{Name: "too short", Cron: "0 1 * * *", Duration: "30s"},
+	}
+	for _, w := range windows {
+		if _, err := mm.AddWindow(w); err == nil {
+			t.Errorf("AddWindow(%+v) succeeded, want an error", w)
+		}
+	}
+
+	from := time.Date(2026, 5, 4, 10, 0, 0, 0, time.UTC)
+	blackouts := []Blackout{
+		{From: from},
+		{From: from, To: from},
+		{From: from, To: from.Add(-time.Hour)},
+	}
+	for _, b := range blackouts {
+		if _, err := mm.AddBlackout(b); err == nil {
+			t.Errorf("AddBlackout(%+v) succeeded, want an error", b)
+		}
+	}
+}
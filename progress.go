@@ -0,0 +1,428 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Audit progress event types
+const (
+	eventState    = "state"    // The audit was queued, deferred, started, ...
+	eventOutput   = "output"   // A line of Lynis output
+	eventPhase    = "phase"    // Lynis started a test category, e.g. "Boot and services"
+	eventProgress = "progress" // More tests finished
+	eventComplete = "complete" // The audit ended; always the last event
+)
+
+const (
+	maxStreamEvents      = 20000            // Events kept per audit for late subscribers; later output is only sent live
+	streamRetention      = 10 * time.Minute // Finished audits stay available to late subscribers
+	streamIdleTimeout    = 30 * time.Minute // Unfinished audits without events, e.g. of a vanished agent, are dropped
+	subscriberBuffer     = 256              // Events a slow subscriber may lag behind before it's dropped
+	defaultExpectedTests = 250              // Estimated tests of a quick audit, for servers without a previous audit
+	maxStreamIDLength    = 64
+	eventKeepAlive       = 15 * time.Second // Comments sent on idle event streams so proxies keep them open
+)
+
+var (
+	// ErrStreamNotFound is returned when subscribing to an unknown or expired audit
+	ErrStreamNotFound = errors.New("no progress for this audit")
+
+	ansiEscape      = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+	lynisPhaseLine  = regexp.MustCompile(`^\[\+\] (.+)$`)
+	lynisResultLine = regexp.MustCompile(`^\s+- .*\[ .+ \]$`)
+)
+
+// AuditEvent is one step of a running audit, sent to dashboards as a server-sent event
+type AuditEvent struct {
+	ID       int            `json:"id"` // Increases within an audit, for resuming with Last-Event-ID
+	Type     string         `json:"type"`
+	AuditID  string         `json:"audit_id"`
+	ServerID string         `json:"server_id"`
+	Time     time.Time      `json:"time"`
+	State    string         `json:"state,omitempty"`
+	Message  string         `json:"message,omitempty"` // Why the audit is in this state, e.g. deferred
+	Line     string         `json:"line,omitempty"`
+	Phase    string         `json:"phase,omitempty"`
+	Progress *AuditProgress `json:"progress,omitempty"`
+	Error    string         `json:"error,omitempty"`
+	Summary  *AuditSummary  `json:"summary,omitempty"` // The new results, on successful completion
+}
+
+// AuditProgress estimates how far an audit is from the tests Lynis reported so far and the number of
+// tests the server's previous audit ran
+type AuditProgress struct {
+	TestsDone     int `json:"tests_done"`
+	TestsExpected int `json:"tests_expected"`
+	Percent       int `json:"percent"` // Stays below 100 until the audit completes
+}
+
+// AuditSummary is the outcome of a finished audit
+type AuditSummary struct {
+	RecordID       string             `json:"record_id"`
+	HardeningIndex string             `json:"hardening_index"`
+	Warnings       string             `json:"warnings"`
+	TestsPerformed string             `json:"tests_performed"`
+	Compliance     map[string]float64 `json:"compliance"` // Score per framework
+}
+
+// AuditSubscription receives the events of one audit: the ones already sent, then new ones on Events
+// until it's closed, after the complete event or when the subscriber falls too far behind
+type AuditSubscription struct {
+	AuditID string
+	Replay  []AuditEvent
+	Events  <-chan AuditEvent
+	Done    bool // The audit already completed; Replay ends with its complete event
+
+	events chan AuditEvent
+}
+
+// ProgressHub relays the progress of running audits, local ones and those run by agents, to
+// dashboards following them
+type ProgressHub struct {
+	servers *ServerManager // Previous audits, for estimating progress
+	streams map[string]*auditStream
+	latest  map[string]string // Newest audit of each server
+	opened  chan struct{}     // Closed and replaced whenever an audit opens
+	mu      sync.Mutex
+}
+
+type auditStream struct {
+	id          string
+	serverID    string
+	events      []AuditEvent
+	lastID      int
+	subscribers map[chan AuditEvent]struct{}
+	done        bool
+	updated     time.Time
+	testsDone   int
+	expected    int
+	percent     int
+}
+
+// NewProgressHub creates an empty progress hub
+func NewProgressHub(servers *ServerManager) *ProgressHub {
+	return &ProgressHub{
+		servers: servers,
+		streams: make(map[string]*auditStream),
+		latest:  make(map[string]string),
+		opened:  make(chan struct{}),
+	}
+}
+
+// Open starts relaying an audit of a server. Opening an audit again is a no-op, but an ID in use for
+// another server is refused. A nil hub ignores this and all other updates.
+func (h *ProgressHub) Open(auditID, serverID string) error {
+	if h == nil {
+		return nil
+	}
+	if auditID == "" || len(auditID) > maxStreamIDLength {
+		return fmt.Errorf("invalid audit ID")
+	}
+
+	expected := h.expectedTests(serverID)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.prune()
+	if stream, ok := h.streams[auditID]; ok {
+		if stream.serverID != serverID {
+			return fmt.Errorf("audit %s belongs to another server", auditID)
+		}
+		return nil
+	}
+
+	h.streams[auditID] = &auditStream{
+		id:          auditID,
+		serverID:    serverID,
+		subscribers: make(map[chan AuditEvent]struct{}),
+		updated:     time.Now(),
+		expected:    expected,
+	}
+	h.latest[serverID] = auditID
+	close(h.opened)
+	h.opened = make(chan struct{})
+	return nil
+}
+
+// State reports that an audit was deferred, started, ...
+func (h *ProgressHub) State(auditID, state, message string) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if stream, ok := h.streams[auditID]; ok && !stream.done {
+		h.publish(stream, AuditEvent{Type: eventState, State: state, Message: message})
+	}
+}
+
+// Output relays lines of Lynis output, deriving phase and progress events from them
+func (h *ProgressHub) Output(auditID string, lines ...string) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	stream, ok := h.streams[auditID]
+	if !ok || stream.done {
+		return
+	}
+
+	for _, line := range lines {
+		line = strings.TrimRight(ansiEscape.ReplaceAllString(line, ""), " \r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		h.publish(stream, AuditEvent{Type: eventOutput, Line: line})
+
+		if match := lynisPhaseLine.FindStringSubmatch(line); match != nil {
+			h.publish(stream, AuditEvent{Type: eventPhase, Phase: strings.TrimSpace(match[1])})
+			continue
+		}
+		if !lynisResultLine.MatchString(line) {
+			continue
+		}
+
+		stream.testsDone++
+		percent := stream.testsDone * 100 / stream.expected
+		if percent > 99 {
+			percent = 99
+		}
+		if percent != stream.percent || stream.testsDone == 1 {
+			stream.percent = percent
+			h.publish(stream, AuditEvent{Type: eventProgress, Progress: &AuditProgress{
+				TestsDone:     stream.testsDone,
+				TestsExpected: stream.expected,
+				Percent:       percent,
+			}})
+		}
+	}
+}
+
+// Finish ends an audit with its final state, e.g. succeeded or failed, and the new results if there
+// are any. Subscribers get the complete event and are closed.
+func (h *ProgressHub) Finish(auditID, state, message string, summary *AuditSummary) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	stream, ok := h.streams[auditID]
+	if !ok || stream.done {
+		return
+	}
+
+	event := AuditEvent{Type: eventComplete, State: state, Error: message, Summary: summary}
+	if state == "succeeded" {
+		event.Progress = &AuditProgress{TestsDone: stream.testsDone, TestsExpected: stream.testsDone, Percent: 100}
+	}
+	h.publish(stream, event)
+
+	stream.done = true
+	for events := range stream.subscribers {
+		close(events)
+	}
+	stream.subscribers = nil
+}
+
+// Subscribe follows an audit from after the event with ID after (0 for all of it). Call Unsubscribe
+// when done.
+func (h *ProgressHub) Subscribe(auditID string, after int) (*AuditSubscription, error) {
+	if h == nil {
+		return nil, ErrStreamNotFound
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	stream, ok := h.streams[auditID]
+	if !ok {
+		return nil, ErrStreamNotFound
+	}
+	return h.subscribe(stream, after), nil
+}
+
+// Follow subscribes to the newest audit of a server, from after event after of audit lastAudit when
+// resuming. It waits for an audit to start if the server has none running or unseen.
+func (h *ProgressHub) Follow(ctx context.Context, serverID, lastAudit string, after int) (*AuditSubscription, error) {
+	if h == nil {
+		return nil, ErrStreamNotFound
+	}
+
+	for {
+		h.mu.Lock()
+		h.prune()
+		stream, ok := h.streams[h.latest[serverID]]
+		seen := ok && stream.id == lastAudit && stream.done && after >= stream.lastID
+		if ok && !seen {
+			if stream.id != lastAudit {
+				after = 0
+			}
+			subscription := h.subscribe(stream, after)
+			h.mu.Unlock()
+			return subscription, nil
+		}
+		opened := h.opened
+		h.mu.Unlock()
+
+		select {
+		case <-opened:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Unsubscribe stops sending events to a subscription
+func (h *ProgressHub) Unsubscribe(subscription *AuditSubscription) {
+	if h == nil || subscription == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	stream, ok := h.streams[subscription.AuditID]
+	if !ok {
+		return
+	}
+	if _, ok := stream.subscribers[subscription.events]; ok {
+		delete(stream.subscribers, subscription.events)
+		close(subscription.events)
+	}
+}
+
+// Helper functions
+
+// expectedTests returns how many tests the server's previous audit ran
+func (h *ProgressHub) expectedTests(serverID string) int {
+	if h.servers != nil {
+		if metrics, err := h.servers.GetLatestMetrics(serverID); err == nil {
+			if tests, err := strconv.Atoi(metrics.TestsPerformed); err == nil && tests > 0 {
+				return tests
+			}
+		}
+	}
+	return defaultExpectedTests
+}
+
+func (h *ProgressHub) subscribe(stream *auditStream, after int) *AuditSubscription {
+	subscription := &AuditSubscription{AuditID: stream.id, Done: stream.done}
+	for _, event := range stream.events {
+		if event.ID > after {
+			subscription.Replay = append(subscription.Replay, event)
+		}
+	}
+
+	subscription.events = make(chan AuditEvent, subscriberBuffer)
+	subscription.Events = subscription.events
+	if stream.done {
+		close(subscription.events)
+	} else {
+		stream.subscribers[subscription.events] = struct{}{}
+	}
+	return subscription
+}
+
+// publish numbers an event, keeps it for late subscribers and sends it to the current ones
+func (h *ProgressHub) publish(stream *auditStream, event AuditEvent) {
+	stream.lastID++
+	stream.updated = time.Now()
+	event.ID = stream.lastID
+	event.AuditID = stream.id
+	event.ServerID = stream.serverID
+	event.Time = stream.updated
+
+	// Long output is only sent live; everything else is kept so late subscribers see the outcome
+	if event.Type != eventOutput || len(stream.events) < maxStreamEvents {
+		stream.events = append(stream.events, event)
+	}
+
+	for events := range stream.subscribers {
+		select {
+		case events <- event:
+		default:
+			// Too far behind; it can reconnect with Last-Event-ID
+			delete(stream.subscribers, events)
+			close(events)
+		}
+	}
+}
+
+// prune drops audits that finished a while ago and unfinished ones that went quiet
+func (h *ProgressHub) prune() {
+	now := time.Now()
+	for id, stream := range h.streams {
+		expired := stream.done && now.Sub(stream.updated) > streamRetention
+		abandoned := !stream.done && now.Sub(stream.updated) > streamIdleTimeout
+		if !expired && !abandoned {
+			continue
+		}
+
+		for events := range stream.subscribers {
+			close(events)
+		}
+		delete(h.streams, id)
+		if h.latest[stream.serverID] == id {
+			delete(h.latest, stream.serverID)
+		}
+	}
+}
+
+// newAuditSummary summarises a stored audit for its complete event
+func newAuditSummary(recordID string, data map[string]string) *AuditSummary {
+	summary := &AuditSummary{
+		RecordID:       recordID,
+		HardeningIndex: data["hardening_index"],
+		Warnings:       data["warnings"],
+		TestsPerformed: data["lynis_tests_done"],
+		Compliance:     make(map[string]float64),
+	}
+	for framework, profile := range analyzeCompliance(data).Profiles() {
+		summary.Compliance[framework] = profile.Score
+	}
+	return summary
+}
+
+// lineWriter passes written output on to a hub line by line
+type lineWriter struct {
+	hub     *ProgressHub
+	auditID string
+	partial []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.hub.Output(w.auditID, string(w.partial[:i]))
+		w.partial = w.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush passes on a last line without a newline
+func (w *lineWriter) Flush() {
+	if len(w.partial) > 0 {
+		w.hub.Output(w.auditID, string(w.partial))
+		w.partial = nil
+	}
+}
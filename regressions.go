@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// settingsBucket holds dashboard-wide settings; regression events live under regressions/<server>
+const (
+	settingsBucket    = "settings"
+	regressionsBucket = "regressions"
+)
+
+// RegressionRules configures which changes between consecutive audits count as regressions
+type RegressionRules struct {
+	Enabled            bool    `json:"enabled"`
+	HardeningDrop      float64 `json:"hardening_drop"`       // Fire when the hardening index drops by more than this many points
+	NewHighSeverity    bool    `json:"new_high_severity"`    // Fire on any new high or critical finding
+	ControlFailed      bool    `json:"control_failed"`       // Fire when a control flips from passed to failed
+	FrameworkScoreDrop float64 `json:"framework_score_drop"` // Fire when a framework score drops by more than this (0 disables)
+}
+
+// RegressionMatch is one rule that fired for an audit
+type RegressionMatch struct {
+	Rule   string `json:"rule"` // hardening_drop, new_high_severity, control_failed, framework_score_drop
+	Detail string `json:"detail"`
+}
+
+// RegressionEvent is a persisted regression detection with the diff that triggered it
+type RegressionEvent struct {
+	ID         string            `json:"id"`
+	ServerID   string            `json:"server_id"`
+	DetectedAt time.Time         `json:"detected_at"`
+	Matches    []RegressionMatch `json:"matches"`
+	Diff       *AuditDiff        `json:"diff"`
+}
+
+// DefaultRegressionRules are used until rules are configured
+var DefaultRegressionRules = RegressionRules{
+	Enabled:         true,
+	HardeningDrop:   5,
+	NewHighSeverity: true,
+	ControlFailed:   true,
+}
+
+// RegressionDetector compares each new audit with the previous one and records regressions
+type RegressionDetector struct {
+	store Storage
+	rules RegressionRules
+	mu    sync.RWMutex
+}
+
+// NewRegressionDetector creates a detector, loading saved rules if there are any
+func NewRegressionDetector(store Storage) (*RegressionDetector, error) {
+	rd := &RegressionDetector{
+		store: store,
+		rules: DefaultRegressionRules,
+	}
+
+	data, err := store.Get(settingsBucket, "regression_rules")
+	if errors.Is(err, ErrNotFound) {
+		return rd, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &rd.rules); err != nil {
+		return nil, fmt.Errorf("failed to decode regression rules: %w", err)
+	}
+
+	return rd, nil
+}
+
+// Rules returns the current rules
+func (rd *RegressionDetector) Rules() RegressionRules {
+	rd.mu.RLock()
+	defer rd.mu.RUnlock()
+
+	return rd.rules
+}
+
+// SetRules validates and persists new rules
+func (rd *RegressionDetector) SetRules(rules RegressionRules) error {
+	if rules.HardeningDrop < 0 || rules.FrameworkScoreDrop < 0 {
+		return fmt.Errorf("score drop thresholds must not be negative")
+	}
+
+	data, err := json.MarshalIndent(rules, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+
+	if err := rd.store.Put(settingsBucket, "regression_rules", data); err != nil {
+		return fmt.Errorf("failed to save regression rules: %w", err)
+	}
+	rd.rules = rules
+
+	return nil
+}
+
+// Check evaluates the rules against a diff and persists an event when any fire
+func (rd *RegressionDetector) Check(diff *AuditDiff) (*RegressionEvent, error) {
+	rd.mu.RLock()
+	rules := rd.rules
+	rd.mu.RUnlock()
+
+	if !rules.Enabled || diff == nil {
+		return nil, nil
+	}
+
+	matches := evaluateRegressionRules(rules, diff)
+	if len(matches) == 0 {
+		return nil, nil
+	}
+
+	event := &RegressionEvent{
+		ID:         fmt.Sprintf("%s_%s", diff.To.Timestamp.UTC().Format("20060102T150405"), generateID()[:8]),
+		ServerID:   diff.ServerID,
+		DetectedAt: time.Now(),
+		Matches:    matches,
+		Diff:       diff,
+	}
+
+	data, err := json.MarshalIndent(event, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := rd.store.Put(regressionsBucket+"/"+event.ServerID, event.ID, data); err != nil {
+		return nil, fmt.Errorf("failed to save regression event: %w", err)
+	}
+
+	return event, nil
+}
+
+// Events returns regression events, newest first; an empty serverID means every server
+func (rd *RegressionDetector) Events(serverID string, limit int) ([]*RegressionEvent, error) {
+	serverIDs := []string{serverID}
+	if serverID == "" {
+		var err error
+		serverIDs, err = rd.store.Buckets(regressionsBucket)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	events := []*RegressionEvent{}
+	for _, id := range serverIDs {
+		bucket := regressionsBucket + "/" + id
+		keys, err := rd.store.Keys(bucket)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range keys {
+			data, err := rd.store.Get(bucket, key)
+			if err != nil {
+				continue
+			}
+
+			var event RegressionEvent
+			if err := json.Unmarshal(data, &event); err != nil {
+				continue
+			}
+			events = append(events, &event)
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].DetectedAt.After(events[j].DetectedAt)
+	})
+
+	if limit > 0 && len(events) > limit {
+		events = events[:limit]
+	}
+
+	return events, nil
+}
+
+// evaluateRegressionRules returns the rules a diff violates
+func evaluateRegressionRules(rules RegressionRules, diff *AuditDiff) []RegressionMatch {
+	var matches []RegressionMatch
+
+	if drop := -diff.HardeningIndex.Delta; rules.HardeningDrop > 0 && drop > rules.HardeningDrop {
+		matches = append(matches, RegressionMatch{
+			Rule:   "hardening_drop",
+			Detail: fmt.Sprintf("Hardening index dropped %.1f points (%.0f → %.0f)", drop, diff.HardeningIndex.From, diff.HardeningIndex.To),
+		})
+	}
+
+	if rules.NewHighSeverity {
+		for _, finding := range diff.AddedFindings {
+			if finding.Severity == "high" || finding.Severity == "critical" {
+				matches = append(matches, RegressionMatch{
+					Rule:   "new_high_severity",
+					Detail: fmt.Sprintf("New %s severity finding %s: %s", finding.Severity, finding.ID, finding.Title),
+				})
+			}
+		}
+	}
+
+	if rules.ControlFailed {
+		for _, change := range diff.ControlChanges {
+			if change.From == "passed" && change.To == "failed" {
+				matches = append(matches, RegressionMatch{
+					Rule:   "control_failed",
+					Detail: fmt.Sprintf("%s control %s (%s) now fails", change.Framework, change.ID, change.Title),
+				})
+			}
+		}
+	}
+
+	if rules.FrameworkScoreDrop > 0 {
+		frameworks := make([]string, 0, len(diff.Frameworks))
+		for framework := range diff.Frameworks {
+			frameworks = append(frameworks, framework)
+		}
+		sort.Strings(frameworks)
+
+		for _, framework := range frameworks {
+			change := diff.Frameworks[framework]
+			if drop := -change.Delta; drop > rules.FrameworkScoreDrop {
+				matches = append(matches, RegressionMatch{
+					Rule:   "framework_score_drop",
+					Detail: fmt.Sprintf("%s score dropped %.1f points", framework, drop),
+				})
+			}
+		}
+	}
+
+	return matches
+}
+
+// Observe checks a freshly computed diff and logs the outcome; used after every saved audit
+func (rd *RegressionDetector) Observe(diff *AuditDiff, diffErr error) {
+	if rd == nil || errors.Is(diffErr, ErrNoEarlierAudit) {
+		return // Nothing to compare with yet
+	}
+	if diffErr != nil {
+		log.Printf("⚠️ Regression check skipped, the audit couldn't be compared: %v", diffErr)
+		return
+	}
+
+	event, err := rd.Check(diff)
+	if err != nil {
+		log.Printf("⚠️ Regression check failed for %s: %v", diff.ServerID, err)
+		return
+	}
+	if event != nil {
+		log.Printf("🚨 Regression detected on %s: %d rule(s) fired (event %s)", event.ServerID, len(event.Matches), event.ID)
+	}
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RemediationCatalogEntry describes how to fix a single Lynis test
+type RemediationCatalogEntry struct {
+	TestID      string               `json:"test_id"` // Lynis test ID, e.g. AUTH-9230
+	ID          string               `json:"id"`
+	Aliases     []string             `json:"aliases"` // Dashboard finding IDs fixed by this entry, e.g. SSH-001
+	Title       string               `json:"title"`
+	Description string               `json:"description"`
+	Severity    string               `json:"severity"`
+	Category    string               `json:"category"`
+	Mappings    []string             `json:"mappings"`
+	Risk        string               `json:"risk"`
+	Downtime    string               `json:"downtime"`
+	Variants    []RemediationVariant `json:"variants"` // Steps per distribution family, first match wins
+
+	// Report fields as Lynis would record them once the fix is applied, used for what-if projections
+	ProjectedFields map[string]string `json:"projected_fields,omitempty"`
+}
+
+// RemediationVariant holds the steps for one distribution family and version range
+type RemediationVariant struct {
+	Family       string   `json:"family"`                // debian, rhel, suse, arch or any
+	MinVersion   string   `json:"min_version,omitempty"` // Inclusive, compared on the given components
+	MaxVersion   string   `json:"max_version,omitempty"` // Inclusive, so "7" matches 7.9
+	Requires     []string `json:"requires"`              // Binaries that must exist before acting
+	Precondition string   `json:"precondition"`          // Shell test that succeeds while the fix is still needed
+	BackupFiles  []string `json:"backup_files"`
+	Commands     []string `json:"commands"` // Run as root, in order
+	Verify       []string `json:"verify"`   // Shell tests that must succeed after the commands
+
+	ProjectedFields map[string]string `json:"projected_fields,omitempty"` // Overrides the entry's projected fields
+}
+
+// Matches reports whether the variant applies to the given distribution
+func (v *RemediationVariant) Matches(distro DistroInfo) bool {
+	if v.Family != "any" && v.Family != distro.Family {
+		return false
+	}
+
+	if v.MinVersion != "" && (distro.Version == "" || compareVersions(truncateVersion(distro.Version, v.MinVersion), v.MinVersion) < 0) {
+		return false
+	}
+	if v.MaxVersion != "" && (distro.Version == "" || compareVersions(truncateVersion(distro.Version, v.MaxVersion), v.MaxVersion) > 0) {
+		return false
+	}
+
+	return true
+}
+
+// Label describes the distributions a variant targets, e.g. "rhel >= 8"
+func (v *RemediationVariant) Label() string {
+	label := v.Family
+	if v.MinVersion != "" {
+		label += " >= " + v.MinVersion
+	}
+	if v.MaxVersion != "" {
+		label += " <= " + v.MaxVersion
+	}
+	return label
+}
+
+// truncateVersion cuts version down to as many components as bound has
+func truncateVersion(version, bound string) string {
+	parts := strings.Split(version, ".")
+	n := len(strings.Split(bound, "."))
+	if len(parts) > n {
+		parts = parts[:n]
+	}
+	return strings.Join(parts, ".")
+}
+
+// RemediationCatalog maps Lynis test IDs to remediation steps
+type RemediationCatalog struct {
+	Version      int                                 `json:"version"`
+	Remediations map[string]*RemediationCatalogEntry `json:"remediations"`
+}
+
+//go:embed catalog/remediations.json
+var defaultRemediationCatalog []byte
+
+// remediationCatalog is the active catalog, loaded at startup
+var remediationCatalog = mustParseRemediationCatalog(defaultRemediationCatalog)
+
+// loadRemediationCatalog loads the built-in catalog and applies a deployment override file if present
+func loadRemediationCatalog(overridePath string) error {
+	catalog, err := parseRemediationCatalog(defaultRemediationCatalog)
+	if err != nil {
+		return fmt.Errorf("invalid built-in remediation catalog: %w", err)
+	}
+
+	data, err := os.ReadFile(overridePath)
+	if err == nil {
+		override, err := parseRemediationCatalog(data)
+		if err != nil {
+			return fmt.Errorf("invalid remediation catalog %s: %w", overridePath, err)
+		}
+
+		// Entries in the override replace built-in entries for the same test ID
+		for testID, entry := range override.Remediations {
+			catalog.Remediations[testID] = entry
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read remediation catalog %s: %w", overridePath, err)
+	}
+
+	remediationCatalog = catalog
+	return nil
+}
+
+func parseRemediationCatalog(data []byte) (*RemediationCatalog, error) {
+	var catalog RemediationCatalog
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return nil, err
+	}
+
+	if catalog.Remediations == nil {
+		catalog.Remediations = make(map[string]*RemediationCatalogEntry)
+	}
+
+	for testID, entry := range catalog.Remediations {
+		if entry == nil || entry.ID == "" || len(entry.Variants) == 0 {
+			return nil, fmt.Errorf("entry %s needs an id and at least one variant", testID)
+		}
+		for i, variant := range entry.Variants {
+			if variant.Family == "" || len(variant.Commands) == 0 {
+				return nil, fmt.Errorf("entry %s variant %d needs a family and at least one command", testID, i)
+			}
+		}
+		entry.TestID = testID
+	}
+
+	return &catalog, nil
+}
+
+func mustParseRemediationCatalog(data []byte) *RemediationCatalog {
+	catalog, err := parseRemediationCatalog(data)
+	if err != nil {
+		panic(fmt.Sprintf("invalid built-in remediation catalog: %v", err))
+	}
+	return catalog
+}
+
+// Entries returns all catalog entries sorted by test ID
+func (c *RemediationCatalog) Entries() []*RemediationCatalogEntry {
+	entries := make([]*RemediationCatalogEntry, 0, len(c.Remediations))
+	for _, entry := range c.Remediations {
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].TestID < entries[j].TestID
+	})
+
+	return entries
+}
+
+// getRemediationByID returns the catalog entry with the given remediation ID
+func getRemediationByID(id string) (*RemediationCatalogEntry, bool) {
+	for _, entry := range remediationCatalog.Remediations {
+		if entry.ID == id {
+			return entry, true
+		}
+	}
+	return nil, false
+}
+
+// getRemediationForFinding returns the catalog entry that fixes the given finding
+func getRemediationForFinding(findingID string) (*RemediationCatalogEntry, bool) {
+	if entry, ok := remediationCatalog.Remediations[findingID]; ok {
+		return entry, true
+	}
+
+	for _, entry := range remediationCatalog.Remediations {
+		for _, alias := range entry.Aliases {
+			if alias == findingID {
+				return entry, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// fixesFinding reports whether this entry remediates the given finding ID
+func (e *RemediationCatalogEntry) fixesFinding(findingID string) bool {
+	if e.TestID == findingID {
+		return true
+	}
+	for _, alias := range e.Aliases {
+		if alias == findingID {
+			return true
+		}
+	}
+	return false
+}
+
+// VariantFor returns the steps for the given distribution, if the catalog has any
+func (e *RemediationCatalogEntry) VariantFor(distro DistroInfo) (*RemediationVariant, bool) {
+	for i := range e.Variants {
+		if e.Variants[i].Matches(distro) {
+			return &e.Variants[i], true
+		}
+	}
+	return nil, false
+}
+
+// ToRemediation converts a catalog entry into the API representation for a distribution
+func (e *RemediationCatalogEntry) ToRemediation(findingID string, distro DistroInfo) Remediation {
+	remediation := Remediation{
+		ID:          e.ID,
+		Title:       e.Title,
+		Description: e.Description,
+		Risk:        e.Risk,
+		Downtime:    e.Downtime,
+		FindingID:   findingID,
+		Distro:      distro.String(),
+	}
+
+	variant, ok := e.VariantFor(distro)
+	if !ok {
+		remediation.Supported = false
+		remediation.Unsupported = fmt.Sprintf("No remediation variant for %s", distro)
+		return remediation
+	}
+
+	commands := make([]string, len(variant.Commands))
+	for i, cmd := range variant.Commands {
+		commands[i] = "sudo " + cmd
+	}
+
+	remediation.Command = strings.Join(commands, " && ")
+	remediation.Verify = variant.Verify
+	remediation.Variant = variant.Label()
+	remediation.Supported = true
+
+	return remediation
+}
+
+// resolveRemediationVariants picks the variant of each entry for a distribution
+func resolveRemediationVariants(entries []*RemediationCatalogEntry, distro DistroInfo) ([]*RemediationVariant, error) {
+	variants := make([]*RemediationVariant, len(entries))
+	var unsupported []string
+
+	for i, entry := range entries {
+		variant, ok := entry.VariantFor(distro)
+		if !ok {
+			unsupported = append(unsupported, entry.ID)
+			continue
+		}
+		variants[i] = variant
+	}
+
+	if len(unsupported) > 0 {
+		return nil, fmt.Errorf("no remediation variant for %s: %s", distro, strings.Join(unsupported, ", "))
+	}
+
+	return variants, nil
+}
+
+// buildRemediationScript renders a self-contained bash script for the given remediations
+func buildRemediationScript(entries []*RemediationCatalogEntry, findings []SecurityFinding, hostname string, distro DistroInfo) (string, error) {
+	variants, err := resolveRemediationVariants(entries, distro)
+	if err != nil {
+		return "", err
+	}
+
+	generatedAt := time.Now()
+	stamp := generatedAt.Format("20060102-150405")
+
+	// Render each remediation as its own function so it can be checksummed
+	blocks := make([]string, 0, len(entries))
+	for i, entry := range entries {
+		blocks = append(blocks, renderRemediationBlock(entry, variants[i]))
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString("#!/usr/bin/env bash\n")
+	sb.WriteString("#\n")
+	sb.WriteString("# UbuntuShield remediation bundle\n")
+	sb.WriteString(fmt.Sprintf("# Generated: %s\n", generatedAt.Format(time.RFC3339)))
+	if hostname != "" {
+		sb.WriteString(fmt.Sprintf("# Host:      %s\n", hostname))
+	}
+	sb.WriteString(fmt.Sprintf("# Target:    %s\n", distro))
+	sb.WriteString("#\n")
+	sb.WriteString("# Findings:\n")
+	for _, entry := range entries {
+		detected := false
+		for _, finding := range findings {
+			if entry.fixesFinding(finding.ID) {
+				sb.WriteString(fmt.Sprintf("#   %-10s %-8s %s -> %s\n", finding.ID, finding.Severity, finding.Title, entry.ID))
+				detected = true
+			}
+		}
+		if !detected {
+			sb.WriteString(fmt.Sprintf("#   %-10s %-8s %s -> %s\n", entry.TestID, "-", "(not detected in current report)", entry.ID))
+		}
+	}
+	sb.WriteString("#\n")
+	sb.WriteString("# Checksums (sha256 of each remediation function):\n")
+	for i, entry := range entries {
+		sum := sha256.Sum256([]byte(blocks[i]))
+		sb.WriteString(fmt.Sprintf("#   %-14s %-16s %s\n", entry.ID, variants[i].Label(), hex.EncodeToString(sum[:])))
+	}
+	sb.WriteString("#\n")
+	sb.WriteString("# Usage: sudo bash <script> [--dry-run]\n")
+	sb.WriteString("#\n\n")
+
+	sb.WriteString("set -u -o pipefail\n\n")
+	sb.WriteString("DRY_RUN=0\n")
+	sb.WriteString("for arg in \"$@\"; do\n")
+	sb.WriteString("  case \"$arg\" in\n")
+	sb.WriteString("    --dry-run) DRY_RUN=1 ;;\n")
+	sb.WriteString("    -h|--help) sed -n '2,/^$/p' \"$0\"; exit 0 ;;\n")
+	sb.WriteString("    *) echo \"Unknown argument: $arg\" >&2; exit 2 ;;\n")
+	sb.WriteString("  esac\n")
+	sb.WriteString("done\n\n")
+
+	sb.WriteString(fmt.Sprintf("LOG_FILE=\"/var/log/ubuntushield-remediation-%s.log\"\n", stamp))
+	sb.WriteString(fmt.Sprintf("BACKUP_DIR=\"/var/backups/ubuntushield/%s\"\n\n", stamp))
+
+	sb.WriteString("if [ \"$DRY_RUN\" -eq 0 ] && [ \"$(id -u)\" -ne 0 ]; then\n")
+	sb.WriteString("  echo \"This script must be run as root (or use --dry-run)\" >&2\n")
+	sb.WriteString("  exit 1\n")
+	sb.WriteString("fi\n")
+	sb.WriteString("if ! touch \"$LOG_FILE\" 2>/dev/null; then\n")
+	sb.WriteString(fmt.Sprintf("  LOG_FILE=\"${TMPDIR:-/tmp}/ubuntushield-remediation-%s.log\"\n", stamp))
+	sb.WriteString("fi\n\n")
+
+	sb.WriteString("log() {\n")
+	sb.WriteString("  printf '%s %s\\n' \"$(date -u +%Y-%m-%dT%H:%M:%SZ)\" \"$*\" | tee -a \"$LOG_FILE\"\n")
+	sb.WriteString("}\n\n")
+	sb.WriteString("fail() {\n")
+	sb.WriteString("  log \"ERROR: $*\"\n")
+	sb.WriteString("  log \"Aborting. Backups (if any) are in $BACKUP_DIR\"\n")
+	sb.WriteString("  exit 1\n")
+	sb.WriteString("}\n\n")
+	sb.WriteString("require() {\n")
+	sb.WriteString("  command -v \"$1\" >/dev/null 2>&1 || fail \"required command not found: $1\"\n")
+	sb.WriteString("}\n\n")
+	sb.WriteString("backup() {\n")
+	sb.WriteString("  [ -e \"$1\" ] || { log \"  no backup needed, $1 does not exist\"; return 0; }\n")
+	sb.WriteString("  if [ \"$DRY_RUN\" -eq 1 ]; then log \"  [dry-run] would back up $1\"; return 0; fi\n")
+	sb.WriteString("  mkdir -p \"$BACKUP_DIR\" || fail \"cannot create $BACKUP_DIR\"\n")
+	sb.WriteString("  cp -a --parents \"$1\" \"$BACKUP_DIR\" || fail \"backup of $1 failed\"\n")
+	sb.WriteString("  log \"  backed up $1\"\n")
+	sb.WriteString("}\n\n")
+	sb.WriteString("verify() {\n")
+	sb.WriteString("  if [ \"$DRY_RUN\" -eq 1 ]; then log \"  [dry-run] would verify: $1\"; return 0; fi\n")
+	sb.WriteString("  bash -c \"$1\" >>\"$LOG_FILE\" 2>&1 || fail \"verification failed: $1\"\n")
+	sb.WriteString("  log \"  verified: $1\"\n")
+	sb.WriteString("}\n\n")
+	sb.WriteString("run() {\n")
+	sb.WriteString("  if [ \"$DRY_RUN\" -eq 1 ]; then log \"  [dry-run] $1\"; return 0; fi\n")
+	sb.WriteString("  log \"  + $1\"\n")
+	sb.WriteString("  bash -c \"$1\" >>\"$LOG_FILE\" 2>&1 || fail \"command failed (exit $?): $1\"\n")
+	sb.WriteString("}\n\n")
+
+	for _, block := range blocks {
+		sb.WriteString(block)
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString("log \"UbuntuShield remediation bundle starting (dry-run=$DRY_RUN)\"\n")
+	for _, entry := range entries {
+		sb.WriteString(remediationFuncName(entry.ID) + "\n")
+	}
+	sb.WriteString("log \"All remediations completed\"\n")
+	sb.WriteString("exit 0\n")
+
+	return sb.String(), nil
+}
+
+// renderRemediationBlock renders the bash function for a single remediation
+func renderRemediationBlock(entry *RemediationCatalogEntry, variant *RemediationVariant) string {
+	var sb strings.Builder
+
+	sb.WriteString(remediationFuncName(entry.ID) + "() {\n")
+	sb.WriteString(fmt.Sprintf("  log %s\n", shellQuote(fmt.Sprintf("==> %s: %s (risk: %s)", entry.ID, entry.Title, entry.Risk))))
+	for _, bin := range variant.Requires {
+		sb.WriteString(fmt.Sprintf("  require %s\n", shellQuote(bin)))
+	}
+	if variant.Precondition != "" {
+		sb.WriteString(fmt.Sprintf("  if ! bash -c %s; then\n", shellQuote(variant.Precondition)))
+		sb.WriteString("    log \"  precondition not met (already compliant), skipping\"\n")
+		sb.WriteString("    return 0\n")
+		sb.WriteString("  fi\n")
+	}
+	for _, file := range variant.BackupFiles {
+		sb.WriteString(fmt.Sprintf("  backup %s\n", shellQuote(file)))
+	}
+	for _, cmd := range variant.Commands {
+		sb.WriteString(fmt.Sprintf("  run %s\n", shellQuote(cmd)))
+	}
+	for _, check := range variant.Verify {
+		sb.WriteString(fmt.Sprintf("  verify %s\n", shellQuote(check)))
+	}
+	sb.WriteString(fmt.Sprintf("  log %s\n", shellQuote(fmt.Sprintf("<== %s done", entry.ID))))
+	sb.WriteString("}\n")
+
+	return sb.String()
+}
+
+// runRemediationScript executes a rendered remediation bundle on the local host
+func runRemediationScript(script string, dryRun bool) (string, int, error) {
+	file, err := os.CreateTemp("", "ubuntushield-remediation-*.sh")
+	if err != nil {
+		return "", -1, fmt.Errorf("failed to create script file: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.WriteString(script); err != nil {
+		file.Close()
+		return "", -1, fmt.Errorf("failed to write script file: %w", err)
+	}
+	file.Close()
+
+	// Dry runs only log what would happen, so they don't need root
+	var cmd *exec.Cmd
+	if dryRun {
+		cmd = exec.Command("bash", file.Name(), "--dry-run")
+	} else {
+		cmd = exec.Command("sudo", "bash", file.Name())
+	}
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return string(output), exitErr.ExitCode(), nil
+		}
+		return string(output), -1, err
+	}
+
+	return string(output), 0, nil
+}
+
+func remediationFuncName(id string) string {
+	return "remediate_" + strings.NewReplacer("-", "_", ".", "_").Replace(id)
+}
+
+// shellQuote wraps s in single quotes so bash treats it literally
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
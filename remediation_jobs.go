@@ -0,0 +1,355 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// remediationDispatchTimeout is how long a dispatched job waits for the agent's result before it's
+// marked timed_out, so jobs of an agent that died don't stay dispatched forever
+const remediationDispatchTimeout = 2 * time.Hour
+
+// RemediationJob is a remediation bundle queued for execution on a remote server
+type RemediationJob struct {
+	ID             string    `json:"id"`
+	ServerID       string    `json:"server_id"`
+	RemediationIDs []string  `json:"remediation_ids"`
+	DryRun         bool      `json:"dry_run"`
+	Status         string    `json:"status"` // queued, deferred, dispatched, succeeded, failed, timed_out
+	Script         string    `json:"script"`
+	ScriptSHA256   string    `json:"script_sha256"`
+	Signature      string    `json:"signature"` // Dashboard key's signature of signedRemediationJob
+	ExitCode       int       `json:"exit_code"`
+	Output         string    `json:"output"`
+	CreatedAt      time.Time `json:"created_at"`
+	DispatchedAt   time.Time `json:"dispatched_at,omitempty"`
+	CompletedAt    time.Time `json:"completed_at,omitempty"`
+	DeferredUntil  time.Time `json:"deferred_until,omitempty"` // When maintenance settings let the job run
+	DeferredReason string    `json:"deferred_reason,omitempty"`
+}
+
+// dispatchedJob locates a remediation job awaiting its agent's result
+type dispatchedJob struct {
+	serverID     string
+	dispatchedAt time.Time
+}
+
+// QueueRemediationJob renders a remediation bundle for a server and queues it for its agent
+func (sm *ServerManager) QueueRemediationJob(serverID string, entries []*RemediationCatalogEntry, dryRun bool) (*RemediationJob, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	// Agents only run scripts signed by the dashboard key they pinned at registration
+	if sm.signer == nil {
+		return nil, fmt.Errorf("remote remediation needs a signing key, set UBUNTUSHIELD_SIGNING_KEY")
+	}
+
+	server, err := sm.loadServerInfo(serverID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Describe findings from the server's last audit in the script header
+	var findings []SecurityFinding
+	distro := detectDistro(nil, server.OS)
+	if metrics, err := sm.latestMetrics(serverID); err == nil {
+		findings = extractSecurityFindings(metrics.RawData)
+		distro = detectDistro(metrics.RawData, server.OS)
+	}
+
+	script, err := buildRemediationScript(entries, findings, server.Hostname, distro)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(script))
+
+	ids := make([]string, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.ID
+	}
+
+	job := &RemediationJob{
+		ID:             generateID(),
+		ServerID:       serverID,
+		RemediationIDs: ids,
+		DryRun:         dryRun,
+		Status:         "queued",
+		Script:         script,
+		ScriptSHA256:   hex.EncodeToString(sum[:]),
+		CreatedAt:      time.Now(),
+	}
+	job.Signature = sm.signer.sign(signedRemediationJob(job))
+
+	if err := sm.saveRemediationJob(job); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// ListRemediationJobs returns all remediation jobs for a server, newest first
+func (sm *ServerManager) ListRemediationJobs(serverID string) ([]*RemediationJob, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	return sm.listRemediationJobs(serverID)
+}
+
+// DispatchRemediationJobs hands queued jobs to the agent and marks them as dispatched
+func (sm *ServerManager) DispatchRemediationJobs(serverID string) ([]*RemediationJob, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	jobs, err := sm.listRemediationJobs(serverID)
+	if err != nil {
+		return nil, err
+	}
+
+	dispatched := []*RemediationJob{}
+	for i := len(jobs) - 1; i >= 0; i-- { // oldest first
+		job := jobs[i]
+		if job.Status != "queued" && job.Status != "deferred" {
+			continue
+		}
+
+		job.Status = "dispatched"
+		job.DispatchedAt = time.Now()
+		if err := sm.saveRemediationJob(job); err != nil {
+			return nil, err
+		}
+		if sm.dispatched != nil {
+			sm.dispatched[job.ID] = dispatchedJob{serverID: serverID, dispatchedAt: job.DispatchedAt}
+		}
+
+		dispatched = append(dispatched, job)
+	}
+
+	return dispatched, nil
+}
+
+// ExpireRemediationJobs marks jobs dispatched longer than remediationDispatchTimeout ago as timed_out on
+// every server. They aren't queued again: the script may have run before the agent went away.
+func (sm *ServerManager) ExpireRemediationJobs() (int, error) {
+	now := time.Now()
+	overdue := func(job dispatchedJob) bool {
+		return now.Sub(job.dispatchedAt) >= remediationDispatchTimeout
+	}
+
+	// Only the index of dispatched jobs is read until one is overdue, so metrics submissions don't wait
+	sm.mu.RLock()
+	due := sm.dispatched == nil
+	for _, job := range sm.dispatched {
+		if overdue(job) {
+			due = true
+			break
+		}
+	}
+	sm.mu.RUnlock()
+	if !due {
+		return 0, nil
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if err := sm.loadDispatchedJobs(); err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for id, dispatched := range sm.dispatched {
+		if !overdue(dispatched) {
+			continue
+		}
+		delete(sm.dispatched, id)
+
+		// The job is gone with its server, or got its result without going through the index
+		job, err := sm.loadRemediationJob(dispatched.serverID, id)
+		if err != nil || job.Status != "dispatched" {
+			continue
+		}
+
+		job.Status = "timed_out"
+		job.ExitCode = -1
+		job.Output = fmt.Sprintf("No result from the agent within %s of dispatch", remediationDispatchTimeout)
+		job.CompletedAt = now
+		if err := sm.saveRemediationJob(job); err != nil {
+			return expired, err
+		}
+		expired++
+	}
+
+	return expired, nil
+}
+
+// ReloadDispatchedJobs drops the index of dispatched jobs, so it's read again from storage after jobs
+// were written behind the manager's back, e.g. by an archive import
+func (sm *ServerManager) ReloadDispatchedJobs() {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	sm.dispatched = nil
+}
+
+// DeferRemediationJobs marks a server's waiting jobs as deferred by its maintenance windows or blackouts
+func (sm *ServerManager) DeferRemediationJobs(serverID string, check MaintenanceCheck) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	jobs, err := sm.listRemediationJobs(serverID)
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		if job.Status != "queued" && job.Status != "deferred" {
+			continue
+		}
+		if job.Status == "deferred" && job.DeferredUntil.Equal(check.NextAllowed) && job.DeferredReason == check.Reason {
+			continue
+		}
+
+		job.Status = "deferred"
+		job.DeferredUntil = check.NextAllowed
+		job.DeferredReason = check.Reason
+		if err := sm.saveRemediationJob(job); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CompleteRemediationJob records the agent's result and requests a re-audit of the server. A result
+// arriving after the job timed out still replaces the timeout.
+func (sm *ServerManager) CompleteRemediationJob(serverID, jobID string, exitCode int, output string) (*RemediationJob, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	job, err := sm.loadRemediationJob(serverID, jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	if job.Status != "dispatched" && job.Status != "timed_out" {
+		return nil, fmt.Errorf("job %s is not awaiting a result (status: %s)", jobID, job.Status)
+	}
+
+	delete(sm.dispatched, jobID)
+	job.ExitCode = exitCode
+	job.Output = output
+	job.CompletedAt = time.Now()
+	if exitCode == 0 {
+		job.Status = "succeeded"
+	} else {
+		job.Status = "failed"
+	}
+
+	if err := sm.saveRemediationJob(job); err != nil {
+		return nil, err
+	}
+
+	// Ask the agent for a fresh audit so the dashboard reflects the change
+	if !job.DryRun {
+		server, err := sm.loadServerInfo(serverID)
+		if err != nil {
+			return nil, err
+		}
+		server.AuditRequested = true
+		server.UpdatedAt = time.Now()
+		if err := sm.saveServerInfo(server); err != nil {
+			return nil, err
+		}
+	}
+
+	return job, nil
+}
+
+// Helper functions
+
+// signedRemediationJob is what the dashboard signs for a job: the script's digest bound to the job, its
+// server and whether it's a dry run, so a signed script can't be replayed elsewhere or run for real
+func signedRemediationJob(job *RemediationJob) string {
+	return fmt.Sprintf("ubuntushield-remediation\n%s\n%s\n%t\n%s", job.ID, job.ServerID, job.DryRun, job.ScriptSHA256)
+}
+
+// loadDispatchedJobs builds the index of dispatched jobs from every server's jobs, unless it's loaded
+func (sm *ServerManager) loadDispatchedJobs() error {
+	if sm.dispatched != nil {
+		return nil
+	}
+
+	servers, err := sm.listServers()
+	if err != nil {
+		return err
+	}
+
+	dispatched := make(map[string]dispatchedJob)
+	for _, server := range servers {
+		jobs, err := sm.listRemediationJobs(server.ID)
+		if err != nil {
+			return err
+		}
+		for _, job := range jobs {
+			if job.Status == "dispatched" {
+				dispatched[job.ID] = dispatchedJob{serverID: server.ID, dispatchedAt: job.DispatchedAt}
+			}
+		}
+	}
+
+	sm.dispatched = dispatched
+	return nil
+}
+
+func jobsBucket(serverID string) string {
+	return serverBucket(serverID) + "/jobs"
+}
+
+func (sm *ServerManager) saveRemediationJob(job *RemediationJob) error {
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return sm.store.Put(jobsBucket(job.ServerID), job.ID, data)
+}
+
+func (sm *ServerManager) loadRemediationJob(serverID, jobID string) (*RemediationJob, error) {
+	data, err := sm.store.Get(jobsBucket(serverID), jobID)
+	if err != nil {
+		return nil, fmt.Errorf("job not found: %w", err)
+	}
+
+	var job RemediationJob
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+func (sm *ServerManager) listRemediationJobs(serverID string) ([]*RemediationJob, error) {
+	ids, err := sm.store.Keys(jobsBucket(serverID))
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := []*RemediationJob{}
+	for _, id := range ids {
+		job, err := sm.loadRemediationJob(serverID, id)
+		if err != nil {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+
+	return jobs, nil
+}
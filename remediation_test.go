@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"strings"
+	"testing"
+)
+
+func TestRemediationVariantMatches(t *testing.T) {
+	ubuntu2204 := DistroInfo{ID: "ubuntu", Family: "debian", Version: "22.04"}
+	rocky93 := DistroInfo{ID: "rocky", Family: "rhel", Version: "9.3"}
+	centos79 := DistroInfo{ID: "centos", Family: "rhel", Version: "7.9"}
+	noVersion := DistroInfo{ID: "debian", Family: "debian"}
+
+	tests := []struct {
+		name    string
+		variant RemediationVariant
+		distro  DistroInfo
+		want    bool
+	}{
+		{"same family", RemediationVariant{Family: "debian"}, ubuntu2204, true},
+		{"other family", RemediationVariant{Family: "rhel"}, ubuntu2204, false},
+		{"any family", RemediationVariant{Family: "any"}, rocky93, true},
+		{"unknown distro needs any", RemediationVariant{Family: "debian"}, DistroInfo{Family: "unknown"}, false},
+		{"min version met", RemediationVariant{Family: "rhel", MinVersion: "8"}, rocky93, true},
+		{"min version not met", RemediationVariant{Family: "rhel", MinVersion: "8"}, centos79, false},
+		{"min version exact", RemediationVariant{Family: "debian", MinVersion: "22.04"}, ubuntu2204, true},
+		{"max version on major only", RemediationVariant{Family: "rhel", MaxVersion: "7"}, centos79, true},
+		{"max version exceeded", RemediationVariant{Family: "rhel", MaxVersion: "7"}, rocky93, false},
+		{"max version on minor", RemediationVariant{Family: "rhel", MaxVersion: "9.2"}, rocky93, false},
+		{"within range", RemediationVariant{Family: "debian", MinVersion: "20.04", MaxVersion: "22.10"}, ubuntu2204, true},
+		{"bound needs a version", RemediationVariant{Family: "debian", MinVersion: "10"}, noVersion, false},
+		{"no bounds without a version", RemediationVariant{Family: "debian"}, noVersion, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.variant.Matches(tt.distro); got != tt.want {
+				t.Errorf("%s.Matches(%s %s) = %v, want %v", tt.variant.Label(), tt.distro.Family, tt.distro.Version, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueueRemediationJobSignsScript(t *testing.T) {
+	store, err := OpenDBStorage(t.TempDir() + "/dashboard.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	entry, ok := getRemediationByID("REM-SSH-001")
+	if !ok {
+		t.Fatal("REM-SSH-001 is missing from the catalog")
+	}
+
+	// Without a signing key agents couldn't check the script, so nothing is queued
+	unsigned := NewServerManager(store, nil)
+	server, err := unsigned.RegisterServer("web-1", "10.0.0.5", "Ubuntu 22.04", "amd64", "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := unsigned.QueueRemediationJob(server.ID, []*RemediationCatalogEntry{entry}, true); err == nil {
+		t.Error("QueueRemediationJob() without a signing key succeeded")
+	}
+
+	signer := &ChainSigner{key: ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))}
+	sm := NewServerManager(store, signer)
+	job, err := sm.QueueRemediationJob(server.ID, []*RemediationCatalogEntry{entry}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !signer.verify(signedRemediationJob(job), job.Signature) {
+		t.Errorf("job signature %q doesn't verify", job.Signature)
+	}
+
+	// The signature covers the dry-run flag and the server, not just the script
+	for _, change := range []func(*RemediationJob){
+		func(j *RemediationJob) { j.DryRun = false },
+		func(j *RemediationJob) { j.ServerID = "other" },
+		func(j *RemediationJob) { j.ScriptSHA256 = strings.Repeat("0", 64) },
+	} {
+		changed := *job
+		change(&changed)
+		if signer.verify(signedRemediationJob(&changed), job.Signature) {
+			t.Errorf("signature still verifies for %+v", changed)
+		}
+	}
+}
+
+func TestExpireRemediationJobs(t *testing.T) {
+	store, err := OpenDBStorage(t.TempDir() + "/dashboard.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	entry, _ := getRemediationByID("REM-SSH-001")
+	signer := &ChainSigner{key: ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))}
+
+	sm := NewServerManager(store, signer)
+	server, err := sm.RegisterServer("web-1", "10.0.0.5", "Ubuntu 22.04", "amd64", "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := sm.QueueRemediationJob(server.ID, []*RemediationCatalogEntry{entry}, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	jobs, err := sm.DispatchRemediationJobs(server.ID)
+	if err != nil || len(jobs) != 3 {
+		t.Fatalf("DispatchRemediationJobs() = %d jobs, %v", len(jobs), err)
+	}
+
+	// Nothing is overdue yet; the first call loads the index of dispatched jobs
+	if expired, err := sm.ExpireRemediationJobs(); expired != 0 || err != nil {
+		t.Fatalf("ExpireRemediationJobs() = %d, %v right after dispatch", expired, err)
+	}
+
+	// Two jobs were dispatched long ago, one of them has reported back
+	for _, job := range jobs[:2] {
+		job.DispatchedAt = job.DispatchedAt.Add(-remediationDispatchTimeout)
+		if err := sm.saveRemediationJob(job); err != nil {
+			t.Fatal(err)
+		}
+		sm.dispatched[job.ID] = dispatchedJob{serverID: server.ID, dispatchedAt: job.DispatchedAt}
+	}
+	if _, err := sm.CompleteRemediationJob(server.ID, jobs[1].ID, 0, "done"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The overdue job expires once, and so it does again for a restarted dashboard reading it from storage
+	for _, manager := range []*ServerManager{sm, NewServerManager(store, signer)} {
+		if err := sm.saveRemediationJob(jobs[0]); err != nil { // Still dispatched
+			t.Fatal(err)
+		}
+		if expired, err := manager.ExpireRemediationJobs(); expired != 1 || err != nil {
+			t.Errorf("ExpireRemediationJobs() = %d, %v, want 1 expired", expired, err)
+		}
+		if expired, err := manager.ExpireRemediationJobs(); expired != 0 || err != nil {
+			t.Errorf("second ExpireRemediationJobs() = %d, %v, want none", expired, err)
+		}
+	}
+
+	want := map[string]string{jobs[0].ID: "timed_out", jobs[1].ID: "succeeded", jobs[2].ID: "dispatched"}
+	stored, err := sm.ListRemediationJobs(server.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, job := range stored {
+		if job.Status != want[job.ID] {
+			t.Errorf("job %s is %s, want %s", job.ID, job.Status, want[job.ID])
+		}
+	}
+}
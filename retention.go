@@ -0,0 +1,475 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Retention settings live with the other settings; the log of cleanup runs under retention_runs/<server>
+const (
+	retentionSettingsKey = "retention"
+	retentionRunsBucket  = "retention_runs"
+)
+
+// RetentionPolicy controls how long audits are kept. In overrides zero inherits the wider policy;
+// -1 keeps audits forever or never compresses them.
+type RetentionPolicy struct {
+	RetentionDays     int `json:"retention_days,omitempty"`      // Delete audits older than this
+	CompressAfterDays int `json:"compress_after_days,omitempty"` // Gzip audits older than this
+}
+
+// RetentionConfig is the global policy with per-tag and per-server overrides. A server's own policy
+// wins over its tags; when several tags apply, the longest retention wins.
+type RetentionConfig struct {
+	Default RetentionPolicy            `json:"default"`
+	Tags    map[string]RetentionPolicy `json:"tags"`
+	Servers map[string]RetentionPolicy `json:"servers"`
+	Holds   []LegalHold                `json:"holds"`
+}
+
+// LegalHold exempts audits from deletion. An empty server ID covers every server; a zero From or
+// To leaves the range open on that side.
+type LegalHold struct {
+	ID        string    `json:"id"`
+	ServerID  string    `json:"server_id,omitempty"`
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// EffectivePolicy is the policy applied to one server and where it came from
+type EffectivePolicy struct {
+	ServerID string          `json:"server_id"`
+	Policy   RetentionPolicy `json:"policy"`
+	Sources  []string        `json:"sources"` // default, tag:<name>, server
+	Holds    []LegalHold     `json:"holds"`   // Holds covering the server
+}
+
+// RetentionCounts summarises the cleanup of one store
+type RetentionCounts struct {
+	Deleted    int `json:"deleted"`
+	Compressed int `json:"compressed"`
+	Held       int `json:"held"` // Expired audits kept because of a legal hold
+}
+
+// RetentionRun is the log entry of one cleanup of a server
+type RetentionRun struct {
+	ID            string          `json:"id"`
+	ServerID      string          `json:"server_id"`
+	StartedAt     time.Time       `json:"started_at"`
+	Policy        EffectivePolicy `json:"policy"`
+	History       RetentionCounts `json:"history"`
+	Metrics       RetentionCounts `json:"metrics"`
+	HistoryPruned []string        `json:"history_pruned,omitempty"` // Hashes of deleted chained records
+	MetricsPruned []string        `json:"metrics_pruned,omitempty"`
+	Error         string          `json:"error,omitempty"`
+}
+
+// DefaultRetentionPolicy keeps a year of audits and compresses them after a month
+var DefaultRetentionPolicy = RetentionPolicy{
+	RetentionDays:     365,
+	CompressAfterDays: 30,
+}
+
+// RetentionManager applies retention policies to the history and stored metrics of every server
+type RetentionManager struct {
+	store     Storage
+	servers   *ServerManager
+	histories *HistoryManagers
+	config    RetentionConfig
+	mu        sync.RWMutex
+	runMu     sync.Mutex // One cleanup at a time, so runs never overlap on the same buckets
+}
+
+// NewRetentionManager creates a retention manager, loading the saved configuration if there is one
+func NewRetentionManager(store Storage, servers *ServerManager, histories *HistoryManagers) (*RetentionManager, error) {
+	rm := &RetentionManager{
+		store:     store,
+		servers:   servers,
+		histories: histories,
+		config: RetentionConfig{
+			Default: DefaultRetentionPolicy,
+			Tags:    map[string]RetentionPolicy{},
+			Servers: map[string]RetentionPolicy{},
+			Holds:   []LegalHold{},
+		},
+	}
+
+	data, err := store.Get(settingsBucket, retentionSettingsKey)
+	if errors.Is(err, ErrNotFound) {
+		return rm, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &rm.config); err != nil {
+		return nil, fmt.Errorf("failed to decode retention settings: %w", err)
+	}
+
+	return rm, nil
+}
+
+// Config returns the current configuration
+func (rm *RetentionManager) Config() RetentionConfig {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	return rm.config
+}
+
+// SetPolicies validates and persists the default, tag and server policies. Legal holds are kept.
+func (rm *RetentionManager) SetPolicies(config RetentionConfig) error {
+	if config.Default.RetentionDays == 0 || config.Default.CompressAfterDays == 0 {
+		return fmt.Errorf("the default policy must set retention_days and compress_after_days")
+	}
+	if err := config.Default.validate(); err != nil {
+		return fmt.Errorf("default policy: %w", err)
+	}
+	for tag, policy := range config.Tags {
+		if err := policy.validate(); err != nil {
+			return fmt.Errorf("policy of tag %s: %w", tag, err)
+		}
+	}
+	for serverID, policy := range config.Servers {
+		if err := policy.validate(); err != nil {
+			return fmt.Errorf("policy of server %s: %w", serverID, err)
+		}
+	}
+	if config.Tags == nil {
+		config.Tags = map[string]RetentionPolicy{}
+	}
+	if config.Servers == nil {
+		config.Servers = map[string]RetentionPolicy{}
+	}
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	config.Holds = rm.config.Holds
+	return rm.save(config)
+}
+
+// AddHold places a legal hold on a server, or on every server when ServerID is empty
+func (rm *RetentionManager) AddHold(hold LegalHold) (*LegalHold, error) {
+	if !hold.From.IsZero() && !hold.To.IsZero() && hold.To.Before(hold.From) {
+		return nil, fmt.Errorf("hold must not end before it starts")
+	}
+	if hold.ServerID != "" {
+		if _, err := rm.servers.GetServer(hold.ServerID); err != nil {
+			return nil, fmt.Errorf("server not found: %w", err)
+		}
+	}
+
+	hold.ID = "hold_" + generateID()[:8]
+	hold.CreatedAt = time.Now()
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	config := rm.config
+	config.Holds = append(append([]LegalHold{}, rm.config.Holds...), hold)
+	if err := rm.save(config); err != nil {
+		return nil, err
+	}
+
+	return &hold, nil
+}
+
+// RemoveHold lifts a legal hold
+func (rm *RetentionManager) RemoveHold(id string) error {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	config := rm.config
+	config.Holds = []LegalHold{}
+	for _, hold := range rm.config.Holds {
+		if hold.ID != id {
+			config.Holds = append(config.Holds, hold)
+		}
+	}
+	if len(config.Holds) == len(rm.config.Holds) {
+		return fmt.Errorf("legal hold %s not found", id)
+	}
+
+	return rm.save(config)
+}
+
+// PolicyFor resolves the policy and legal holds that apply to a server
+func (rm *RetentionManager) PolicyFor(serverID string) (EffectivePolicy, error) {
+	server, err := rm.servers.GetServer(serverID)
+	if err != nil {
+		return EffectivePolicy{}, fmt.Errorf("server not found: %w", err)
+	}
+
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	effective := EffectivePolicy{
+		ServerID: serverID,
+		Policy:   rm.config.Default,
+		Sources:  []string{"default"},
+		Holds:    []LegalHold{},
+	}
+
+	// Tags are merged first, keeping the longest retention when they disagree
+	tags := append([]string{}, server.Tags...)
+	sort.Strings(tags)
+	var tagPolicy RetentionPolicy
+	for _, tag := range tags {
+		if policy, ok := rm.config.Tags[tag]; ok {
+			tagPolicy.RetentionDays = longerDays(tagPolicy.RetentionDays, policy.RetentionDays)
+			tagPolicy.CompressAfterDays = longerDays(tagPolicy.CompressAfterDays, policy.CompressAfterDays)
+			effective.Sources = append(effective.Sources, "tag:"+tag)
+		}
+	}
+	effective.Policy = effective.Policy.override(tagPolicy)
+
+	if policy, ok := rm.config.Servers[serverID]; ok {
+		effective.Policy = effective.Policy.override(policy)
+		effective.Sources = append(effective.Sources, "server")
+	}
+
+	for _, hold := range rm.config.Holds {
+		if hold.ServerID == "" || hold.ServerID == serverID {
+			effective.Holds = append(effective.Holds, hold)
+		}
+	}
+
+	return effective, nil
+}
+
+// Run cleans up the history and stored metrics of one server and logs the policy it applied
+func (rm *RetentionManager) Run(serverID string) (*RetentionRun, error) {
+	rm.runMu.Lock()
+	defer rm.runMu.Unlock()
+
+	return rm.run(serverID)
+}
+
+// RunAll cleans up every registered server in one pass
+func (rm *RetentionManager) RunAll() ([]*RetentionRun, error) {
+	rm.runMu.Lock()
+	defer rm.runMu.Unlock()
+
+	servers, err := rm.servers.ListServers()
+	if err != nil {
+		return nil, err
+	}
+
+	runs := []*RetentionRun{}
+	for _, server := range servers {
+		run, err := rm.run(server.ID)
+		if err != nil {
+			log.Printf("⚠️ %v", err)
+		}
+		if run != nil {
+			runs = append(runs, run)
+		}
+	}
+
+	return runs, nil
+}
+
+// run does the work of Run; the caller holds runMu
+func (rm *RetentionManager) run(serverID string) (*RetentionRun, error) {
+	effective, err := rm.PolicyFor(serverID)
+	if err != nil {
+		return nil, err
+	}
+	held := func(at time.Time) bool {
+		for _, hold := range effective.Holds {
+			if hold.covers(at) {
+				return true
+			}
+		}
+		return false
+	}
+
+	run := &RetentionRun{
+		ID:        fmt.Sprintf("%s_%s", time.Now().UTC().Format("20060102T150405"), generateID()[:8]),
+		ServerID:  serverID,
+		StartedAt: time.Now(),
+		Policy:    effective,
+	}
+
+	log.Printf("🧹 Retention run for %s: %s (%s, %d legal hold(s))",
+		serverID, effective.Policy, strings.Join(effective.Sources, " → "), len(effective.Holds))
+
+	var errs []string
+	if history, err := rm.histories.For(serverID); err != nil {
+		errs = append(errs, err.Error())
+	} else if run.History, run.HistoryPruned, err = history.CleanupOldRecords(effective.Policy, held); err != nil {
+		errs = append(errs, fmt.Sprintf("history: %v", err))
+	}
+	if run.Metrics, run.MetricsPruned, err = rm.servers.CleanupMetrics(serverID, effective.Policy, held); err != nil {
+		errs = append(errs, fmt.Sprintf("metrics: %v", err))
+	}
+	run.Error = strings.Join(errs, "; ")
+
+	if run.changed() {
+		log.Printf("🧹 Retention run for %s: history %d deleted, %d compressed, %d held; metrics %d deleted, %d compressed, %d held",
+			serverID, run.History.Deleted, run.History.Compressed, run.History.Held, run.Metrics.Deleted, run.Metrics.Compressed, run.Metrics.Held)
+
+		// Runs that changed nothing are only logged; the others explain gaps in the audit chains
+		data, err := json.MarshalIndent(run, "", "  ")
+		if err != nil {
+			return run, err
+		}
+		if err := rm.store.Put(retentionRunsBucket+"/"+serverID, run.ID, data); err != nil {
+			return run, fmt.Errorf("failed to save retention run: %w", err)
+		}
+	}
+
+	if run.Error != "" {
+		return run, fmt.Errorf("retention run for %s failed: %s", serverID, run.Error)
+	}
+	return run, nil
+}
+
+// Runs returns logged cleanup runs, newest first; an empty serverID means every server
+func (rm *RetentionManager) Runs(serverID string, limit int) ([]*RetentionRun, error) {
+	serverIDs := []string{serverID}
+	if serverID == "" {
+		var err error
+		serverIDs, err = rm.store.Buckets(retentionRunsBucket)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	runs := []*RetentionRun{}
+	for _, id := range serverIDs {
+		bucket := retentionRunsBucket + "/" + id
+		keys, err := rm.store.Keys(bucket)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range keys {
+			data, err := rm.store.Get(bucket, key)
+			if err != nil {
+				continue
+			}
+
+			var run RetentionRun
+			if err := json.Unmarshal(data, &run); err != nil {
+				continue
+			}
+			runs = append(runs, &run)
+		}
+	}
+
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].StartedAt.After(runs[j].StartedAt)
+	})
+
+	if limit > 0 && len(runs) > limit {
+		runs = runs[:limit]
+	}
+
+	return runs, nil
+}
+
+// PrunedHashes returns the hashes of a server's history records and metrics deleted by retention
+func (rm *RetentionManager) PrunedHashes(serverID string) (map[string]bool, map[string]bool, error) {
+	runs, err := rm.Runs(serverID, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	history, metrics := map[string]bool{}, map[string]bool{}
+	for _, run := range runs {
+		for _, hash := range run.HistoryPruned {
+			history[hash] = true
+		}
+		for _, hash := range run.MetricsPruned {
+			metrics[hash] = true
+		}
+	}
+
+	return history, metrics, nil
+}
+
+// Helper functions
+
+func (rm *RetentionManager) save(config RetentionConfig) error {
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := rm.store.Put(settingsBucket, retentionSettingsKey, data); err != nil {
+		return fmt.Errorf("failed to save retention settings: %w", err)
+	}
+	rm.config = config
+
+	return nil
+}
+
+func (p RetentionPolicy) validate() error {
+	if p.RetentionDays < -1 || p.CompressAfterDays < -1 {
+		return fmt.Errorf("days must be positive, 0 to inherit or -1 to disable")
+	}
+	return nil
+}
+
+// override returns the policy with the fields set in other replacing its own
+func (p RetentionPolicy) override(other RetentionPolicy) RetentionPolicy {
+	if other.RetentionDays != 0 {
+		p.RetentionDays = other.RetentionDays
+	}
+	if other.CompressAfterDays != 0 {
+		p.CompressAfterDays = other.CompressAfterDays
+	}
+	return p
+}
+
+// expired reports whether an audit taken at the given time is past retention
+func (p RetentionPolicy) expired(at time.Time) bool {
+	return p.RetentionDays > 0 && at.Before(time.Now().AddDate(0, 0, -p.RetentionDays))
+}
+
+// compressible reports whether an audit taken at the given time is old enough to compress
+func (p RetentionPolicy) compressible(at time.Time) bool {
+	return p.CompressAfterDays > 0 && at.Before(time.Now().AddDate(0, 0, -p.CompressAfterDays))
+}
+
+func (p RetentionPolicy) String() string {
+	keep := "keep forever"
+	if p.RetentionDays > 0 {
+		keep = fmt.Sprintf("keep %d days", p.RetentionDays)
+	}
+	compress := "never compress"
+	if p.CompressAfterDays > 0 {
+		compress = fmt.Sprintf("compress after %d days", p.CompressAfterDays)
+	}
+	return keep + ", " + compress
+}
+
+// covers reports whether an audit taken at the given time is under the hold
+func (h LegalHold) covers(at time.Time) bool {
+	return (h.From.IsZero() || !at.Before(h.From)) && (h.To.IsZero() || !at.After(h.To))
+}
+
+func (run *RetentionRun) changed() bool {
+	return run.History.Deleted+run.History.Compressed+run.Metrics.Deleted+run.Metrics.Compressed > 0 || run.Error != ""
+}
+
+// longerDays picks the longer of two day counts, where -1 means forever and 0 unset
+func longerDays(a, b int) int {
+	if a == -1 || b == -1 {
+		return -1
+	}
+	if b > a {
+		return b
+	}
+	return a
+}
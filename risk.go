@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RiskFactor explains one component of a finding's risk score
+type RiskFactor struct {
+	Factor string  `json:"factor"` // severity, exposure, criticality, age
+	Points float64 `json:"points"`
+	Detail string  `json:"detail"`
+}
+
+// RiskContext holds what we know about the server a finding was seen on
+type RiskContext struct {
+	FirewallActive bool   `json:"firewall_active"`
+	ExposedPorts   int    `json:"exposed_ports"` // Listening ports not bound to loopback
+	Criticality    string `json:"criticality"`   // low, medium, high, critical
+}
+
+// Risk score weights. The maximum total is 100.
+var (
+	severityPoints = map[string]float64{
+		"critical": 50,
+		"high":     40,
+		"medium":   25,
+		"low":      10,
+	}
+	criticalityPoints = map[string]float64{
+		"low":      0,
+		"medium":   5,
+		"high":     10,
+		"critical": 15,
+	}
+)
+
+const (
+	maxExposurePoints = 20.0
+	maxAgePoints      = 15.0
+	agePointsPerMonth = 5.0
+)
+
+// newRiskContext derives exposure from a report and combines it with the server's criticality
+func newRiskContext(data map[string]string, criticality string) RiskContext {
+	ctx := RiskContext{
+		FirewallActive: data["firewall_active"] == "1" ||
+			strings.Contains(strings.ToLower(data["firewall_status"]), "active"),
+		Criticality: normalizeCriticality(criticality),
+	}
+
+	// network_listen_port[]=0.0.0.0:22|tcp|sshd|
+	exposed := make(map[string]bool)
+	for _, entry := range reportArray(data, "network_listen_port") {
+		parts := strings.Split(entry, "|")
+		address := parts[0]
+		if strings.HasPrefix(address, "127.") || strings.HasPrefix(address, "[::1]") ||
+			strings.HasPrefix(address, "::1") || strings.HasPrefix(address, "localhost") {
+			continue
+		}
+
+		port := address
+		if i := strings.LastIndex(address, ":"); i >= 0 {
+			port = address[i+1:]
+		}
+		protocol := ""
+		if len(parts) > 1 {
+			protocol = strings.TrimSuffix(parts[1], "6")
+		}
+		exposed[port+"/"+protocol] = true
+	}
+	ctx.ExposedPorts = len(exposed)
+
+	return ctx
+}
+
+// scoreRisk combines severity, exposure, server criticality and age into a 0-100 score
+func scoreRisk(severity, category string, firstSeen time.Time, ctx RiskContext) (float64, []RiskFactor) {
+	var factors []RiskFactor
+
+	// Severity from the catalog or the built-in check
+	severity = strings.ToLower(severity)
+	points, ok := severityPoints[severity]
+	if !ok {
+		points = severityPoints["low"]
+	}
+	factors = append(factors, RiskFactor{
+		Factor: "severity",
+		Points: points,
+		Detail: fmt.Sprintf("%s severity", severity),
+	})
+
+	// Exposure: open ports and a missing firewall matter most for network-facing findings
+	exposure := 0.0
+	if !ctx.FirewallActive {
+		exposure += 10
+	}
+	exposure += math.Min(float64(ctx.ExposedPorts), 10)
+	detail := fmt.Sprintf("%d exposed listening ports, firewall %s", ctx.ExposedPorts, map[bool]string{true: "active", false: "inactive"}[ctx.FirewallActive])
+	if category != "network" && category != "authentication" {
+		exposure /= 2
+		detail += " (halved, finding is not network-facing)"
+	}
+	factors = append(factors, RiskFactor{
+		Factor: "exposure",
+		Points: math.Min(exposure, maxExposurePoints),
+		Detail: detail,
+	})
+
+	// Server criticality
+	criticality := normalizeCriticality(ctx.Criticality)
+	factors = append(factors, RiskFactor{
+		Factor: "criticality",
+		Points: criticalityPoints[criticality],
+		Detail: fmt.Sprintf("%s criticality server", criticality),
+	})
+
+	// Age: findings that stay open keep getting more urgent
+	age := 0.0
+	days := 0.0
+	if !firstSeen.IsZero() {
+		days = time.Since(firstSeen).Hours() / 24
+		age = math.Min(days/30*agePointsPerMonth, maxAgePoints)
+	}
+	factors = append(factors, RiskFactor{
+		Factor: "age",
+		Points: math.Round(age*10) / 10,
+		Detail: fmt.Sprintf("open for %.0f days", days),
+	})
+
+	total := 0.0
+	for _, factor := range factors {
+		total += factor.Points
+	}
+
+	return math.Round(total*10) / 10, factors
+}
+
+// applyRiskScores scores each finding; firstSeen looks up when a finding was first observed
+func applyRiskScores(findings []SecurityFinding, ctx RiskContext, firstSeen func(findingID string) time.Time) {
+	for i := range findings {
+		var seen time.Time
+		if firstSeen != nil {
+			seen = firstSeen(findings[i].ID)
+		}
+		findings[i].RiskScore, findings[i].RiskFactors = scoreRisk(findings[i].Severity, findings[i].Category, seen, ctx)
+	}
+}
+
+// sortFindings orders findings by "risk" (highest first), "severity" or "id"; anything else keeps the order
+func sortFindings(findings []SecurityFinding, by string) {
+	switch by {
+	case "risk":
+		sort.SliceStable(findings, func(i, j int) bool {
+			return findings[i].RiskScore > findings[j].RiskScore
+		})
+	case "severity":
+		sort.SliceStable(findings, func(i, j int) bool {
+			return severityPoints[findings[i].Severity] > severityPoints[findings[j].Severity]
+		})
+	case "id":
+		sort.SliceStable(findings, func(i, j int) bool {
+			return findings[i].ID < findings[j].ID
+		})
+	}
+}
+
+func normalizeCriticality(criticality string) string {
+	criticality = strings.ToLower(criticality)
+	if _, ok := criticalityPoints[criticality]; ok {
+		return criticality
+	}
+	return "medium"
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScoreRisk(t *testing.T) {
+	daysAgo := func(days int) time.Time { return time.Now().Add(-time.Duration(days) * 24 * time.Hour) }
+
+	tests := []struct {
+		name      string
+		severity  string
+		category  string
+		firstSeen time.Time
+		ctx       RiskContext
+		want      float64
+		points    map[string]float64 // Per factor
+	}{
+		{
+			name:      "everything at its maximum",
+			severity:  "critical",
+			category:  "network",
+			firstSeen: daysAgo(365),
+			ctx:       RiskContext{ExposedPorts: 25, Criticality: "critical"},
+			want:      100,
+			points:    map[string]float64{"severity": 50, "exposure": 20, "criticality": 15, "age": 15},
+		},
+		{
+			name:     "network-facing finding behind a firewall",
+			severity: "high",
+			category: "authentication",
+			ctx:      RiskContext{FirewallActive: true, ExposedPorts: 3, Criticality: "medium"},
+			want:     48,
+			points:   map[string]float64{"severity": 40, "exposure": 3, "criticality": 5, "age": 0},
+		},
+		{
+			name:      "exposure is halved for local findings",
+			severity:  "medium",
+			category:  "kernel",
+			firstSeen: daysAgo(45),
+			ctx:       RiskContext{ExposedPorts: 4, Criticality: "low"},
+			want:      39.5,
+			points:    map[string]float64{"severity": 25, "exposure": 7, "criticality": 0, "age": 7.5},
+		},
+		{
+			name:     "unknown severity and criticality fall back",
+			severity: "unheard-of",
+			category: "network",
+			ctx:      RiskContext{FirewallActive: true, Criticality: "mission-critical"},
+			want:     15,
+			points:   map[string]float64{"severity": 10, "exposure": 0, "criticality": 5, "age": 0},
+		},
+		{
+			name:     "severity is case insensitive",
+			severity: "HIGH",
+			category: "network",
+			ctx:      RiskContext{FirewallActive: true, Criticality: "LOW"},
+			want:     40,
+			points:   map[string]float64{"severity": 40, "exposure": 0, "criticality": 0, "age": 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, factors := scoreRisk(tt.severity, tt.category, tt.firstSeen, tt.ctx)
+			if score != tt.want {
+				t.Errorf("score = %v, want %v (factors %+v)", score, tt.want, factors)
+			}
+
+			if len(factors) != len(tt.points) {
+				t.Fatalf("got %d factors, want %d: %+v", len(factors), len(tt.points), factors)
+			}
+			for _, factor := range factors {
+				if want, ok := tt.points[factor.Factor]; !ok || factor.Points != want {
+					t.Errorf("%s = %v points, want %v", factor.Factor, factor.Points, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewRiskContext(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     map[string]string
+		firewall bool
+		exposed  int
+	}{
+		{"empty report", map[string]string{}, false, 0},
+		{"firewall active flag", map[string]string{"firewall_active": "1"}, true, 0},
+		{"firewall status", map[string]string{"firewall_status": "Active"}, true, 0},
+		{
+			name: "loopback ports aren't exposed",
+			data: map[string]string{"network_listen_port[]": "127.0.0.1:631|tcp|cupsd|\n[::1]:631|tcp6|cupsd|\n::1:25|tcp6|exim|\nlocalhost:5432|tcp|postgres|"},
+		},
+		{
+			name:    "ports count once per protocol",
+			data:    map[string]string{"network_listen_port[]": "0.0.0.0:22|tcp|sshd|\n[::]:22|tcp6|sshd|\n0.0.0.0:53|udp|named|\n0.0.0.0:53|tcp|named|"},
+			exposed: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := newRiskContext(tt.data, "high")
+			if ctx.FirewallActive != tt.firewall || ctx.ExposedPorts != tt.exposed {
+				t.Errorf("newRiskContext() = %+v, want firewall %v and %d exposed ports", ctx, tt.firewall, tt.exposed)
+			}
+			if ctx.Criticality != "high" {
+				t.Errorf("criticality = %q, want high", ctx.Criticality)
+			}
+		})
+	}
+}
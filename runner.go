@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Lynis runners
+const (
+	runnerSudo   = "sudo"
+	runnerDirect = "direct"
+	runnerFake   = "fake"
+)
+
+// Runner runs a Lynis system audit. On success the report is at reportPath, readable by the dashboard.
+type Runner interface {
+	// Available returns why audits can't run, e.g. a missing binary
+	Available() error
+	// Run audits the system, writing Lynis output to output as it comes, and returns the exit code.
+	// When ctx ends the audit is stopped and ctx's error returned.
+	Run(ctx context.Context, reportPath string, quiet bool, output io.Writer) (int, error)
+	// String describes the runner for logs
+	String() string
+}
+
+// RunnerConfig selects how Lynis runs and where its report goes
+type RunnerConfig struct {
+	Runner     string   // sudo, direct or fake
+	Binary     string   // Lynis executable, looked up on the PATH unless it's a path
+	Flags      []string // Extra flags, e.g. --profile /etc/lynis/custom.prf or --tests-from-group malware
+	Fixtures   []string // Report files, or directories of *.dat files, the fake runner replays
+	ReportPath string   // Where audits leave their report
+}
+
+// DefaultRunnerConfig runs "sudo lynis" and keeps the report in the data directory. The environment
+// overrides it: UBUNTUSHIELD_LYNIS_RUNNER, UBUNTUSHIELD_LYNIS_BINARY, UBUNTUSHIELD_LYNIS_FLAGS
+// (space-separated), UBUNTUSHIELD_LYNIS_FIXTURES (comma-separated) and UBUNTUSHIELD_REPORT_PATH.
+func DefaultRunnerConfig() RunnerConfig {
+	config := RunnerConfig{
+		Runner:     runnerSudo,
+		Binary:     "lynis",
+		ReportPath: "./data/lynis-report.dat",
+	}
+
+	if runner := os.Getenv("UBUNTUSHIELD_LYNIS_RUNNER"); runner != "" {
+		config.Runner = runner
+	}
+	if binary := os.Getenv("UBUNTUSHIELD_LYNIS_BINARY"); binary != "" {
+		config.Binary = binary
+	}
+	if flags := os.Getenv("UBUNTUSHIELD_LYNIS_FLAGS"); flags != "" {
+		config.Flags = strings.Fields(flags)
+	}
+	if fixtures := os.Getenv("UBUNTUSHIELD_LYNIS_FIXTURES"); fixtures != "" {
+		config.Fixtures = strings.Split(fixtures, ",")
+	}
+	if path := os.Getenv("UBUNTUSHIELD_REPORT_PATH"); path != "" {
+		config.ReportPath = path
+	}
+
+	return config
+}
+
+// NewRunner creates the runner selected in the config
+func NewRunner(config RunnerConfig) (Runner, error) {
+	switch config.Runner {
+	case runnerSudo:
+		return &SudoRunner{DirectRunner{Binary: config.Binary, Flags: config.Flags}}, nil
+	case runnerDirect:
+		return &DirectRunner{Binary: config.Binary, Flags: config.Flags}, nil
+	case runnerFake:
+		return NewFakeRunner(config.Fixtures)
+	default:
+		return nil, fmt.Errorf("unknown Lynis runner %q (expected %s, %s or %s)", config.Runner, runnerSudo, runnerDirect, runnerFake)
+	}
+}
+
+// DirectRunner runs Lynis as the dashboard's own user, for dashboards running as root
+type DirectRunner struct {
+	Binary string
+	Flags  []string
+}
+
+// Available checks that the binary exists
+func (r *DirectRunner) Available() error {
+	if _, err := exec.LookPath(r.Binary); err != nil {
+		return fmt.Errorf("Lynis not found (%s). Please install Lynis first", r.Binary)
+	}
+	return nil
+}
+
+// Run runs the audit
+func (r *DirectRunner) Run(ctx context.Context, reportPath string, quiet bool, output io.Writer) (int, error) {
+	return runCommand(ctx, exec.CommandContext(ctx, r.Binary, r.args(reportPath, quiet)...), output)
+}
+
+func (r *DirectRunner) String() string {
+	return strings.Join(append([]string{r.Binary}, r.Flags...), " ")
+}
+
+// args returns the audit command line after the binary
+func (r *DirectRunner) args(reportPath string, quiet bool) []string {
+	args := []string{"audit", "system", "--quick", "--report-file", reportPath}
+	if quiet {
+		args = append(args, "--quiet")
+	}
+	return append(args, r.Flags...)
+}
+
+// SudoRunner runs Lynis through non-interactive sudo, so a missing sudoers rule fails at once instead
+// of waiting for a password. The report is handed to the dashboard's user afterwards.
+type SudoRunner struct {
+	DirectRunner
+}
+
+// Run runs the audit as root
+func (r *SudoRunner) Run(ctx context.Context, reportPath string, quiet bool, output io.Writer) (int, error) {
+	args := append([]string{"-n", r.Binary}, r.args(reportPath, quiet)...)
+	exitCode, err := runCommand(ctx, exec.CommandContext(ctx, "sudo", args...), output)
+
+	// Lynis creates the report as root, readable by root only
+	if _, statErr := os.Stat(reportPath); statErr == nil {
+		owner := fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())
+		if chownErr := exec.Command("sudo", "-n", "chown", owner, reportPath).Run(); chownErr != nil && err == nil {
+			err = fmt.Errorf("failed to take ownership of the report: %w", chownErr)
+		}
+	}
+	return exitCode, err
+}
+
+func (r *SudoRunner) String() string {
+	return "sudo " + r.DirectRunner.String()
+}
+
+// FakeRunner replays fixture reports in turn instead of running Lynis, for demos and development. The
+// Lynis output saved next to a fixture as <fixture>.log, if any, is replayed with it.
+type FakeRunner struct {
+	Fixtures []string
+	Delay    time.Duration // How long a fake audit takes
+
+	mu   sync.Mutex
+	next int
+}
+
+// NewFakeRunner creates a fake runner from report files and directories of *.dat files
+func NewFakeRunner(paths []string) (*FakeRunner, error) {
+	runner := &FakeRunner{Delay: 2 * time.Second}
+	for _, path := range paths {
+		path = strings.TrimSpace(path)
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("fixture report: %w", err)
+		}
+		if !info.IsDir() {
+			runner.Fixtures = append(runner.Fixtures, path)
+			continue
+		}
+
+		matches, err := filepath.Glob(filepath.Join(path, "*.dat"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+		runner.Fixtures = append(runner.Fixtures, matches...)
+	}
+
+	if len(runner.Fixtures) == 0 {
+		return nil, fmt.Errorf("the fake Lynis runner needs fixture reports (UBUNTUSHIELD_LYNIS_FIXTURES)")
+	}
+	return runner, nil
+}
+
+// Available always succeeds; fixtures are checked when the runner is created
+func (r *FakeRunner) Available() error {
+	return nil
+}
+
+// Run copies the next fixture to reportPath, spreading its output over the runner's delay
+func (r *FakeRunner) Run(ctx context.Context, reportPath string, quiet bool, output io.Writer) (int, error) {
+	r.mu.Lock()
+	fixture := r.Fixtures[r.next%len(r.Fixtures)]
+	r.next++
+	r.mu.Unlock()
+
+	lines := []string{"Replayed fixture report " + fixture}
+	if saved, err := os.ReadFile(fixture + ".log"); err == nil && !quiet {
+		lines = append(strings.Split(strings.TrimRight(string(saved), "\n"), "\n"), lines...)
+	}
+
+	pause := r.Delay / time.Duration(len(lines))
+	for _, line := range lines {
+		select {
+		case <-time.After(pause):
+		case <-ctx.Done():
+			return -1, ctx.Err()
+		}
+		fmt.Fprintln(output, line)
+	}
+
+	data, err := os.ReadFile(fixture)
+	if err != nil {
+		return -1, fmt.Errorf("failed to read fixture report: %w", err)
+	}
+	if err := os.WriteFile(reportPath, data, 0600); err != nil {
+		return -1, fmt.Errorf("failed to write report: %w", err)
+	}
+	return 0, nil
+}
+
+func (r *FakeRunner) String() string {
+	return fmt.Sprintf("fake (%d fixture reports)", len(r.Fixtures))
+}
+
+// runCommand runs an audit command in its own process group, writing its output to output. When ctx
+// ends the group gets SIGTERM, which sudo passes on to Lynis, and SIGKILL after a grace period.
+func runCommand(ctx context.Context, cmd *exec.Cmd, output io.Writer) (int, error) {
+	setProcessGroup(cmd)
+	var kill *time.Timer
+	cmd.Cancel = func() error {
+		kill = time.AfterFunc(auditKillGrace, func() { killProcessGroup(cmd, true) })
+		return killProcessGroup(cmd, false)
+	}
+	cmd.WaitDelay = auditKillGrace + 5*time.Second // Stop waiting on output held open by unkillable children
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	log.Printf("🚀 Executing %s\n", strings.Join(cmd.Args, " "))
+	err := cmd.Run()
+	if kill != nil {
+		kill.Stop()
+	}
+	if ctx.Err() != nil {
+		return -1, ctx.Err()
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode(), fmt.Errorf("Lynis exited with status %d", exitErr.ExitCode())
+	}
+	if err != nil {
+		return -1, fmt.Errorf("failed to run Lynis: %w", err)
+	}
+
+	return 0, nil
+}
@@ -1,43 +1,129 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"os/exec"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
+// The scheduler configuration and run state are saved with the other settings
+const (
+	schedulerSettingsKey = "scheduler"
+	maxCatchUpRuns       = 24 // Cap of audits the "all" catch-up policy runs after downtime
+)
+
 // SchedulerConfig holds scheduling configuration
 type SchedulerConfig struct {
-	Enabled       bool
-	Interval      time.Duration
-	RunOnStartup  bool
-	QuietMode     bool
-	LastRunTime   time.Time
-	NextRunTime   time.Time
+	Enabled      bool            `json:"enabled"`
+	Schedules    []AuditSchedule `json:"schedules"` // Audits run whenever any schedule fires
+	RunOnStartup bool            `json:"run_on_startup"`
+	QuietMode    bool            `json:"quiet_mode"`
+	CatchUp      string          `json:"catch_up"` // What to do about runs missed while down: once, skip or all
+	LastRunTime  time.Time       `json:"last_run"`
+	NextRunTime  time.Time       `json:"next_run"` // Earliest next run of all schedules
+	LastCatchUp  *CatchUpReport  `json:"last_catch_up,omitempty"`
+}
+
+// CatchUpReport describes the runs found missed at the last start
+type CatchUpReport struct {
+	DetectedAt time.Time `json:"detected_at"`
+	Policy     string    `json:"policy"`
+	Missed     int       `json:"missed"`
+	Ran        int       `json:"ran"`
+	Since      time.Time `json:"since"` // First missed run
+}
+
+// AuditSchedule is a named cron schedule of local audits
+type AuditSchedule struct {
+	Name    string    `json:"name"`
+	Cron    string    `json:"cron"` // e.g. "30 2 * * 1-5 Europe/Berlin" or "@daily"
+	LastRun time.Time `json:"last_run"`
+	NextRun time.Time `json:"next_run"`
+
+	spec *CronSchedule
+}
+
+// schedulePresets are the interval names accepted before cron schedules existed
+var schedulePresets = map[string]string{
+	"hourly":  "@hourly",
+	"daily":   "@daily",
+	"weekly":  "@weekly",
+	"monthly": "@monthly",
 }
 
+// catchUpPolicies are the accepted values of SchedulerConfig.CatchUp
+var catchUpPolicies = map[string]bool{"once": true, "skip": true, "all": true}
+
 // AuditScheduler manages scheduled Lynis audits
 type AuditScheduler struct {
-	config         SchedulerConfig
-	historyManager *HistoryManager
-	stopChan       chan bool
-	running        bool
+	store       Storage
+	config      SchedulerConfig
+	submitAudit func(trigger, schedule string, quiet bool) (*AuditJob, error) // Queues an audit of the dashboard host
+	stopChan    chan bool
+	running     bool
+	mu          sync.Mutex // Guards config, which the schedule loop updates
+}
+
+// NewAuditSchedule validates a named cron schedule; preset names such as "daily" are accepted too
+func NewAuditSchedule(name, expr string) (AuditSchedule, error) {
+	if name == "" {
+		return AuditSchedule{}, fmt.Errorf("schedule name is required")
+	}
+	if preset, ok := schedulePresets[expr]; ok {
+		expr = preset
+	}
+
+	spec, err := ParseCron(expr)
+	if err != nil {
+		return AuditSchedule{}, err
+	}
+
+	return AuditSchedule{Name: name, Cron: spec.Expr, spec: spec}, nil
 }
 
-// NewAuditScheduler creates a new scheduler
-func NewAuditScheduler(historyManager *HistoryManager) *AuditScheduler {
-	return &AuditScheduler{
+// NewAuditScheduler creates a new scheduler that queues its audits with submitAudit, restoring the
+// configuration and run state saved in the store
+func NewAuditScheduler(store Storage, submitAudit func(trigger, schedule string, quiet bool) (*AuditJob, error)) (*AuditScheduler, error) {
+	s := &AuditScheduler{
+		store: store,
 		config: SchedulerConfig{
 			Enabled:      false, // Disabled by default, user can enable via settings
-			Interval:     24 * time.Hour, // Default: daily
+			Schedules:    presetSchedules("@daily"),
 			RunOnStartup: false,
 			QuietMode:    true,
+			CatchUp:      "once",
 		},
-		historyManager: historyManager,
-		stopChan:       make(chan bool),
-		running:        false,
+		submitAudit: submitAudit,
+		stopChan:    make(chan bool),
+		running:     false,
+	}
+
+	data, err := store.Get(settingsBucket, schedulerSettingsKey)
+	if errors.Is(err, ErrNotFound) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var config SchedulerConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to decode scheduler settings: %w", err)
 	}
+	if config.Schedules, err = parseSchedules(config.Schedules); err != nil {
+		return nil, fmt.Errorf("invalid saved scheduler settings: %w", err)
+	}
+	if !catchUpPolicies[config.CatchUp] {
+		config.CatchUp = "once"
+	}
+	s.config = config
+
+	return s, nil
 }
 
 // Start begins the scheduler
@@ -52,12 +138,30 @@ func (s *AuditScheduler) Start() error {
 	}
 
 	s.running = true
-	log.Printf("⏰ Audit scheduler started - will run every %s\n", s.config.Interval)
+	names := make([]string, len(s.config.Schedules))
+	for i, schedule := range s.config.Schedules {
+		names[i] = fmt.Sprintf("%s (%s)", schedule.Name, schedule.Cron)
+	}
+	log.Printf("⏰ Audit scheduler started - schedules: %s\n", strings.Join(names, ", "))
+
+	// Runs that should have happened while the dashboard was down, from the saved next runs
+	s.mu.Lock()
+	missed := s.missedRuns(time.Now())
+	catchUp := s.planCatchUp(missed)
 
-	// Run on startup if configured
-	if s.config.RunOnStartup {
+	// Plan right away so the status shows the next run before the loop starts
+	s.planNextRuns(time.Now())
+	s.save()
+	s.mu.Unlock()
+
+	if catchUp > 0 {
+		for i := 0; i < catchUp; i++ {
+			s.runAudit("catch-up", "")
+		}
+	} else if s.config.RunOnStartup {
+		// Run on startup if configured
 		log.Println("🚀 Running audit on startup...")
-		go s.runAudit()
+		s.runAudit("startup", "")
 	}
 
 	// Start the scheduling loop
@@ -77,165 +181,300 @@ func (s *AuditScheduler) Stop() {
 	s.running = false
 }
 
-// UpdateConfig updates scheduler configuration
-func (s *AuditScheduler) UpdateConfig(config SchedulerConfig) {
-	wasRunning := s.running
-	
-	if wasRunning {
+// UpdateConfig validates and applies a scheduler configuration, restarting the scheduler if needed
+func (s *AuditScheduler) UpdateConfig(config SchedulerConfig) error {
+	if config.CatchUp == "" {
+		config.CatchUp = "once"
+	}
+	if !catchUpPolicies[config.CatchUp] {
+		return fmt.Errorf("invalid catch-up policy %q (expected once, skip or all)", config.CatchUp)
+	}
+
+	schedules, err := parseSchedules(config.Schedules)
+	if err != nil {
+		return err
+	}
+	config.Schedules = schedules
+
+	// Runs missed while a schedule was changed or disabled are not caught up
+	for i := range config.Schedules {
+		config.Schedules[i].NextRun = time.Time{}
+	}
+
+	if s.running {
 		s.Stop()
 	}
 
+	s.mu.Lock()
+	config.LastRunTime = s.config.LastRunTime
+	config.NextRunTime = time.Time{}
+	config.LastCatchUp = s.config.LastCatchUp
 	s.config = config
+	err = s.save()
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
 
-	if wasRunning && config.Enabled {
-		s.Start()
+	if config.Enabled {
+		return s.Start()
 	}
+	return nil
+}
+
+// Config returns a copy of the current configuration
+func (s *AuditScheduler) Config() SchedulerConfig {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	config := s.config
+	config.Schedules = append([]AuditSchedule{}, s.config.Schedules...)
+	return config
 }
 
 // GetStatus returns current scheduler status
 func (s *AuditScheduler) GetStatus() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedules := make([]map[string]interface{}, len(s.config.Schedules))
+	for i, schedule := range s.config.Schedules {
+		schedules[i] = map[string]interface{}{
+			"name":     schedule.Name,
+			"cron":     schedule.Cron,
+			"timezone": schedule.spec.Location.String(),
+			"last_run": schedule.LastRun,
+			"next_run": schedule.NextRun,
+		}
+	}
+
 	return map[string]interface{}{
-		"enabled":       s.config.Enabled,
-		"running":       s.running,
-		"interval":      s.config.Interval.String(),
-		"last_run":      s.config.LastRunTime,
-		"next_run":      s.config.NextRunTime,
+		"enabled":        s.config.Enabled,
+		"running":        s.running,
+		"schedules":      schedules,
+		"last_run":       s.config.LastRunTime,
+		"next_run":       s.config.NextRunTime,
 		"run_on_startup": s.config.RunOnStartup,
-		"quiet_mode":    s.config.QuietMode,
+		"quiet_mode":     s.config.QuietMode,
+		"catch_up":       s.config.CatchUp,
+		"last_catch_up":  s.config.LastCatchUp,
 	}
 }
 
-// scheduleLoop is the main scheduling loop
+// scheduleLoop is the main scheduling loop: it sleeps until the earliest schedule fires
 func (s *AuditScheduler) scheduleLoop() {
-	ticker := time.NewTicker(s.config.Interval)
-	defer ticker.Stop()
-
-	// Calculate next run time
-	s.config.NextRunTime = time.Now().Add(s.config.Interval)
-	log.Printf("📅 Next scheduled audit: %s\n", s.config.NextRunTime.Format("2006-01-02 15:04:05"))
-
 	for {
+		s.mu.Lock()
+		due := s.planNextRuns(time.Now())
+		next := s.config.NextRunTime
+		s.save()
+		s.mu.Unlock()
+
+		if next.IsZero() {
+			log.Println("📅 No schedule will fire again")
+			<-s.stopChan
+			log.Println("⏰ Scheduler stopped")
+			return
+		}
+		log.Printf("📅 Next scheduled audit: %s (%s)\n", next.Format("2006-01-02 15:04:05 MST"), strings.Join(due, ", "))
+
+		timer := time.NewTimer(time.Until(next))
 		select {
-		case <-ticker.C:
-			log.Println("⏰ Scheduled audit triggered")
-			s.runAudit()
-			s.config.NextRunTime = time.Now().Add(s.config.Interval)
+		case <-timer.C:
+			log.Printf("⏰ Scheduled audit triggered by %s\n", strings.Join(due, ", "))
+			s.mu.Lock()
+			for i := range s.config.Schedules {
+				if s.config.Schedules[i].NextRun.Equal(next) {
+					s.config.Schedules[i].LastRun = next
+				}
+			}
+			s.mu.Unlock()
+			s.runAudit("schedule", strings.Join(due, ", "))
 
 		case <-s.stopChan:
+			timer.Stop()
 			log.Println("⏰ Scheduler stopped")
 			return
 		}
 	}
 }
 
-// runAudit executes a Lynis audit
-func (s *AuditScheduler) runAudit() {
-	s.config.LastRunTime = time.Now()
-	log.Printf("🔍 Starting scheduled Lynis audit at %s\n", s.config.LastRunTime.Format("2006-01-02 15:04:05"))
+// planNextRuns computes each schedule's next run after now and returns the names of the schedules
+// due first. Callers hold mu.
+func (s *AuditScheduler) planNextRuns(now time.Time) []string {
+	s.config.NextRunTime = time.Time{}
+	var due []string
+	for i := range s.config.Schedules {
+		schedule := &s.config.Schedules[i]
+		schedule.NextRun = schedule.spec.Next(now)
+		if schedule.NextRun.IsZero() {
+			continue
+		}
 
-	// Check if Lynis is available
-	lynisPath, err := exec.LookPath("lynis")
-	if err != nil {
-		log.Printf("❌ Lynis not found: %v\n", err)
-		return
+		switch {
+		case s.config.NextRunTime.IsZero() || schedule.NextRun.Before(s.config.NextRunTime):
+			s.config.NextRunTime = schedule.NextRun
+			due = []string{schedule.Name}
+		case schedule.NextRun.Equal(s.config.NextRunTime):
+			due = append(due, schedule.Name)
+		}
 	}
+	sort.Strings(due)
+	return due
+}
 
-	log.Printf("✅ Found Lynis at: %s\n", lynisPath)
+// missedRuns returns the distinct times schedules should have fired between their saved next run
+// and now. Callers hold mu.
+func (s *AuditScheduler) missedRuns(now time.Time) []time.Time {
+	seen := map[time.Time]bool{}
+	var missed []time.Time
+	for _, schedule := range s.config.Schedules {
+		// Counting stops well past the cap; a run per minute for years isn't worth walking
+		for at := schedule.NextRun; !at.IsZero() && !at.After(now) && len(missed) <= 10*maxCatchUpRuns; at = schedule.spec.Next(at) {
+			if !seen[at.UTC()] {
+				seen[at.UTC()] = true
+				missed = append(missed, at)
+			}
+		}
+	}
 
-	// Prepare audit command
-	var cmd *exec.Cmd
-	if s.config.QuietMode {
-		cmd = exec.Command("sudo", "lynis", "audit", "system", "--quick", "--quiet")
-	} else {
-		cmd = exec.Command("sudo", "lynis", "audit", "system", "--quick")
+	sort.Slice(missed, func(i, j int) bool { return missed[i].Before(missed[j]) })
+	return missed
+}
+
+// planCatchUp applies the catch-up policy to missed runs, recording the decision, and returns how
+// many audits to run now. Callers hold mu.
+func (s *AuditScheduler) planCatchUp(missed []time.Time) int {
+	if len(missed) == 0 {
+		return 0
 	}
 
-	// Run the audit
-	log.Println("🚀 Executing Lynis audit...")
-	output, err := cmd.CombinedOutput()
-	
-	if err != nil {
-		log.Printf("⚠️ Lynis audit completed with warnings: %v\n", err)
-		if !s.config.QuietMode {
-			log.Printf("Output: %s\n", string(output))
+	report := &CatchUpReport{
+		DetectedAt: time.Now(),
+		Policy:     s.config.CatchUp,
+		Missed:     len(missed),
+		Since:      missed[0],
+	}
+	switch s.config.CatchUp {
+	case "skip":
+		report.Ran = 0
+	case "all":
+		report.Ran = len(missed)
+		if report.Ran > maxCatchUpRuns {
+			report.Ran = maxCatchUpRuns
 		}
-	} else {
-		log.Println("✅ Lynis audit completed successfully")
+	default:
+		report.Ran = 1
 	}
-
-	// Save to history
-	log.Println("💾 Saving audit results to history...")
-	data, err := parseLynisReport()
-	if err != nil {
-		log.Printf("❌ Failed to parse Lynis report: %v\n", err)
-		return
+	s.config.LastCatchUp = report
+
+	// Missed runs count as handled either way, so they aren't caught up again
+	for i := range s.config.Schedules {
+		for _, at := range missed {
+			if s.config.Schedules[i].spec.Next(at.Add(-time.Minute)).Equal(at) && at.After(s.config.Schedules[i].LastRun) {
+				s.config.Schedules[i].LastRun = at
+			}
+		}
 	}
 
-	// Analyze compliance
-	compliance := analyzeCompliance(data)
+	log.Printf("⏰ Missed %d scheduled audit(s) since %s; catch-up policy %q runs %d now\n",
+		report.Missed, report.Since.Format("2006-01-02 15:04:05 MST"), report.Policy, report.Ran)
+	return report.Ran
+}
 
-	// Save to history
-	if err := s.historyManager.SaveAudit(data, compliance); err != nil {
-		log.Printf("❌ Failed to save to history: %v\n", err)
-		return
+// save persists the configuration and run state. Callers hold mu.
+func (s *AuditScheduler) save() error {
+	data, err := json.MarshalIndent(s.config, "", "  ")
+	if err != nil {
+		return err
 	}
 
-	log.Println("✅ Audit results saved to history")
-
-	// Log summary
-	if hardening, exists := data["hardening_index"]; exists {
-		log.Printf("📊 Security Score: %s%%\n", hardening)
-	}
-	if warnings, exists := data["warnings"]; exists {
-		log.Printf("⚠️ Warnings: %s\n", warnings)
+	if err := s.store.Put(settingsBucket, schedulerSettingsKey, data); err != nil {
+		log.Printf("⚠️ Failed to save scheduler state: %v\n", err)
+		return fmt.Errorf("failed to save scheduler settings: %w", err)
 	}
+	return nil
 }
 
-// RunManualAudit runs an audit manually (called from API)
-func (s *AuditScheduler) RunManualAudit() error {
-	if !s.running {
-		// If scheduler not running, run audit directly
-		go s.runAudit()
-		return nil
+// runAudit queues a local audit; the job queue makes sure it doesn't overlap another one
+func (s *AuditScheduler) runAudit(trigger, schedule string) {
+	s.mu.Lock()
+	s.config.LastRunTime = time.Now()
+	quiet := s.config.QuietMode
+	s.save()
+	s.mu.Unlock()
+
+	if _, err := s.submitAudit(trigger, schedule, quiet); err != nil {
+		log.Printf("❌ Failed to queue %s audit: %v\n", trigger, err)
 	}
+}
 
-	// Trigger immediate audit
-	go s.runAudit()
-	return nil
+// RunManualAudit queues an audit manually (called from API)
+func (s *AuditScheduler) RunManualAudit() (*AuditJob, error) {
+	return s.submitAudit("manual", "", false)
 }
 
 // Preset schedule configurations
 var (
-	// HourlySchedule runs audit every hour
+	// HourlySchedule runs audit at the start of every hour
 	HourlySchedule = SchedulerConfig{
 		Enabled:      true,
-		Interval:     1 * time.Hour,
+		Schedules:    presetSchedules("@hourly"),
 		RunOnStartup: false,
 		QuietMode:    true,
 	}
 
-	// DailySchedule runs audit once per day
+	// DailySchedule runs audit every day at midnight
 	DailySchedule = SchedulerConfig{
 		Enabled:      true,
-		Interval:     24 * time.Hour,
+		Schedules:    presetSchedules("@daily"),
 		RunOnStartup: false,
 		QuietMode:    true,
 	}
 
-	// WeeklySchedule runs audit once per week
+	// WeeklySchedule runs audit every Sunday
 	WeeklySchedule = SchedulerConfig{
 		Enabled:      true,
-		Interval:     7 * 24 * time.Hour,
+		Schedules:    presetSchedules("@weekly"),
 		RunOnStartup: false,
 		QuietMode:    true,
 	}
 
-	// MonthlySchedule runs audit once per month
+	// MonthlySchedule runs audit on the first of every month
 	MonthlySchedule = SchedulerConfig{
 		Enabled:      true,
-		Interval:     30 * 24 * time.Hour,
+		Schedules:    presetSchedules("@monthly"),
 		RunOnStartup: false,
 		QuietMode:    true,
 	}
 )
 
+// parseSchedules validates named schedules, keeping their run state
+func parseSchedules(schedules []AuditSchedule) ([]AuditSchedule, error) {
+	if len(schedules) == 0 {
+		return nil, fmt.Errorf("at least one schedule is required")
+	}
+
+	parsed := make([]AuditSchedule, len(schedules))
+	names := map[string]bool{}
+	for i, schedule := range schedules {
+		if names[schedule.Name] {
+			return nil, fmt.Errorf("duplicate schedule name %q", schedule.Name)
+		}
+		names[schedule.Name] = true
+
+		var err error
+		if parsed[i], err = NewAuditSchedule(schedule.Name, schedule.Cron); err != nil {
+			return nil, fmt.Errorf("schedule %s: %w", schedule.Name, err)
+		}
+		parsed[i].LastRun = schedule.LastRun
+		parsed[i].NextRun = schedule.NextRun
+	}
+	return parsed, nil
+}
+
+// presetSchedules is a single default schedule for the presets
+func presetSchedules(expr string) []AuditSchedule {
+	schedule, _ := NewAuditSchedule("default", expr)
+	return []AuditSchedule{schedule}
+}
@@ -5,29 +5,33 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"os"
-	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
 
 // ServerInfo represents a registered server
 type ServerInfo struct {
-	ID           string    `json:"id"`
-	Hostname     string    `json:"hostname"`
-	IPAddress    string    `json:"ip_address"`
-	OS           string    `json:"os"`
-	Arch         string    `json:"arch"`
-	AgentVersion string    `json:"agent_version"`
-	APIKey       string    `json:"api_key"`
-	Status       string    `json:"status"` // active, warning, offline
-	LastHeartbeat time.Time `json:"last_heartbeat"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID             string    `json:"id"`
+	Hostname       string    `json:"hostname"`
+	IPAddress      string    `json:"ip_address"`
+	OS             string    `json:"os"`
+	Arch           string    `json:"arch"`
+	AgentVersion   string    `json:"agent_version"`
+	APIKey         string    `json:"api_key"`
+	Status         string    `json:"status"` // active, warning, offline
+	LastHeartbeat  time.Time `json:"last_heartbeat"`
+	AuditRequested bool      `json:"audit_requested"` // Agent should re-audit on its next poll
+	Criticality    string    `json:"criticality"`     // low, medium, high, critical
+	Local          bool      `json:"local"`           // The dashboard host itself, audited without an agent
+	Tags           []string  `json:"tags,omitempty"`  // Free-form labels, e.g. pci or production
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
 }
 
 // ServerMetrics represents metrics from a server
 type ServerMetrics struct {
+	ID              string                 `json:"id"` // Storage key, e.g. audit_2024-01-31_02-00-00
 	ServerID        string                 `json:"server_id"`
 	Timestamp       time.Time              `json:"timestamp"`
 	HardeningIndex  string                 `json:"hardening_index"`
@@ -35,21 +39,24 @@ type ServerMetrics struct {
 	TestsPerformed  string                 `json:"tests_performed"`
 	ComplianceScore map[string]interface{} `json:"compliance_score"`
 	RawData         map[string]string      `json:"raw_data"`
+	AuditID         string                 `json:"audit_id,omitempty"` // Live progress stream of the agent audit
+	ChainLink
 }
 
 // ServerManager manages multiple servers
 type ServerManager struct {
-	serversDir string
-	mu         sync.RWMutex
-}
+	store  Storage
+	signer *ChainSigner // Signs chained metrics, nil leaves them unsigned
+	mu     sync.RWMutex
 
-// NewServerManager creates a new server manager
-func NewServerManager(dataDir string) *ServerManager {
-	serversDir := filepath.Join(dataDir, "servers")
-	os.MkdirAll(serversDir, 0755)
+	dispatched map[string]dispatchedJob // Remediation jobs awaiting a result by ID, nil until loaded
+}
 
+// NewServerManager creates a new server manager on top of the given storage
+func NewServerManager(store Storage, signer *ChainSigner) *ServerManager {
 	return &ServerManager{
-		serversDir: serversDir,
+		store:  store,
+		signer: signer,
 	}
 }
 
@@ -63,32 +70,51 @@ func (sm *ServerManager) RegisterServer(hostname, ipAddress, osName, arch, agent
 	apiKey := generateAPIKey()
 
 	server := &ServerInfo{
-		ID:           id,
-		Hostname:     hostname,
-		IPAddress:    ipAddress,
-		OS:           osName,
-		Arch:         arch,
-		AgentVersion: agentVersion,
-		APIKey:       apiKey,
-		Status:       "active",
+		ID:            id,
+		Hostname:      hostname,
+		IPAddress:     ipAddress,
+		OS:            osName,
+		Arch:          arch,
+		AgentVersion:  agentVersion,
+		APIKey:        apiKey,
+		Status:        "active",
 		LastHeartbeat: time.Now(),
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
 	}
 
-	// Create server directory
-	serverDir := filepath.Join(sm.serversDir, id)
-	if err := os.MkdirAll(serverDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create server directory: %w", err)
+	// Save server info
+	if err := sm.saveServerInfo(server); err != nil {
+		return nil, err
 	}
 
-	// Create audits subdirectory
-	auditsDir := filepath.Join(serverDir, "audits")
-	if err := os.MkdirAll(auditsDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create audits directory: %w", err)
+	return server, nil
+}
+
+// EnsureLocalServer registers the dashboard host as a server, refreshing its details on every start
+func (sm *ServerManager) EnsureLocalServer(hostname, osName, arch string) (*ServerInfo, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	server, err := sm.loadServerInfo(localServerID)
+	if err != nil {
+		server = &ServerInfo{
+			ID:        localServerID,
+			CreatedAt: time.Now(),
+		}
 	}
 
-	// Save server info
+	server.Hostname = hostname
+	server.IPAddress = "127.0.0.1"
+	server.OS = osName
+	server.Arch = arch
+	server.AgentVersion = "dashboard"
+	server.APIKey = "" // Never reachable through the agent API
+	server.Local = true
+	server.Status = "active"
+	server.LastHeartbeat = time.Now()
+	server.UpdatedAt = time.Now()
+
 	if err := sm.saveServerInfo(server); err != nil {
 		return nil, err
 	}
@@ -119,21 +145,46 @@ func (sm *ServerManager) SaveMetrics(metrics *ServerMetrics) error {
 	defer sm.mu.Unlock()
 
 	// Verify server exists
-	if _, err := sm.loadServerInfo(metrics.ServerID); err != nil {
+	server, err := sm.loadServerInfo(metrics.ServerID)
+	if err != nil {
 		return fmt.Errorf("server not found: %w", err)
 	}
 
-	// Save metrics to file
-	auditsDir := filepath.Join(sm.serversDir, metrics.ServerID, "audits")
-	filename := fmt.Sprintf("audit_%s.json", metrics.Timestamp.Format("2006-01-02_15-04-05"))
-	filepath := filepath.Join(auditsDir, filename)
+	// A fresh audit satisfies any pending re-audit request
+	if server.AuditRequested {
+		server.AuditRequested = false
+		server.UpdatedAt = time.Now()
+		if err := sm.saveServerInfo(server); err != nil {
+			return err
+		}
+	}
+
+	if metrics.Timestamp.IsZero() {
+		metrics.Timestamp = time.Now()
+	}
+
+	// Link to the previous submission; whatever link the agent sent is replaced
+	prevHash, err := sm.chainHead(metrics.ServerID, metrics.Timestamp)
+	if err != nil {
+		return err
+	}
+	metrics.ID = auditKey(metrics.Timestamp, func(key string) bool {
+		_, err := sm.store.Get(auditsBucket(metrics.ServerID), key)
+		return err == nil
+	})
+	metrics.PrevHash = prevHash
+	sum, err := metrics.chainHash()
+	if err != nil {
+		return err
+	}
+	sm.signer.seal(&metrics.ChainLink, sum)
 
 	data, err := json.MarshalIndent(metrics, "", "  ")
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(filepath, data, 0644)
+	return sm.store.Put(auditsBucket(metrics.ServerID), metrics.ID, data)
 }
 
 // GetServer returns server info by ID
@@ -149,6 +200,10 @@ func (sm *ServerManager) GetServerByAPIKey(apiKey string) (*ServerInfo, error) {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
+	if apiKey == "" {
+		return nil, fmt.Errorf("server not found with API key")
+	}
+
 	servers, err := sm.listServers()
 	if err != nil {
 		return nil, err
@@ -176,53 +231,15 @@ func (sm *ServerManager) GetServerMetrics(serverID string, limit int) ([]*Server
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
-	auditsDir := filepath.Join(sm.serversDir, serverID, "audits")
-	
-	files, err := os.ReadDir(auditsDir)
-	if err != nil {
-		return nil, err
-	}
-
-	var metrics []*ServerMetrics
-	count := 0
-
-	// Read files in reverse order (newest first)
-	for i := len(files) - 1; i >= 0 && count < limit; i-- {
-		file := files[i]
-		if file.IsDir() {
-			continue
-		}
-
-		filePath := filepath.Join(auditsDir, file.Name())
-		data, err := os.ReadFile(filePath)
-		if err != nil {
-			continue
-		}
-
-		var m ServerMetrics
-		if err := json.Unmarshal(data, &m); err != nil {
-			continue
-		}
-
-		metrics = append(metrics, &m)
-		count++
-	}
-
-	return metrics, nil
+	return sm.serverMetrics(serverID, limit)
 }
 
 // GetLatestMetrics returns the most recent metrics for a server
 func (sm *ServerManager) GetLatestMetrics(serverID string) (*ServerMetrics, error) {
-	metrics, err := sm.GetServerMetrics(serverID, 1)
-	if err != nil {
-		return nil, err
-	}
-
-	if len(metrics) == 0 {
-		return nil, fmt.Errorf("no metrics found")
-	}
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
 
-	return metrics[0], nil
+	return sm.latestMetrics(serverID)
 }
 
 // UpdateServerStatus updates server status based on heartbeat
@@ -237,6 +254,11 @@ func (sm *ServerManager) UpdateServerStatus() error {
 
 	now := time.Now()
 	for _, server := range servers {
+		// The dashboard host is up whenever this code runs
+		if server.Local {
+			server.LastHeartbeat = now
+		}
+
 		timeSinceHeartbeat := now.Sub(server.LastHeartbeat)
 
 		if timeSinceHeartbeat > 10*time.Minute {
@@ -264,11 +286,11 @@ func (sm *ServerManager) GetDashboardStats() (map[string]interface{}, error) {
 	}
 
 	stats := map[string]interface{}{
-		"total_servers": len(servers),
-		"active":        0,
-		"warning":       0,
-		"offline":       0,
-		"avg_score":     0.0,
+		"total_servers":  len(servers),
+		"active":         0,
+		"warning":        0,
+		"offline":        0,
+		"avg_score":      0.0,
 		"total_warnings": 0,
 	}
 
@@ -286,7 +308,7 @@ func (sm *ServerManager) GetDashboardStats() (map[string]interface{}, error) {
 		}
 
 		// Get latest metrics for score
-		metrics, err := sm.GetLatestMetrics(server.ID)
+		metrics, err := sm.latestMetrics(server.ID)
 		if err == nil && metrics.HardeningIndex != "" {
 			var score float64
 			fmt.Sscanf(metrics.HardeningIndex, "%f", &score)
@@ -306,33 +328,147 @@ func (sm *ServerManager) GetDashboardStats() (map[string]interface{}, error) {
 	return stats, nil
 }
 
+// SetCriticality updates how business-critical a server is, used for risk scoring
+func (sm *ServerManager) SetCriticality(serverID, criticality string) (*ServerInfo, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if _, ok := criticalityPoints[criticality]; !ok {
+		return nil, fmt.Errorf("invalid criticality %q (expected low, medium, high or critical)", criticality)
+	}
+
+	server, err := sm.loadServerInfo(serverID)
+	if err != nil {
+		return nil, err
+	}
+
+	server.Criticality = criticality
+	server.UpdatedAt = time.Now()
+
+	if err := sm.saveServerInfo(server); err != nil {
+		return nil, err
+	}
+
+	return server, nil
+}
+
+// SetTags replaces the labels of a server, used to select retention policies
+func (sm *ServerManager) SetTags(serverID string, tags []string) (*ServerInfo, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	server, err := sm.loadServerInfo(serverID)
+	if err != nil {
+		return nil, err
+	}
+
+	server.Tags = []string{}
+	for _, tag := range tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			server.Tags = append(server.Tags, tag)
+		}
+	}
+	server.UpdatedAt = time.Now()
+
+	if err := sm.saveServerInfo(server); err != nil {
+		return nil, err
+	}
+
+	return server, nil
+}
+
+// CleanupMetrics deletes and compresses a server's stored metrics according to a retention policy.
+// Metrics under legal hold are never deleted. Returns the hashes of deleted metrics.
+func (sm *ServerManager) CleanupMetrics(serverID string, policy RetentionPolicy, held func(time.Time) bool) (RetentionCounts, []string, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	var counts RetentionCounts
+	var pruned []string
+
+	keys, err := sm.store.Keys(auditsBucket(serverID))
+	if err != nil {
+		return counts, nil, err
+	}
+
+	for _, key := range keys {
+		// Keys sort chronologically; stop at the first one too recent to need work, with a day of
+		// slack for older keys written in local time
+		if at, err := time.Parse("audit_2006-01-02_15-04-05", key); err == nil {
+			if !policy.expired(at.Add(trendDay)) && !policy.compressible(at.Add(trendDay)) {
+				break
+			}
+		}
+
+		data, err := sm.store.Get(auditsBucket(serverID), key)
+		if err != nil {
+			return counts, pruned, err
+		}
+
+		var m ServerMetrics
+		if err := json.Unmarshal(decodedStoredValue(data), &m); err != nil {
+			continue
+		}
+
+		if policy.expired(m.Timestamp) {
+			if held(m.Timestamp) {
+				counts.Held++
+			} else {
+				if err := sm.store.Delete(auditsBucket(serverID), key); err != nil {
+					return counts, pruned, err
+				}
+				if m.Hash != "" {
+					pruned = append(pruned, m.Hash)
+				}
+				counts.Deleted++
+				continue
+			}
+		}
+
+		if !isGzipped(data) && policy.compressible(m.Timestamp) {
+			compressed, err := gzipValue(data)
+			if err != nil {
+				return counts, pruned, err
+			}
+			if err := sm.store.Put(auditsBucket(serverID), key, compressed); err != nil {
+				return counts, pruned, err
+			}
+			counts.Compressed++
+		}
+	}
+
+	return counts, pruned, nil
+}
+
 // DeleteServer removes a server and all its data
 func (sm *ServerManager) DeleteServer(serverID string) error {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	serverDir := filepath.Join(sm.serversDir, serverID)
-	return os.RemoveAll(serverDir)
+	return sm.store.DeleteBucket(serverBucket(serverID))
 }
 
 // Helper functions
 
-func (sm *ServerManager) saveServerInfo(server *ServerInfo) error {
-	serverDir := filepath.Join(sm.serversDir, server.ID)
-	infoPath := filepath.Join(serverDir, "info.json")
+func serverBucket(serverID string) string {
+	return serversBucket + "/" + serverID
+}
 
+func auditsBucket(serverID string) string {
+	return serverBucket(serverID) + "/audits"
+}
+
+func (sm *ServerManager) saveServerInfo(server *ServerInfo) error {
 	data, err := json.MarshalIndent(server, "", "  ")
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(infoPath, data, 0644)
+	return sm.store.Put(serverBucket(server.ID), "info", data)
 }
 
 func (sm *ServerManager) loadServerInfo(serverID string) (*ServerInfo, error) {
-	infoPath := filepath.Join(sm.serversDir, serverID, "info.json")
-
-	data, err := os.ReadFile(infoPath)
+	data, err := sm.store.Get(serverBucket(serverID), "info")
 	if err != nil {
 		return nil, fmt.Errorf("server not found: %w", err)
 	}
@@ -346,26 +482,74 @@ func (sm *ServerManager) loadServerInfo(serverID string) (*ServerInfo, error) {
 }
 
 func (sm *ServerManager) listServers() ([]*ServerInfo, error) {
-	entries, err := os.ReadDir(sm.serversDir)
+	ids, err := sm.store.Buckets(serversBucket)
 	if err != nil {
 		return nil, err
 	}
 
 	var servers []*ServerInfo
-	for _, entry := range entries {
-		if !entry.IsDir() {
+	for _, id := range ids {
+		server, err := sm.loadServerInfo(id)
+		if err != nil {
 			continue
 		}
 
-		server, err := sm.loadServerInfo(entry.Name())
+		servers = append(servers, server)
+	}
+
+	return servers, nil
+}
+
+func (sm *ServerManager) serverMetrics(serverID string, limit int) ([]*ServerMetrics, error) {
+	keys, err := sm.store.Keys(auditsBucket(serverID))
+	if err != nil {
+		return nil, err
+	}
+
+	var metrics []*ServerMetrics
+	count := 0
+
+	// Read keys in reverse order (newest first)
+	for i := len(keys) - 1; i >= 0 && count < limit; i-- {
+		m, err := sm.loadMetrics(serverID, keys[i])
 		if err != nil {
 			continue
 		}
 
-		servers = append(servers, server)
+		metrics = append(metrics, m)
+		count++
 	}
 
-	return servers, nil
+	return metrics, nil
+}
+
+func (sm *ServerManager) loadMetrics(serverID, id string) (*ServerMetrics, error) {
+	data, err := sm.store.Get(auditsBucket(serverID), id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Old metrics are compressed by the retention cleanup
+	var m ServerMetrics
+	if err := json.Unmarshal(decodedStoredValue(data), &m); err != nil {
+		return nil, err
+	}
+	m.ID = id
+
+	return &m, nil
+}
+
+func (sm *ServerManager) latestMetrics(serverID string) (*ServerMetrics, error) {
+	metrics, err := sm.serverMetrics(serverID, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(metrics) == 0 {
+		return nil, fmt.Errorf("no metrics found")
+	}
+
+	return metrics[0], nil
 }
 
 func generateID() string {
@@ -379,4 +563,3 @@ func generateAPIKey() string {
 	rand.Read(bytes)
 	return hex.EncodeToString(bytes)
 }
-
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// snapshotsBucket holds the dashboard host's full raw reports, keyed by the SHA-256 of their content
+const snapshotsBucket = "snapshots"
+
+// saveSnapshot stores a complete raw report once in bucket and returns its content hash
+func saveSnapshot(store Storage, bucket string, data map[string]string) (string, error) {
+	// Map keys are marshalled in sorted order, so identical reports hash identically
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	sum := sha256.Sum256(encoded)
+	hash := hex.EncodeToString(sum[:])
+
+	// Identical reports are stored once
+	if _, err := store.Get(bucket, hash); err == nil {
+		return hash, nil
+	} else if !errors.Is(err, ErrNotFound) {
+		return "", err
+	}
+
+	var compressed bytes.Buffer
+	gzWriter := gzip.NewWriter(&compressed)
+	if _, err := gzWriter.Write(encoded); err != nil {
+		return "", err
+	}
+	if err := gzWriter.Close(); err != nil {
+		return "", err
+	}
+
+	if err := store.Put(bucket, hash, compressed.Bytes()); err != nil {
+		return "", fmt.Errorf("failed to save snapshot: %w", err)
+	}
+
+	return hash, nil
+}
+
+// loadSnapshot returns the raw report stored under a hash, verifying its content
+func loadSnapshot(store Storage, bucket, hash string) (map[string]string, error) {
+	value, err := store.Get(bucket, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeSnapshot(hash, value)
+}
+
+// decodeSnapshot decompresses a stored snapshot and checks it against its hash
+func decodeSnapshot(hash string, value []byte) (map[string]string, error) {
+	gzReader, err := gzip.NewReader(bytes.NewReader(value))
+	if err != nil {
+		return nil, fmt.Errorf("snapshot %s is not readable: %w", hash, err)
+	}
+	defer gzReader.Close()
+
+	encoded, err := io.ReadAll(gzReader)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot %s is not readable: %w", hash, err)
+	}
+
+	sum := sha256.Sum256(encoded)
+	if hex.EncodeToString(sum[:]) != hash {
+		return nil, fmt.Errorf("snapshot %s failed its integrity check", hash)
+	}
+
+	var data map[string]string
+	if err := json.Unmarshal(encoded, &data); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+
+	return data, nil
+}
+
+// GetFullReport returns the complete raw report captured with a history record
+func (hm *HistoryManager) GetFullReport(id string) (*AuditRecord, map[string]string, error) {
+	record, err := hm.GetRecord(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if record.FullDataHash == "" {
+		return record, nil, fmt.Errorf("record %s was saved before full snapshots were kept", id)
+	}
+
+	data, err := loadSnapshot(hm.store, hm.buckets.snapshots, record.FullDataHash)
+	if err != nil {
+		return record, nil, err
+	}
+
+	return record, data, nil
+}
+
+// pruneSnapshots removes snapshots no longer referenced by any history record
+func (hm *HistoryManager) pruneSnapshots(candidates []string) {
+	if len(candidates) == 0 {
+		return
+	}
+
+	referenced := make(map[string]bool, len(hm.index))
+	for _, record := range hm.index {
+		referenced[record.FullDataHash] = true
+	}
+
+	for _, hash := range candidates {
+		if hash != "" && !referenced[hash] {
+			hm.store.Delete(hm.buckets.snapshots, hash)
+		}
+	}
+}
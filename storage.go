@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrNotFound is returned when a key does not exist in a bucket
+var ErrNotFound = errors.New("not found")
+
+// Storage is the persistence layer used by the history, fleet and findings managers.
+// Values live under a key inside a bucket; buckets nest with "/" (e.g. servers/<id>/audits).
+type Storage interface {
+	Get(bucket, key string) ([]byte, error)
+	Put(bucket, key string, value []byte) error
+	Delete(bucket, key string) error
+	Keys(bucket string) ([]string, error)    // Sorted ascending
+	Buckets(parent string) ([]string, error) // Direct children of parent, "" for top level
+	DeleteBucket(bucket string) error        // Removes the bucket and everything nested in it
+	Close() error
+	Backend() string
+}
+
+// Storage backends
+const (
+	storageBackendFS = "fs"
+	storageBackendDB = "db"
+)
+
+// Bucket names shared by the managers
+const (
+	historyBucket  = "history"
+	serversBucket  = "servers"
+	findingsBucket = "findings"
+)
+
+// StorageConfig selects and locates a storage backend
+type StorageConfig struct {
+	Backend    string // fs or db
+	DataDir    string // Fleet and findings data for the filesystem backend
+	HistoryDir string // Local audit history for the filesystem backend
+	DBPath     string // Single database file for the db backend
+}
+
+// DefaultStorageConfig reads the backend from UBUNTUSHIELD_STORAGE (fs by default)
+func DefaultStorageConfig() StorageConfig {
+	config := StorageConfig{
+		Backend:    storageBackendFS,
+		DataDir:    "./data",
+		HistoryDir: "./history",
+		DBPath:     "./data/ubuntushield.db",
+	}
+
+	if backend := os.Getenv("UBUNTUSHIELD_STORAGE"); backend != "" {
+		config.Backend = backend
+	}
+	if path := os.Getenv("UBUNTUSHIELD_DB_PATH"); path != "" {
+		config.DBPath = path
+	}
+
+	return config
+}
+
+// OpenStorage opens the backend selected in the config
+func OpenStorage(config StorageConfig) (Storage, error) {
+	switch config.Backend {
+	case storageBackendFS:
+		return NewFileStorage(config.DataDir, config.HistoryDir)
+	case storageBackendDB:
+		return OpenDBStorage(config.DBPath)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q (expected %s or %s)", config.Backend, storageBackendFS, storageBackendDB)
+	}
+}
+
+// MigrateStorage copies every bucket and key from src to dst, returning the number of values copied
+func MigrateStorage(src, dst Storage) (int, error) {
+	copied := 0
+	err := walkStorage(src, "", func(bucket, key string, value []byte) error {
+		if err := dst.Put(bucket, key, value); err != nil {
+			return fmt.Errorf("failed to write %s/%s: %w", bucket, key, err)
+		}
+		copied++
+		return nil
+	})
+	return copied, err
+}
+
+// walkStorage calls fn for every value in bucket and the buckets nested in it
+func walkStorage(store Storage, bucket string, fn func(bucket, key string, value []byte) error) error {
+	if bucket != "" {
+		keys, err := store.Keys(bucket)
+		if err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			value, err := store.Get(bucket, key)
+			if err != nil {
+				return fmt.Errorf("failed to read %s/%s: %w", bucket, key, err)
+			}
+			if err := fn(bucket, key, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	children, err := store.Buckets(bucket)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := walkStorage(store, joinBucket(bucket, child), fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runStorageMigration implements "UbuntuShield migrate-storage <from> <to>"
+func runStorageMigration(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: migrate-storage <%s|%s> <%s|%s>", storageBackendFS, storageBackendDB, storageBackendFS, storageBackendDB)
+	}
+	if args[0] == args[1] {
+		return fmt.Errorf("source and destination backend are both %q", args[0])
+	}
+
+	config := DefaultStorageConfig()
+
+	config.Backend = args[0]
+	src, err := OpenStorage(config)
+	if err != nil {
+		return fmt.Errorf("failed to open source storage: %w", err)
+	}
+	defer src.Close()
+
+	config.Backend = args[1]
+	dst, err := OpenStorage(config)
+	if err != nil {
+		return fmt.Errorf("failed to open destination storage: %w", err)
+	}
+	defer dst.Close()
+
+	copied, err := MigrateStorage(src, dst)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("✅ Migrated %d values from %s to %s storage\n", copied, src.Backend(), dst.Backend())
+	return nil
+}
+
+func joinBucket(parent, child string) string {
+	if parent == "" {
+		return child
+	}
+	return parent + "/" + child
+}
+
+// isGzipped reports whether a stored value is gzip-compressed
+func isGzipped(value []byte) bool {
+	return len(value) > 2 && value[0] == 0x1f && value[1] == 0x8b
+}
+
+// gzipValue compresses a value for storage
+func gzipValue(value []byte) ([]byte, error) {
+	var compressed bytes.Buffer
+	gzWriter := gzip.NewWriter(&compressed)
+	if _, err := gzWriter.Write(value); err != nil {
+		return nil, err
+	}
+	if err := gzWriter.Close(); err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
+
+// decodedStoredValue returns a value with any gzip compression removed
+func decodedStoredValue(value []byte) []byte {
+	if !isGzipped(value) {
+		return value
+	}
+
+	gzReader, err := gzip.NewReader(bytes.NewReader(value))
+	if err != nil {
+		return value
+	}
+	defer gzReader.Close()
+
+	decoded, err := io.ReadAll(gzReader)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+// FileStorage keeps one JSON file per key, the layout the dashboard has always used:
+// data/servers/<id>/info.json, data/servers/<id>/audits/audit_*.json, history/audit_*.json(.gz)
+type FileStorage struct {
+	dataDir    string
+	historyDir string
+}
+
+// NewFileStorage creates a filesystem storage rooted at the data and history directories
+func NewFileStorage(dataDir, historyDir string) (*FileStorage, error) {
+	for _, dir := range []string{dataDir, historyDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create storage directory: %w", err)
+		}
+	}
+
+	return &FileStorage{
+		dataDir:    dataDir,
+		historyDir: historyDir,
+	}, nil
+}
+
+// Get reads a value, transparently finding gzipped files
+func (fs *FileStorage) Get(bucket, key string) ([]byte, error) {
+	path := fs.keyPath(bucket, key)
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		data, err = os.ReadFile(path + ".gz")
+	}
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s/%s: %w", bucket, key, ErrNotFound)
+	}
+
+	return data, err
+}
+
+// Put writes a value atomically; gzip-compressed values are stored with a .gz suffix
+func (fs *FileStorage) Put(bucket, key string, value []byte) error {
+	dir := fs.bucketDir(bucket)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create bucket directory: %w", err)
+	}
+
+	path := fs.keyPath(bucket, key)
+	stale := path + ".gz"
+	if isGzipped(value) {
+		path, stale = stale, path
+	}
+
+	// Write to a temp file first so a crash never leaves a truncated value
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, value, 0644); err != nil {
+		return fmt.Errorf("failed to write %s/%s: %w", bucket, key, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	if err := os.Remove(stale); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// Delete removes a value in either its plain or gzipped form
+func (fs *FileStorage) Delete(bucket, key string) error {
+	path := fs.keyPath(bucket, key)
+
+	for _, p := range []string{path, path + ".gz"} {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Keys lists the keys in a bucket
+func (fs *FileStorage) Keys(bucket string) ([]string, error) {
+	files, err := os.ReadDir(fs.bucketDir(bucket))
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		name := strings.TrimSuffix(file.Name(), ".gz")
+		if !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		key := strings.TrimSuffix(name, ".json")
+
+		// A key may briefly exist in both forms while being compressed
+		if len(keys) > 0 && keys[len(keys)-1] == key {
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Buckets lists the direct child buckets of parent
+func (fs *FileStorage) Buckets(parent string) ([]string, error) {
+	if parent == "" {
+		buckets := []string{}
+		if _, err := os.Stat(fs.historyDir); err == nil {
+			buckets = append(buckets, historyBucket)
+		}
+
+		children, err := fs.subdirs(fs.dataDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			if child != historyBucket {
+				buckets = append(buckets, child)
+			}
+		}
+
+		sort.Strings(buckets)
+		return buckets, nil
+	}
+
+	return fs.subdirs(fs.bucketDir(parent))
+}
+
+// DeleteBucket removes a bucket directory and everything in it
+func (fs *FileStorage) DeleteBucket(bucket string) error {
+	if bucket == "" || bucket == historyBucket {
+		return fmt.Errorf("refusing to delete bucket %q", bucket)
+	}
+	return os.RemoveAll(fs.bucketDir(bucket))
+}
+
+// Close is a no-op for the filesystem backend
+func (fs *FileStorage) Close() error {
+	return nil
+}
+
+// Backend returns the backend name
+func (fs *FileStorage) Backend() string {
+	return storageBackendFS
+}
+
+func (fs *FileStorage) bucketDir(bucket string) string {
+	if bucket == historyBucket {
+		return fs.historyDir
+	}
+
+	parts := strings.Split(bucket, "/")
+	for i, part := range parts {
+		parts[i] = filepath.Base(part)
+	}
+	return filepath.Join(fs.dataDir, filepath.Join(parts...))
+}
+
+func (fs *FileStorage) keyPath(bucket, key string) string {
+	return filepath.Join(fs.bucketDir(bucket), filepath.Base(key)+".json")
+}
+
+func (fs *FileStorage) subdirs(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+
+	return names, nil
+}
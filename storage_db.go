@@ -0,0 +1,473 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DBStorage is an embedded single-file database: an append-only log of puts and deletes
+// with an in-memory index of where each live value sits in the file. It needs no external
+// service, survives a torn final write, and compacts itself when mostly dead records remain.
+type DBStorage struct {
+	path      string
+	file      *os.File
+	size      int64 // Offset where the next record is appended
+	liveBytes int64 // Bytes used by records that are still current
+	index     map[string]map[string]dbEntry
+	mu        sync.RWMutex
+}
+
+type dbEntry struct {
+	offset int64 // Offset of the value within the file
+	length uint32
+	record int64 // Size of the whole record, for compaction accounting
+}
+
+// Record layout: op(1) crc32(4) bucketLen(2) keyLen(2) valueLen(4) bucket key value.
+// The checksum covers everything after itself.
+const (
+	dbMagic        = "USHIELDDB1\n"
+	dbHeaderSize   = 13
+	dbOpPut        = 1
+	dbOpDelete     = 2
+	dbOpDropBucket = 3
+
+	dbCompactMinSize = 1 << 20  // Don't bother compacting small files
+	dbMaxValueSize   = 64 << 20 // Largest value accepted, so a damaged header can't demand a huge read
+)
+
+// errDBTornRecord marks damage in the last record of the file, where a crash mid-write leaves it
+var errDBTornRecord = errors.New("torn record")
+
+// OpenDBStorage opens (or creates) the database file and rebuilds its index
+func OpenDBStorage(path string) (*DBStorage, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create database directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	db := &DBStorage{
+		path:  path,
+		file:  file,
+		index: make(map[string]map[string]dbEntry),
+	}
+
+	if err := db.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	// Reclaim space from overwritten and deleted values
+	if db.size > dbCompactMinSize && db.liveBytes < db.size/2 {
+		if err := db.compact(); err != nil {
+			log.Printf("⚠️ Database compaction failed: %v", err)
+		}
+	}
+
+	return db, nil
+}
+
+// Get reads a value
+func (db *DBStorage) Get(bucket, key string) ([]byte, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	entry, exists := db.index[bucket][key]
+	if !exists {
+		return nil, fmt.Errorf("%s/%s: %w", bucket, key, ErrNotFound)
+	}
+
+	value := make([]byte, entry.length)
+	if _, err := db.file.ReadAt(value, entry.offset); err != nil {
+		return nil, fmt.Errorf("failed to read %s/%s: %w", bucket, key, err)
+	}
+
+	return value, nil
+}
+
+// Put appends a value and makes it current
+func (db *DBStorage) Put(bucket, key string, value []byte) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.append(dbOpPut, bucket, key, value)
+}
+
+// Delete appends a tombstone for a key
+func (db *DBStorage) Delete(bucket, key string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, exists := db.index[bucket][key]; !exists {
+		return nil
+	}
+
+	return db.append(dbOpDelete, bucket, key, nil)
+}
+
+// Keys lists the keys in a bucket
+func (db *DBStorage) Keys(bucket string) ([]string, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	keys := make([]string, 0, len(db.index[bucket]))
+	for key := range db.index[bucket] {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Buckets lists the direct child buckets of parent
+func (db *DBStorage) Buckets(parent string) ([]string, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	prefix := ""
+	if parent != "" {
+		prefix = parent + "/"
+	}
+
+	seen := make(map[string]bool)
+	buckets := []string{}
+	for bucket := range db.index {
+		if !strings.HasPrefix(bucket, prefix) {
+			continue
+		}
+
+		child := strings.SplitN(bucket[len(prefix):], "/", 2)[0]
+		if child != "" && !seen[child] {
+			seen[child] = true
+			buckets = append(buckets, child)
+		}
+	}
+
+	sort.Strings(buckets)
+	return buckets, nil
+}
+
+// DeleteBucket drops a bucket and all buckets nested in it
+func (db *DBStorage) DeleteBucket(bucket string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if bucket == "" {
+		return fmt.Errorf("refusing to delete the root bucket")
+	}
+
+	return db.append(dbOpDropBucket, bucket, "", nil)
+}
+
+// Close closes the database file
+func (db *DBStorage) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.file.Close()
+}
+
+// Backend returns the backend name
+func (db *DBStorage) Backend() string {
+	return storageBackendDB
+}
+
+// Helper functions
+
+func (db *DBStorage) append(op byte, bucket, key string, value []byte) error {
+	if len(bucket) > 0xFFFF || len(key) > 0xFFFF {
+		return fmt.Errorf("bucket or key too long")
+	}
+	if len(value) > dbMaxValueSize {
+		return fmt.Errorf("value too large (%d bytes, limit %d)", len(value), dbMaxValueSize)
+	}
+
+	record := encodeDBRecord(op, bucket, key, value)
+	if _, err := db.file.WriteAt(record, db.size); err != nil {
+		return fmt.Errorf("failed to write database record: %w", err)
+	}
+	if err := db.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync database: %w", err)
+	}
+
+	valueOffset := db.size + int64(len(record)-len(value))
+	db.apply(op, bucket, key, valueOffset, uint32(len(value)), int64(len(record)))
+	db.size += int64(len(record))
+
+	return nil
+}
+
+// apply updates the index for a record, keeping live byte accounting in step
+func (db *DBStorage) apply(op byte, bucket, key string, valueOffset int64, length uint32, recordSize int64) {
+	switch op {
+	case dbOpPut:
+		if db.index[bucket] == nil {
+			db.index[bucket] = make(map[string]dbEntry)
+		}
+		if old, exists := db.index[bucket][key]; exists {
+			db.liveBytes -= old.record
+		}
+		db.index[bucket][key] = dbEntry{offset: valueOffset, length: length, record: recordSize}
+		db.liveBytes += recordSize
+
+	case dbOpDelete:
+		if old, exists := db.index[bucket][key]; exists {
+			db.liveBytes -= old.record
+			delete(db.index[bucket], key)
+			if len(db.index[bucket]) == 0 {
+				delete(db.index, bucket)
+			}
+		}
+
+	case dbOpDropBucket:
+		for name, entries := range db.index {
+			if name != bucket && !strings.HasPrefix(name, bucket+"/") {
+				continue
+			}
+			for _, old := range entries {
+				db.liveBytes -= old.record
+			}
+			delete(db.index, name)
+		}
+	}
+}
+
+// load replays the log. A torn final record left by a crash is truncated; any other damage
+// means the file is corrupt, and opening fails rather than throwing later records away.
+func (db *DBStorage) load() error {
+	info, err := db.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if info.Size() == 0 {
+		if _, err := db.file.WriteAt([]byte(dbMagic), 0); err != nil {
+			return fmt.Errorf("failed to initialize database: %w", err)
+		}
+		db.size = int64(len(dbMagic))
+		return db.file.Sync()
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(db.file, 0, info.Size()))
+
+	magic := make([]byte, len(dbMagic))
+	if _, err := io.ReadFull(reader, magic); err != nil || string(magic) != dbMagic {
+		return fmt.Errorf("%s is not a dashboard database", db.path)
+	}
+
+	offset := int64(len(dbMagic))
+	for {
+		op, bucket, key, length, recordSize, err := readDBRecord(reader, info.Size()-offset)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if !errors.Is(err, errDBTornRecord) {
+				// A crash can also leave the tail zero-filled, which isn't a record at all
+				zeroed, zeroErr := db.zeroFilled(offset, info.Size())
+				if zeroErr != nil {
+					return fmt.Errorf("failed to read database: %w", zeroErr)
+				}
+				if !zeroed {
+					return fmt.Errorf("database %s is corrupt at offset %d: %v", db.path, offset, err)
+				}
+			}
+
+			log.Printf("⚠️ Database %s has a torn record at offset %d (%v), truncating", db.path, offset, err)
+			if err := db.file.Truncate(offset); err != nil {
+				return fmt.Errorf("failed to truncate damaged database: %w", err)
+			}
+			break
+		}
+
+		db.apply(op, bucket, key, offset+recordSize-int64(length), length, recordSize)
+		offset += recordSize
+	}
+
+	db.size = offset
+	return nil
+}
+
+// zeroFilled reports whether the file holds only zero bytes between from and to
+func (db *DBStorage) zeroFilled(from, to int64) (bool, error) {
+	reader := bufio.NewReader(io.NewSectionReader(db.file, from, to-from))
+	for {
+		b, err := reader.ReadByte()
+		if err == io.EOF {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if b != 0 {
+			return false, nil
+		}
+	}
+}
+
+// compact rewrites only live values into a fresh file and swaps it in. The records are
+// written in one pass and synced once, then the rename is made durable by syncing the directory.
+func (db *DBStorage) compact() error {
+	tmpPath := db.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	fail := func(err error) error {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	compacted := &DBStorage{
+		path:  db.path,
+		file:  tmp,
+		size:  int64(len(dbMagic)),
+		index: make(map[string]map[string]dbEntry),
+	}
+	writer := bufio.NewWriter(tmp)
+	if _, err := writer.WriteString(dbMagic); err != nil {
+		return fail(err)
+	}
+
+	for bucket, entries := range db.index {
+		for key, entry := range entries {
+			value := make([]byte, entry.length)
+			if _, err := db.file.ReadAt(value, entry.offset); err != nil {
+				return fail(err)
+			}
+
+			record := encodeDBRecord(dbOpPut, bucket, key, value)
+			if _, err := writer.Write(record); err != nil {
+				return fail(err)
+			}
+
+			valueOffset := compacted.size + int64(len(record)-len(value))
+			compacted.apply(dbOpPut, bucket, key, valueOffset, entry.length, int64(len(record)))
+			compacted.size += int64(len(record))
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := os.Rename(tmpPath, db.path); err != nil {
+		return fail(err)
+	}
+	if err := syncDir(filepath.Dir(db.path)); err != nil {
+		log.Printf("⚠️ Failed to sync database directory after compaction: %v", err)
+	}
+
+	db.file.Close()
+	db.file = tmp
+	db.size = compacted.size
+	db.liveBytes = compacted.liveBytes
+	db.index = compacted.index
+
+	return nil
+}
+
+// syncDir flushes a directory so a rename inside it survives a crash. Windows can't sync
+// directory handles and makes renames durable on its own.
+func syncDir(path string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	return dir.Sync()
+}
+
+func encodeDBRecord(op byte, bucket, key string, value []byte) []byte {
+	record := make([]byte, dbHeaderSize+len(bucket)+len(key)+len(value))
+
+	record[0] = op
+	binary.LittleEndian.PutUint16(record[5:7], uint16(len(bucket)))
+	binary.LittleEndian.PutUint16(record[7:9], uint16(len(key)))
+	binary.LittleEndian.PutUint32(record[9:13], uint32(len(value)))
+	copy(record[dbHeaderSize:], bucket)
+	copy(record[dbHeaderSize+len(bucket):], key)
+	copy(record[dbHeaderSize+len(bucket)+len(key):], value)
+
+	binary.LittleEndian.PutUint32(record[1:5], crc32.ChecksumIEEE(record[5:]))
+	return record
+}
+
+// readDBRecord reads the next record, of at most remaining bytes. A record cut short by the
+// end of the file, or the last record failing its checksum, is wrapped in errDBTornRecord.
+func readDBRecord(reader *bufio.Reader, remaining int64) (op byte, bucket, key string, length uint32, size int64, err error) {
+	header := make([]byte, dbHeaderSize)
+	if _, err = io.ReadFull(reader, header); err != nil {
+		if err == io.EOF {
+			return
+		}
+		err = fmt.Errorf("%w: truncated header: %v", errDBTornRecord, err)
+		return
+	}
+
+	op = header[0]
+	bucketLen := int(binary.LittleEndian.Uint16(header[5:7]))
+	keyLen := int(binary.LittleEndian.Uint16(header[7:9]))
+	length = binary.LittleEndian.Uint32(header[9:13])
+
+	// A header that could never have been written is corruption wherever it sits. Check the
+	// lengths before trusting them with an allocation, the checksum comes after the body.
+	if op != dbOpPut && op != dbOpDelete && op != dbOpDropBucket {
+		err = errors.New("unknown record type")
+		return
+	}
+	if length > dbMaxValueSize {
+		err = fmt.Errorf("value length %d over limit", length)
+		return
+	}
+	recordSize := int64(dbHeaderSize+bucketLen+keyLen) + int64(length)
+	if recordSize > remaining {
+		err = fmt.Errorf("%w: lengths run past the end of the file", errDBTornRecord)
+		return
+	}
+
+	body := make([]byte, bucketLen+keyLen+int(length))
+	if _, err = io.ReadFull(reader, body); err != nil {
+		err = fmt.Errorf("%w: truncated record: %v", errDBTornRecord, err)
+		return
+	}
+
+	checksum := crc32.NewIEEE()
+	checksum.Write(header[5:])
+	checksum.Write(body)
+	if checksum.Sum32() != binary.LittleEndian.Uint32(header[1:5]) {
+		err = errors.New("checksum mismatch")
+		if recordSize == remaining {
+			err = fmt.Errorf("%w: %v", errDBTornRecord, err)
+		}
+		return
+	}
+
+	bucket = string(body[:bucketLen])
+	key = string(body[bucketLen : bucketLen+keyLen])
+	size = recordSize
+	return
+}
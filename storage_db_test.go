@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDBStorageRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dashboard.db")
+	db, err := OpenDBStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name string
+		run  func(Storage) error
+	}{
+		{"put", func(s Storage) error { return s.Put("history", "audit_2", []byte("two")) }},
+		{"put earlier key", func(s Storage) error { return s.Put("history", "audit_1", []byte("one")) }},
+		{"overwrite", func(s Storage) error { return s.Put("history", "audit_2", []byte("two, again")) }},
+		{"put empty value", func(s Storage) error { return s.Put("history", "audit_3", []byte{}) }},
+		{"delete", func(s Storage) error { return s.Delete("history", "audit_3") }},
+		{"delete missing key", func(s Storage) error { return s.Delete("history", "audit_9") }},
+		{"put nested", func(s Storage) error { return s.Put("servers/a/audits", "audit_1", []byte("a1")) }},
+		{"put nested sibling", func(s Storage) error { return s.Put("servers/b/audits", "audit_1", []byte("b1")) }},
+		{"drop bucket", func(s Storage) error { return s.DeleteBucket("servers/a") }},
+	}
+	for _, step := range steps {
+		if err := step.run(db); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+	}
+
+	check := func(t *testing.T, s Storage) {
+		t.Helper()
+		values := []struct {
+			bucket, key string
+			want        string // Empty when the key shouldn't exist
+		}{
+			{"history", "audit_1", "one"},
+			{"history", "audit_2", "two, again"},
+			{"history", "audit_3", ""},
+			{"servers/a/audits", "audit_1", ""},
+			{"servers/b/audits", "audit_1", "b1"},
+		}
+		for _, v := range values {
+			got, err := s.Get(v.bucket, v.key)
+			if v.want == "" {
+				if !errors.Is(err, ErrNotFound) {
+					t.Errorf("Get(%s, %s) = %q, %v, want ErrNotFound", v.bucket, v.key, got, err)
+				}
+				continue
+			}
+			if err != nil || string(got) != v.want {
+				t.Errorf("Get(%s, %s) = %q, %v, want %q", v.bucket, v.key, got, err, v.want)
+			}
+		}
+
+		keys, err := s.Keys("history")
+		if err != nil || !reflect.DeepEqual(keys, []string{"audit_1", "audit_2"}) {
+			t.Errorf("Keys(history) = %v, %v, want sorted [audit_1 audit_2]", keys, err)
+		}
+		buckets, err := s.Buckets("servers")
+		if err != nil || !reflect.DeepEqual(buckets, []string{"b"}) {
+			t.Errorf("Buckets(servers) = %v, %v, want [b]", buckets, err)
+		}
+	}
+
+	t.Run("open", func(t *testing.T) { check(t, db) })
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := OpenDBStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+
+	t.Run("reopened", func(t *testing.T) { check(t, reopened) })
+}
+
+func TestDBStorageRecovery(t *testing.T) {
+	// A torn tail is whatever a crash left after the last good record
+	tests := []struct {
+		name string
+		tail func() []byte
+	}{
+		{"torn header", func() []byte {
+			return encodeDBRecord(dbOpPut, "history", "audit_3", []byte("three"))[:5]
+		}},
+		{"torn value", func() []byte {
+			record := encodeDBRecord(dbOpPut, "history", "audit_3", []byte("three"))
+			return record[:len(record)-2]
+		}},
+		{"value not fully written", func() []byte {
+			record := encodeDBRecord(dbOpPut, "history", "audit_3", []byte("three"))
+			record[len(record)-1] ^= 0xFF
+			return record
+		}},
+		{"length past the end of the file", func() []byte {
+			record := encodeDBRecord(dbOpPut, "history", "audit_3", []byte("three"))
+			binary.LittleEndian.PutUint32(record[9:13], 1<<20)
+			return record
+		}},
+		{"zero-filled", func() []byte {
+			return make([]byte, 4096)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "dashboard.db")
+			db, err := OpenDBStorage(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, key := range []string{"audit_1", "audit_2"} {
+				if err := db.Put("history", key, []byte(key)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			db.Close()
+
+			good, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, append(good, tt.tail()...), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			db, err = OpenDBStorage(path)
+			if err != nil {
+				t.Fatalf("OpenDBStorage with a damaged tail: %v", err)
+			}
+			keys, _ := db.Keys("history")
+			if !reflect.DeepEqual(keys, []string{"audit_1", "audit_2"}) {
+				t.Errorf("Keys(history) = %v, want the records before the damage", keys)
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Size() != int64(len(good)) {
+				t.Errorf("database wasn't truncated to the last good record (%d bytes, want %d)", info.Size(), len(good))
+			}
+
+			// New writes land after the good records and survive another open
+			if err := db.Put("history", "audit_3", []byte("audit_3")); err != nil {
+				t.Fatal(err)
+			}
+			db.Close()
+			db, err = OpenDBStorage(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			if value, err := db.Get("history", "audit_3"); err != nil || string(value) != "audit_3" {
+				t.Errorf("Get after recovery = %q, %v", value, err)
+			}
+		})
+	}
+}
+
+func TestDBStorageRejectsCorruptRecords(t *testing.T) {
+	// Damage followed by more records, or a header a crash couldn't leave, isn't a torn write,
+	// so nothing may be truncated
+	tests := []struct {
+		name    string
+		corrupt func(record []byte)
+		last    bool // The damaged record ends the file
+	}{
+		{"checksum mismatch", func(record []byte) { record[len(record)-1] ^= 0xFF }, false},
+		{"unknown record type", func(record []byte) { record[0] = 9 }, false},
+		{"length over the limit", func(record []byte) {
+			binary.LittleEndian.PutUint32(record[9:13], dbMaxValueSize+1)
+		}, false},
+		{"unknown record type at the end", func(record []byte) { record[0] = 9 }, true},
+		{"length over the limit at the end", func(record []byte) {
+			binary.LittleEndian.PutUint32(record[9:13], 0xFFFFFFFF)
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := encodeDBRecord(dbOpPut, "history", "audit_2", []byte("two"))
+			tt.corrupt(record)
+
+			var data []byte
+			data = append(data, dbMagic...)
+			data = append(data, encodeDBRecord(dbOpPut, "history", "audit_1", []byte("one"))...)
+			data = append(data, record...)
+			if !tt.last {
+				data = append(data, encodeDBRecord(dbOpPut, "history", "audit_3", []byte("three"))...)
+			}
+
+			path := filepath.Join(t.TempDir(), "dashboard.db")
+			if err := os.WriteFile(path, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if db, err := OpenDBStorage(path); err == nil {
+				db.Close()
+				t.Fatal("OpenDBStorage accepted a corrupt database")
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Size() != int64(len(data)) {
+				t.Errorf("corrupt database was changed to %d bytes, want %d", info.Size(), len(data))
+			}
+		})
+	}
+}
+
+func TestDBStorageCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dashboard.db")
+	db, err := OpenDBStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Overwriting the same keys leaves mostly dead records behind
+	value := make([]byte, 64<<10)
+	for i := 0; i < 40; i++ {
+		value[0] = byte(i)
+		for _, key := range []string{"audit_1", "audit_2"} {
+			if err := db.Put("history", key, value); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := db.Delete("history", "audit_2"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	db, err = OpenDBStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() > 2*int64(len(value)) {
+		t.Errorf("database is %d bytes after compaction, want only the live value", info.Size())
+	}
+	if _, err := os.Stat(path + ".compact"); !os.IsNotExist(err) {
+		t.Errorf("compaction left its temporary file behind: %v", err)
+	}
+	if got, err := db.Get("history", "audit_1"); err != nil || got[0] != 39 || len(got) != len(value) {
+		t.Errorf("Get(audit_1) after compaction = %d bytes, %v", len(got), err)
+	}
+	if keys, _ := db.Keys("history"); !reflect.DeepEqual(keys, []string{"audit_1"}) {
+		t.Errorf("Keys(history) after compaction = %v", keys)
+	}
+
+	// Writes after compaction land in the new file
+	if err := db.Put("history", "audit_3", []byte("three")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := db.Get("history", "audit_3"); err != nil || string(got) != "three" {
+		t.Errorf("Get(audit_3) = %q, %v", got, err)
+	}
+}
+
+func TestDBStorageRejectsOversizedValues(t *testing.T) {
+	db, err := OpenDBStorage(filepath.Join(t.TempDir(), "dashboard.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Put("history", "huge", make([]byte, dbMaxValueSize+1)); err == nil {
+		t.Error("Put accepted a value over dbMaxValueSize")
+	}
+}
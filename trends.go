@@ -0,0 +1,418 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Pre-computed daily and weekly rollups live next to the history index, one key per bucket
+const (
+	historyRollupsBucket    = "history_rollups"
+	legacyHistoryRollupsKey = "rollups" // All rollups as one value, replaced by one key per bucket
+	dailyRollupPrefix       = "daily_"
+	weeklyRollupPrefix      = "weekly_"
+
+	trendDay  = 24 * time.Hour
+	trendWeek = 7 * trendDay
+)
+
+// Trend aggregations
+var trendAggregations = map[string]bool{"avg": true, "min": true, "max": true, "last": true}
+
+// TrendQuery selects the range, bucket size and aggregation of a trend
+type TrendQuery struct {
+	From        time.Time
+	To          time.Time     // Zero means now
+	Bucket      time.Duration // Zero returns one point per record
+	Aggregation string        // avg, min, max or last
+}
+
+// TrendStat accumulates one metric within a bucket
+type TrendStat struct {
+	Count  int       `json:"count"`
+	Sum    float64   `json:"sum"`
+	Min    float64   `json:"min"`
+	Max    float64   `json:"max"`
+	Last   float64   `json:"last"`
+	LastAt time.Time `json:"last_at"`
+}
+
+// TrendRollup summarises every record within one bucket. Buckets are aligned in UTC: days start
+// at midnight and weeks on Monday.
+type TrendRollup struct {
+	Start    time.Time `json:"start"`
+	Score    TrendStat `json:"score"`
+	Warnings TrendStat `json:"warnings"`
+	Tests    TrendStat `json:"tests"`
+}
+
+// historyRollups holds the pre-computed rollups of a history
+type historyRollups struct {
+	Daily  []TrendRollup // Sorted by start
+	Weekly []TrendRollup // Sorted by start
+}
+
+// GetTrendRange returns trend data for an arbitrary range. Buckets that are whole days or weeks
+// are served from the pre-computed rollups, anything finer from the history index.
+func (hm *HistoryManager) GetTrendRange(query TrendQuery) (*TrendData, error) {
+	if query.Aggregation == "" {
+		query.Aggregation = "avg"
+	}
+	if !trendAggregations[query.Aggregation] {
+		return nil, fmt.Errorf("unknown aggregation %q (use avg, min, max or last)", query.Aggregation)
+	}
+	if query.Bucket < 0 {
+		return nil, fmt.Errorf("bucket size must not be negative")
+	}
+	if query.To.IsZero() {
+		query.To = time.Now()
+	}
+	if !query.From.Before(query.To) {
+		return nil, fmt.Errorf("trend range start must be before its end")
+	}
+
+	trend := &TrendData{
+		From:               query.From,
+		To:                 query.To,
+		Aggregation:        query.Aggregation,
+		SecurityScoreTrend: []DataPoint{},
+		WarningsTrend:      []DataPoint{},
+		TestsTrend:         []DataPoint{},
+	}
+	if query.Bucket > 0 {
+		trend.Bucket = formatTrendDuration(query.Bucket)
+	}
+
+	var buckets []TrendRollup
+	switch {
+	case query.Bucket > 0 && query.Bucket%trendWeek == 0:
+		trend.Source = "weekly_rollup"
+		buckets = hm.rollupRange(query, true)
+	case query.Bucket > 0 && query.Bucket%trendDay == 0:
+		trend.Source = "daily_rollup"
+		buckets = hm.rollupRange(query, false)
+	default:
+		trend.Source = "records"
+		records, _ := hm.GetRecordsPage(query.From, query.To, 0, 0)
+
+		// Without a bucket every record is its own point
+		if query.Bucket == 0 {
+			for _, record := range records {
+				trend.SecurityScoreTrend = append(trend.SecurityScoreTrend, DataPoint{Timestamp: record.Timestamp, Value: parseFloat(record.HardeningIndex)})
+				trend.WarningsTrend = append(trend.WarningsTrend, DataPoint{Timestamp: record.Timestamp, Value: parseFloat(record.Warnings)})
+				trend.TestsTrend = append(trend.TestsTrend, DataPoint{Timestamp: record.Timestamp, Value: parseFloat(record.TestsPerformed)})
+			}
+			return trend, nil
+		}
+
+		for _, record := range records {
+			var rollup TrendRollup
+			rollup.add(record)
+			buckets = append(buckets, rollup)
+		}
+	}
+
+	for _, bucket := range mergeRollups(buckets, query.Bucket) {
+		trend.SecurityScoreTrend = append(trend.SecurityScoreTrend, DataPoint{Timestamp: bucket.Start, Value: bucket.Score.value(query.Aggregation)})
+		trend.WarningsTrend = append(trend.WarningsTrend, DataPoint{Timestamp: bucket.Start, Value: bucket.Warnings.value(query.Aggregation)})
+		trend.TestsTrend = append(trend.TestsTrend, DataPoint{Timestamp: bucket.Start, Value: bucket.Tests.value(query.Aggregation)})
+	}
+
+	return trend, nil
+}
+
+// RebuildRollups regenerates the daily and weekly rollups from the history index
+func (hm *HistoryManager) RebuildRollups() error {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+
+	return hm.rebuildRollups()
+}
+
+// Helper functions
+
+// rollupRange returns the daily or weekly rollups overlapping the query range
+func (hm *HistoryManager) rollupRange(query TrendQuery, weekly bool) []TrendRollup {
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+
+	rollups, unit := hm.rollups.Daily, trendDay
+	if weekly {
+		rollups, unit = hm.rollups.Weekly, trendWeek
+	}
+
+	// Rollups have the granularity of their unit, so include the one the range starts in
+	from := query.From.UTC().Truncate(unit)
+	start := sort.Search(len(rollups), func(i int) bool {
+		return !rollups[i].Start.Before(from)
+	})
+	end := sort.Search(len(rollups), func(i int) bool {
+		return !rollups[i].Start.Before(query.To)
+	})
+	if end < start {
+		end = start
+	}
+
+	result := make([]TrendRollup, end-start)
+	copy(result, rollups[start:end])
+	return result
+}
+
+// loadRollups reads the rollups, rebuilding them when they don't cover the indexed records
+func (hm *HistoryManager) loadRollups() error {
+	keys, err := hm.store.Keys(hm.buckets.rollups)
+	if err != nil {
+		return fmt.Errorf("failed to list history rollups: %w", err)
+	}
+
+	var rollups historyRollups
+	for _, key := range keys {
+		if key == legacyHistoryRollupsKey {
+			return hm.rebuildRollups()
+		}
+
+		data, err := hm.store.Get(hm.buckets.rollups, key)
+		if err != nil {
+			return fmt.Errorf("failed to read history rollups: %w", err)
+		}
+		var rollup TrendRollup
+		if err := json.Unmarshal(data, &rollup); err != nil {
+			return hm.rebuildRollups()
+		}
+
+		switch {
+		case strings.HasPrefix(key, dailyRollupPrefix):
+			rollups.Daily = append(rollups.Daily, rollup)
+		case strings.HasPrefix(key, weeklyRollupPrefix):
+			rollups.Weekly = append(rollups.Weekly, rollup)
+		}
+	}
+
+	if rollupCount(rollups.Daily) != len(hm.index) || rollupCount(rollups.Weekly) != len(hm.index) {
+		return hm.rebuildRollups()
+	}
+
+	sortRollups(rollups.Daily)
+	sortRollups(rollups.Weekly)
+	hm.rollups = rollups
+	return nil
+}
+
+func (hm *HistoryManager) rebuildRollups() error {
+	stale, err := hm.store.Keys(hm.buckets.rollups)
+	if err != nil {
+		return fmt.Errorf("failed to list history rollups: %w", err)
+	}
+	for _, key := range stale {
+		if err := hm.store.Delete(hm.buckets.rollups, key); err != nil && !errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("failed to clear history rollups: %w", err)
+		}
+	}
+
+	hm.rollups = historyRollups{}
+	for _, entry := range hm.index {
+		hm.rollups.Daily = addToRollups(hm.rollups.Daily, entry, trendDay)
+		hm.rollups.Weekly = addToRollups(hm.rollups.Weekly, entry, trendWeek)
+	}
+
+	for _, rollup := range hm.rollups.Daily {
+		if err := hm.saveRollup(dailyRollupPrefix, rollup); err != nil {
+			return err
+		}
+	}
+	for _, rollup := range hm.rollups.Weekly {
+		if err := hm.saveRollup(weeklyRollupPrefix, rollup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollupRecord folds a newly indexed record into the rollups, writing only the day and week it falls in
+func (hm *HistoryManager) rollupRecord(entry IndexEntry) error {
+	hm.rollups.Daily = addToRollups(hm.rollups.Daily, entry, trendDay)
+	hm.rollups.Weekly = addToRollups(hm.rollups.Weekly, entry, trendWeek)
+
+	if err := hm.saveRollup(dailyRollupPrefix, findRollup(hm.rollups.Daily, entry.Timestamp, trendDay)); err != nil {
+		return err
+	}
+	return hm.saveRollup(weeklyRollupPrefix, findRollup(hm.rollups.Weekly, entry.Timestamp, trendWeek))
+}
+
+// saveRollup writes one bucket, keyed by the UTC date it starts on
+func (hm *HistoryManager) saveRollup(prefix string, rollup TrendRollup) error {
+	data, err := json.Marshal(rollup)
+	if err != nil {
+		return err
+	}
+
+	key := prefix + rollup.Start.UTC().Format("2006-01-02")
+	if err := hm.store.Put(hm.buckets.rollups, key, data); err != nil {
+		return fmt.Errorf("failed to save history rollups: %w", err)
+	}
+
+	return nil
+}
+
+// addToRollups adds a record to the sorted rollup for its bucket, creating the bucket if needed
+func addToRollups(rollups []TrendRollup, entry IndexEntry, unit time.Duration) []TrendRollup {
+	start := entry.Timestamp.UTC().Truncate(unit)
+	i := sort.Search(len(rollups), func(i int) bool {
+		return !rollups[i].Start.Before(start)
+	})
+
+	if i == len(rollups) || !rollups[i].Start.Equal(start) {
+		rollups = append(rollups, TrendRollup{})
+		copy(rollups[i+1:], rollups[i:])
+		rollups[i] = TrendRollup{Start: start}
+	}
+
+	rollups[i].add(entry)
+	return rollups
+}
+
+// findRollup returns the rollup of the bucket t falls in
+func findRollup(rollups []TrendRollup, t time.Time, unit time.Duration) TrendRollup {
+	start := t.UTC().Truncate(unit)
+	i := sort.Search(len(rollups), func(i int) bool {
+		return !rollups[i].Start.Before(start)
+	})
+	if i < len(rollups) && rollups[i].Start.Equal(start) {
+		return rollups[i]
+	}
+	return TrendRollup{Start: start}
+}
+
+func sortRollups(rollups []TrendRollup) {
+	sort.Slice(rollups, func(i, j int) bool {
+		return rollups[i].Start.Before(rollups[j].Start)
+	})
+}
+
+// mergeRollups combines sorted rollups into buckets of the given size
+func mergeRollups(rollups []TrendRollup, bucket time.Duration) []TrendRollup {
+	var merged []TrendRollup
+	for _, rollup := range rollups {
+		start := rollup.Start.UTC().Truncate(bucket)
+		if len(merged) == 0 || !merged[len(merged)-1].Start.Equal(start) {
+			merged = append(merged, TrendRollup{Start: start})
+		}
+		merged[len(merged)-1].merge(rollup)
+	}
+	return merged
+}
+
+func rollupCount(rollups []TrendRollup) int {
+	count := 0
+	for _, rollup := range rollups {
+		count += rollup.Score.Count
+	}
+	return count
+}
+
+func (r *TrendRollup) add(entry IndexEntry) {
+	if r.Start.IsZero() {
+		r.Start = entry.Timestamp
+	}
+	r.Score.add(parseFloat(entry.HardeningIndex), entry.Timestamp)
+	r.Warnings.add(parseFloat(entry.Warnings), entry.Timestamp)
+	r.Tests.add(parseFloat(entry.TestsPerformed), entry.Timestamp)
+}
+
+func (r *TrendRollup) merge(other TrendRollup) {
+	r.Score.merge(other.Score)
+	r.Warnings.merge(other.Warnings)
+	r.Tests.merge(other.Tests)
+}
+
+func (s *TrendStat) add(value float64, at time.Time) {
+	s.merge(TrendStat{Count: 1, Sum: value, Min: value, Max: value, Last: value, LastAt: at})
+}
+
+func (s *TrendStat) merge(other TrendStat) {
+	if other.Count == 0 {
+		return
+	}
+	if s.Count == 0 {
+		*s = other
+		return
+	}
+
+	s.Count += other.Count
+	s.Sum += other.Sum
+	if other.Min < s.Min {
+		s.Min = other.Min
+	}
+	if other.Max > s.Max {
+		s.Max = other.Max
+	}
+	if !other.LastAt.Before(s.LastAt) {
+		s.Last = other.Last
+		s.LastAt = other.LastAt
+	}
+}
+
+func (s TrendStat) value(aggregation string) float64 {
+	switch aggregation {
+	case "min":
+		return s.Min
+	case "max":
+		return s.Max
+	case "last":
+		return s.Last
+	default:
+		if s.Count == 0 {
+			return 0
+		}
+		return s.Sum / float64(s.Count)
+	}
+}
+
+// parseTrendDuration accepts Go durations plus whole days and weeks, e.g. "6h", "30d", "2w"
+func parseTrendDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	for suffix, unit := range map[string]time.Duration{"d": trendDay, "w": trendWeek} {
+		if strings.HasSuffix(s, suffix) {
+			n, err := strconv.Atoi(strings.TrimSuffix(s, suffix))
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+
+	duration, err := time.ParseDuration(s)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return duration, nil
+}
+
+func formatTrendDuration(d time.Duration) string {
+	switch {
+	case d%trendWeek == 0:
+		return fmt.Sprintf("%dw", d/trendWeek)
+	case d%trendDay == 0:
+		return fmt.Sprintf("%dd", d/trendDay)
+	default:
+		// "6h0m0s" reads better as "6h"
+		return strings.TrimSuffix(strings.TrimSuffix(d.String(), "0s"), "0m")
+	}
+}
+
+// autoTrendBucket picks a bucket size that keeps long ranges to a few hundred points
+func autoTrendBucket(span time.Duration) time.Duration {
+	switch {
+	case span <= 31*trendDay:
+		return 0
+	case span <= 366*trendDay:
+		return trendDay
+	default:
+		return trendWeek
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAddToRollups(t *testing.T) {
+	day := func(d, h int) time.Time { return time.Date(2026, 5, d, h, 0, 0, 0, time.UTC) }
+	entry := func(at time.Time, score string) IndexEntry {
+		return IndexEntry{Timestamp: at, HardeningIndex: score, Warnings: "1", TestsPerformed: "200"}
+	}
+
+	tests := []struct {
+		name    string
+		entries []IndexEntry
+		unit    time.Duration
+		want    []TrendRollup // Only Start and Score are compared
+	}{
+		{
+			name:    "one entry",
+			entries: []IndexEntry{entry(day(4, 10), "60")},
+			unit:    trendDay,
+			want:    []TrendRollup{{Start: day(4, 0), Score: TrendStat{Count: 1, Sum: 60, Min: 60, Max: 60, Last: 60, LastAt: day(4, 10)}}},
+		},
+		{
+			name:    "same day accumulates",
+			entries: []IndexEntry{entry(day(4, 10), "60"), entry(day(4, 18), "70"), entry(day(4, 2), "50")},
+			unit:    trendDay,
+			want:    []TrendRollup{{Start: day(4, 0), Score: TrendStat{Count: 3, Sum: 180, Min: 50, Max: 70, Last: 70, LastAt: day(4, 18)}}},
+		},
+		{
+			name:    "out of order days stay sorted",
+			entries: []IndexEntry{entry(day(6, 10), "70"), entry(day(4, 10), "60"), entry(day(5, 10), "65")},
+			unit:    trendDay,
+			want: []TrendRollup{
+				{Start: day(4, 0), Score: TrendStat{Count: 1, Sum: 60, Min: 60, Max: 60, Last: 60, LastAt: day(4, 10)}},
+				{Start: day(5, 0), Score: TrendStat{Count: 1, Sum: 65, Min: 65, Max: 65, Last: 65, LastAt: day(5, 10)}},
+				{Start: day(6, 0), Score: TrendStat{Count: 1, Sum: 70, Min: 70, Max: 70, Last: 70, LastAt: day(6, 10)}},
+			},
+		},
+		{
+			name:    "days are UTC",
+			entries: []IndexEntry{entry(time.Date(2026, 5, 5, 1, 0, 0, 0, time.FixedZone("UTC+3", 3*3600)), "60")},
+			unit:    trendDay,
+			want:    []TrendRollup{{Start: day(4, 0), Score: TrendStat{Count: 1, Sum: 60, Min: 60, Max: 60, Last: 60, LastAt: time.Date(2026, 5, 5, 1, 0, 0, 0, time.FixedZone("UTC+3", 3*3600))}}},
+		},
+		{
+			// 4 May 2026 is a Monday, weeks start on Mondays
+			name:    "weeks",
+			entries: []IndexEntry{entry(day(3, 23), "50"), entry(day(4, 0), "60"), entry(day(10, 23), "70")},
+			unit:    trendWeek,
+			want: []TrendRollup{
+				{Start: time.Date(2026, 4, 27, 0, 0, 0, 0, time.UTC), Score: TrendStat{Count: 1, Sum: 50, Min: 50, Max: 50, Last: 50, LastAt: day(3, 23)}},
+				{Start: day(4, 0), Score: TrendStat{Count: 2, Sum: 130, Min: 60, Max: 70, Last: 70, LastAt: day(10, 23)}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rollups []TrendRollup
+			for _, e := range tt.entries {
+				rollups = addToRollups(rollups, e, tt.unit)
+			}
+
+			if len(rollups) != len(tt.want) {
+				t.Fatalf("got %d rollups, want %d: %+v", len(rollups), len(tt.want), rollups)
+			}
+			for i := range rollups {
+				if !rollups[i].Start.Equal(tt.want[i].Start) {
+					t.Errorf("rollup %d starts %s, want %s", i, rollups[i].Start, tt.want[i].Start)
+				}
+				if got, want := rollups[i].Score, tt.want[i].Score; !trendStatsEqual(got, want) {
+					t.Errorf("rollup %d score = %+v, want %+v", i, got, want)
+				}
+				if rollups[i].Warnings.Count != rollups[i].Score.Count || rollups[i].Tests.Count != rollups[i].Score.Count {
+					t.Errorf("rollup %d counts differ between metrics: %+v", i, rollups[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMergeRollups(t *testing.T) {
+	// One audit a day for three weeks from Monday 4 May 2026, scoring 50, 51, 52, ...
+	var entries []IndexEntry
+	var daily, weekly []TrendRollup
+	for d := 0; d < 21; d++ {
+		e := IndexEntry{
+			Timestamp:      time.Date(2026, 5, 4+d, 12, 0, 0, 0, time.UTC),
+			HardeningIndex: strconv.Itoa(50 + d),
+		}
+		entries = append(entries, e)
+		daily = addToRollups(daily, e, trendDay)
+		weekly = addToRollups(weekly, e, trendWeek)
+	}
+
+	tests := []struct {
+		name   string
+		bucket time.Duration
+		counts []int
+		avgs   []float64
+	}{
+		{"same size", trendDay, repeatInt(1, 21), nil},
+		{"weeks", trendWeek, []int{7, 7, 7}, []float64{53, 60, 67}},
+		{"two days", 2 * trendDay, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged := mergeRollups(daily, tt.bucket)
+
+			// Merging daily rollups matches rolling the entries up directly
+			var direct []TrendRollup
+			for _, e := range entries {
+				direct = addToRollups(direct, e, tt.bucket)
+			}
+			if len(merged) != len(direct) {
+				t.Fatalf("got %d merged rollups, want %d", len(merged), len(direct))
+			}
+			for i := range merged {
+				if !merged[i].Start.Equal(direct[i].Start) || !trendStatsEqual(merged[i].Score, direct[i].Score) {
+					t.Errorf("merged rollup %d = %+v, want %+v", i, merged[i], direct[i])
+				}
+			}
+
+			if tt.counts != nil {
+				counts := make([]int, len(merged))
+				for i, rollup := range merged {
+					counts[i] = rollup.Score.Count
+				}
+				if !reflect.DeepEqual(counts, tt.counts) {
+					t.Errorf("counts = %v, want %v", counts, tt.counts)
+				}
+			}
+			for i, avg := range tt.avgs {
+				if got := merged[i].Score.value("avg"); got != avg {
+					t.Errorf("rollup %d average = %v, want %v", i, got, avg)
+				}
+			}
+			if rollupCount(merged) != len(entries) {
+				t.Errorf("merged rollups count %d audits, want %d", rollupCount(merged), len(entries))
+			}
+		})
+	}
+
+	// The pre-computed weekly rollups agree with merged daily ones
+	merged := mergeRollups(daily, trendWeek)
+	for i := range weekly {
+		if !trendStatsEqual(weekly[i].Score, merged[i].Score) {
+			t.Errorf("weekly rollup %d = %+v, merged daily = %+v", i, weekly[i].Score, merged[i].Score)
+		}
+	}
+
+	if merged := mergeRollups(nil, trendWeek); len(merged) != 0 {
+		t.Errorf("merging no rollups = %v", merged)
+	}
+}
+
+func trendStatsEqual(a, b TrendStat) bool {
+	return a.Count == b.Count && a.Sum == b.Sum && a.Min == b.Min && a.Max == b.Max && a.Last == b.Last && a.LastAt.Equal(b.LastAt)
+}
+
+func repeatInt(value, n int) []int {
+	values := make([]int, n)
+	for i := range values {
+		values[i] = value
+	}
+	return values
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ImprovedControl is a compliance control that would pass once the planned fixes are in
+type ImprovedControl struct {
+	Framework string `json:"framework"`
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	Severity  string `json:"severity"`
+}
+
+// FrameworkProjection compares the current and projected score of one framework
+type FrameworkProjection struct {
+	Current   float64 `json:"current"`
+	Projected float64 `json:"projected"`
+	Delta     float64 `json:"delta"`
+}
+
+// WhatIfResult is the projected outcome of applying a set of remediations
+type WhatIfResult struct {
+	ServerID               string                         `json:"server_id"`
+	Distro                 string                         `json:"distro"`
+	Remediations           []string                       `json:"remediations"`      // Catalog entries applied to the projection
+	ResolvedFindings       []string                       `json:"resolved_findings"` // Findings that would no longer be reported
+	Unknown                []string                       `json:"unknown"`           // IDs matching neither a remediation nor a current finding
+	CurrentHardening       float64                        `json:"current_hardening_index"`
+	ProjectedHardening     float64                        `json:"projected_hardening_index"` // Estimate, Lynis weighs its own tests
+	Current                ComplianceAnalysis             `json:"current"`
+	Projected              ComplianceAnalysis             `json:"projected"`
+	Frameworks             map[string]FrameworkProjection `json:"frameworks"`
+	ImprovedControls       []ImprovedControl              `json:"improved_controls"`
+	RemainingFindingsCount int                            `json:"remaining_findings_count"`
+}
+
+// Estimated hardening index gain per resolved finding
+var hardeningGainBySeverity = map[string]float64{
+	"critical": 4,
+	"high":     3,
+	"medium":   2,
+	"low":      1,
+}
+
+// projectRemediations re-evaluates a report as if the given remediations or findings were fixed
+func projectRemediations(data map[string]string, distro DistroInfo, ids []string) WhatIfResult {
+	result := WhatIfResult{
+		Distro:           distro.String(),
+		Remediations:     []string{},
+		ResolvedFindings: []string{},
+		Unknown:          []string{},
+	}
+
+	currentFindings := extractSecurityFindings(data)
+	present := make(map[string]bool)
+	for _, finding := range currentFindings {
+		present[finding.ID] = true
+	}
+
+	projected := make(map[string]string, len(data))
+	for key, value := range data {
+		projected[key] = value
+	}
+
+	// Findings treated as passed, by test ID or dashboard alias
+	passing := make(map[string]bool)
+	applied := make(map[string]bool)
+
+	for _, id := range ids {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+
+		entry, ok := getRemediationByID(id)
+		if !ok {
+			entry, ok = getRemediationForFinding(id)
+		}
+
+		if !ok {
+			if !present[id] {
+				result.Unknown = append(result.Unknown, id)
+				continue
+			}
+			// No catalog entry, but the check can still be projected as passed
+			passing[id] = true
+			continue
+		}
+
+		if applied[entry.ID] {
+			continue
+		}
+		applied[entry.ID] = true
+		result.Remediations = append(result.Remediations, entry.ID)
+
+		passing[entry.TestID] = true
+		for _, alias := range entry.Aliases {
+			passing[alias] = true
+		}
+
+		for key, value := range entry.ProjectedFields {
+			projected[key] = value
+		}
+		if variant, ok := entry.VariantFor(distro); ok {
+			for key, value := range variant.ProjectedFields {
+				projected[key] = value
+			}
+		}
+	}
+
+	// Drop the fixed tests from the warning[] and suggestion[] lists
+	for _, key := range []string{"warning", "suggestion"} {
+		var kept []string
+		for _, entry := range reportArray(projected, key) {
+			testID := strings.TrimSpace(strings.Split(entry, "|")[0])
+			if !passing[testID] {
+				kept = append(kept, entry)
+			}
+		}
+		if len(kept) == 0 {
+			delete(projected, key+"[]")
+		} else {
+			projected[key+"[]"] = strings.Join(kept, "\n")
+		}
+	}
+
+	// Anything still reported after the projection stays open
+	projectedFindings := extractSecurityFindings(projected)
+	remaining := make(map[string]bool)
+	for _, finding := range projectedFindings {
+		remaining[finding.ID] = true
+	}
+
+	result.CurrentHardening, _ = strconv.ParseFloat(data["hardening_index"], 64)
+	result.ProjectedHardening = result.CurrentHardening
+	for _, finding := range currentFindings {
+		if remaining[finding.ID] {
+			continue
+		}
+		result.ResolvedFindings = append(result.ResolvedFindings, finding.ID)
+		result.ProjectedHardening += hardeningGainBySeverity[finding.Severity]
+	}
+	result.ProjectedHardening = math.Min(result.ProjectedHardening, 100)
+	result.RemainingFindingsCount = len(projectedFindings)
+
+	result.Current = analyzeCompliance(data)
+	result.Projected = analyzeCompliance(projected)
+	result.Frameworks = make(map[string]FrameworkProjection)
+	result.ImprovedControls = []ImprovedControl{}
+
+	currentProfiles := result.Current.Profiles()
+	for framework, profile := range result.Projected.Profiles() {
+		current := currentProfiles[framework]
+		result.Frameworks[framework] = FrameworkProjection{
+			Current:   current.Score,
+			Projected: profile.Score,
+			Delta:     math.Round((profile.Score-current.Score)*10) / 10,
+		}
+
+		for id, control := range profile.Controls {
+			if control.Status == "passed" && current.Controls[id].Status != "passed" {
+				result.ImprovedControls = append(result.ImprovedControls, ImprovedControl{
+					Framework: framework,
+					ID:        id,
+					Title:     control.Title,
+					Severity:  control.Severity,
+				})
+			}
+		}
+	}
+
+	sort.Slice(result.ImprovedControls, func(i, j int) bool {
+		if result.ImprovedControls[i].Framework != result.ImprovedControls[j].Framework {
+			return result.ImprovedControls[i].Framework < result.ImprovedControls[j].Framework
+		}
+		return result.ImprovedControls[i].ID < result.ImprovedControls[j].ID
+	})
+
+	return result
+}
+
+// Profiles returns each framework profile keyed by its JSON name
+func (a ComplianceAnalysis) Profiles() map[string]ComplianceProfile {
+	return map[string]ComplianceProfile{
+		"cis_level1": a.CIS_Level1,
+		"cis_level2": a.CIS_Level2,
+		"iso27001":   a.ISO27001,
+		"nist":       a.NIST,
+		"pcidss":     a.PCIDSS,
+		"soc2":       a.SOC2,
+		"hipaa":      a.HIPAA,
+		"gdpr":       a.GDPR,
+		"sox":        a.SOX,
+		"fisma":      a.FISMA,
+		"cobit":      a.COBIT,
+	}
+}